@@ -0,0 +1,65 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Hook é uma função executada durante o encerramento do serviço, por exemplo para
+// persistir caches ou finalizar métricas. Deve respeitar o prazo do contexto recebido.
+type Hook func(ctx context.Context) error
+
+var (
+	mu    sync.Mutex
+	hooks []Hook
+)
+
+// RegisterShutdownHook regista uma função a executar no encerramento do serviço.
+// Os hooks são executados pela ordem inversa do registo, tal como os `defer` em Go:
+// o último componente inicializado é o primeiro a ser finalizado.
+func RegisterShutdownHook(hook Hook) {
+	mu.Lock()
+	defer mu.Unlock()
+	hooks = append(hooks, hook)
+}
+
+// Shutdown executa todos os hooks registados, pela ordem inversa, partilhando o prazo
+// do contexto. Um hook que falhe não impede a execução dos restantes; os erros são
+// agregados no retorno. Se o prazo expirar, os hooks ainda por executar são ignorados.
+// Os hooks são removidos do registo, pelo que chamadas seguintes não os voltam a executar.
+func Shutdown(ctx context.Context) error {
+	mu.Lock()
+	pending := hooks
+	hooks = nil
+	mu.Unlock()
+
+	var errs []error
+	for i := len(pending) - 1; i >= 0; i-- {
+		if err := run(ctx, pending[i]); err != nil {
+			errs = append(errs, err)
+		}
+		if ctx.Err() != nil {
+			if i > 0 {
+				errs = append(errs, fmt.Errorf("%d hook(s) de encerramento não executado(s): %w", i, ctx.Err()))
+			}
+			break
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// run executa um hook numa goroutine própria, para que um hook que ignore o contexto
+// não consiga atrasar o encerramento para lá do prazo.
+func run(ctx context.Context, hook Hook) error {
+	done := make(chan error, 1)
+	go func() { done <- hook(ctx) }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("hook de encerramento interrompido: %w", ctx.Err())
+	}
+}
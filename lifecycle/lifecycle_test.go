@@ -0,0 +1,97 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// resetHooks garante que cada teste começa e termina sem hooks registados.
+func resetHooks(t *testing.T) {
+	t.Helper()
+	mu.Lock()
+	hooks = nil
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		hooks = nil
+		mu.Unlock()
+	})
+}
+
+func TestShutdownRunsHooksInReverseOrder(t *testing.T) {
+	resetHooks(t)
+	var (
+		order []int
+		omu   sync.Mutex
+	)
+	for i := 1; i <= 3; i++ {
+		RegisterShutdownHook(func(context.Context) error {
+			omu.Lock()
+			defer omu.Unlock()
+			order = append(order, i)
+			return nil
+		})
+	}
+
+	if err := Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if want := []int{3, 2, 1}; !reflect.DeepEqual(order, want) {
+		t.Errorf("ordem = %v, esperado %v", order, want)
+	}
+}
+
+func TestShutdownAggregatesErrors(t *testing.T) {
+	resetHooks(t)
+	errFirst, errLast := errors.New("primeiro"), errors.New("último")
+	ran := false
+	RegisterShutdownHook(func(context.Context) error { return errFirst })
+	RegisterShutdownHook(func(context.Context) error { ran = true; return nil })
+	RegisterShutdownHook(func(context.Context) error { return errLast })
+
+	err := Shutdown(context.Background())
+	if !errors.Is(err, errFirst) || !errors.Is(err, errLast) {
+		t.Errorf("erro = %v, esperado os dois erros", err)
+	}
+	if !ran {
+		t.Error("um hook que falha não deveria impedir os restantes")
+	}
+}
+
+func TestShutdownRespectsDeadline(t *testing.T) {
+	resetHooks(t)
+	skipped := false
+	RegisterShutdownHook(func(context.Context) error { skipped = true; return nil })
+	// Um hook que ignora o contexto não pode atrasar o encerramento.
+	RegisterShutdownHook(func(context.Context) error { time.Sleep(time.Second); return nil })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := Shutdown(ctx)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Shutdown demorou %v, para lá do prazo de 50ms", elapsed)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("erro = %v, esperado context.DeadlineExceeded", err)
+	}
+	if skipped {
+		t.Error("os hooks por executar depois do prazo deveriam ser ignorados")
+	}
+}
+
+func TestShutdownRunsHooksOnce(t *testing.T) {
+	resetHooks(t)
+	calls := 0
+	RegisterShutdownHook(func(context.Context) error { calls++; return nil })
+
+	Shutdown(context.Background())
+	Shutdown(context.Background())
+	if calls != 1 {
+		t.Errorf("o hook foi executado %d vezes, esperado 1", calls)
+	}
+}
@@ -0,0 +1,64 @@
+package lifecycle
+
+import (
+	"Observabilidade/logging"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// DefaultGracePeriod é o tempo dado às requisições em curso para terminarem depois de o
+// serviço receber SIGINT ou SIGTERM.
+const DefaultGracePeriod = 10 * time.Second
+
+// Serve atende as requisições de `ln` até o processo receber SIGINT ou SIGTERM. Nessa
+// altura deixa de aceitar ligações e espera, no máximo `grace`, que as requisições em
+// curso terminem. Só retorna depois disso, para que os hooks de encerramento e o envio
+// dos spans pendentes, executados a seguir em `main`, incluam essas requisições.
+func Serve(ln net.Listener, handler http.Handler, grace time.Duration) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return serve(ctx, ln, handler, grace)
+}
+
+// serve faz o trabalho de Serve, encerrando quando `ctx` é cancelado.
+//
+// O contexto de cada requisição deriva de um contexto base cancelado no início do
+// encerramento: as requisições de longa duração (ex: os streams SSE) terminam de imediato
+// em vez de esgotarem o `grace`, e as restantes veem o cancelamento nas chamadas em curso.
+func serve(ctx context.Context, ln net.Listener, handler http.Handler, grace time.Duration) error {
+	baseCtx, cancelBase := context.WithCancel(context.Background())
+	defer cancelBase()
+
+	srv := &http.Server{
+		Handler:     handler,
+		BaseContext: func(net.Listener) context.Context { return baseCtx },
+	}
+	srv.RegisterOnShutdown(cancelBase)
+
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.Serve(ln) }()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	logging.Default().Info("sinal de encerramento recebido; a aguardar as requisições em curso",
+		"grace", grace.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
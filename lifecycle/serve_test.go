@@ -0,0 +1,100 @@
+package lifecycle
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// startServe arranca serve num listener local e devolve o endereço, a função que simula
+// o sinal de encerramento e o canal com o retorno de serve.
+func startServe(t *testing.T, handler http.Handler, grace time.Duration) (string, context.CancelFunc, <-chan error) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	ctx, signal := context.WithCancel(context.Background())
+	t.Cleanup(signal)
+	done := make(chan error, 1)
+	go func() { done <- serve(ctx, ln, handler, grace) }()
+	return "http://" + ln.Addr().String(), signal, done
+}
+
+func TestServeCancelsLongLivedRequestsOnShutdown(t *testing.T) {
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		close(started)
+		// Tal como um stream SSE, só termina quando o contexto é cancelado.
+		<-r.Context().Done()
+	})
+	url, signal, done := startServe(t, handler, 5*time.Second)
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+	<-started
+
+	start := time.Now()
+	signal()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("serve: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("serve esperou pelo grace em vez de cancelar a requisição de longa duração")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("encerramento demorou %v", elapsed)
+	}
+}
+
+func TestServeWaitsForInFlightRequests(t *testing.T) {
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		io.WriteString(w, "ok")
+	})
+	url, signal, done := startServe(t, handler, 5*time.Second)
+
+	body := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			body <- "erro: " + err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		body <- string(b)
+	}()
+	<-started
+	signal()
+
+	if got := <-body; got != "ok" {
+		t.Errorf("resposta = %q, esperado \"ok\"", got)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("serve: %v", err)
+	}
+}
+
+func TestServeReturnsListenerErrors(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	ln.Close()
+	if err := serve(context.Background(), ln, http.NotFoundHandler(), time.Second); err == nil {
+		t.Fatal("esperado erro de um listener fechado")
+	}
+}
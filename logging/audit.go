@@ -0,0 +1,83 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// maxAuditErrorBytes limita o excerto do corpo de erro incluído no evento de auditoria.
+const maxAuditErrorBytes = 128
+
+// auditKey é a chave (não exportada) usada para guardar o auditTarget no contexto.
+type auditKey struct{}
+
+// auditTarget recebe de `Middleware` o logger da requisição, para que o evento de
+// auditoria das rotas instrumentadas inclua o trace ID.
+type auditTarget struct {
+	logger *slog.Logger
+}
+
+// AuditMiddleware regista um evento de auditoria (ver `audit`) para cada resposta 4xx ou
+// 5xx. Deve ser montada ao nível do router (`r.Use`), depois de `middleware.RequestID`,
+// para abranger também as respostas do próprio Chi (404 e 405) e as rotas fora da
+// instrumentação, como /favicon.ico.
+func AuditMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target := &auditTarget{}
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		body := &limitedBuffer{}
+		ww.Tee(body)
+		next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), auditKey{}, target)))
+
+		// Fora das rotas instrumentadas, o logger é montado aqui, já com a rota resolvida.
+		logger := target.logger
+		if logger == nil {
+			logger = base.With(requestAttrs(r)...)
+		}
+		audit(logger, r, ww, body)
+	})
+}
+
+// audit regista, em WARN, um evento de auditoria para cada resposta 4xx ou 5xx. Ao
+// contrário do log de acesso, este evento é sempre emitido, para que nenhuma falha se
+// perca. O logger já inclui o método, a rota e o trace ID da requisição.
+func audit(logger *slog.Logger, r *http.Request, ww middleware.WrapResponseWriter, body *limitedBuffer) {
+	status := ww.Status()
+	if status < http.StatusBadRequest {
+		return
+	}
+	logger.Warn("resposta de erro",
+		slog.Bool("audit", true),
+		slog.Int("status", status),
+		slog.String("client_ip", remoteIP(r)),
+		slog.String("error", strings.TrimSpace(body.String())),
+	)
+}
+
+// remoteIP devolve o IP de `r.RemoteAddr`, sem a porta.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// limitedBuffer guarda apenas os primeiros `maxAuditErrorBytes` bytes escritos, sem
+// nunca falhar, para poder ser usado como destino secundário da resposta.
+type limitedBuffer struct {
+	bytes.Buffer
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := maxAuditErrorBytes - b.Len(); room > 0 {
+		b.Buffer.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
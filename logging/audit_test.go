@@ -0,0 +1,166 @@
+package logging
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestAuditOnlyForErrorStatuses(t *testing.T) {
+	for _, status := range []int{http.StatusOK, http.StatusNoContent, http.StatusFound, http.StatusUnprocessableEntity, http.StatusNotFound, http.StatusBadGateway} {
+		t.Run(strconv.Itoa(status), func(t *testing.T) {
+			buf := captureBase(t)
+			r := chi.NewRouter()
+			r.Use(AuditMiddleware)
+			r.With(Middleware).Get("/weather/{cep}", func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(status)
+				w.Write([]byte("invalid zipcode\n"))
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/weather/123", nil)
+			req.RemoteAddr = "203.0.113.7:51234"
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			entries := logEntries(t, buf, "resposta de erro")
+			if status < http.StatusBadRequest {
+				if len(entries) != 0 {
+					t.Fatalf("status %d não deveria gerar auditoria: %v", status, entries)
+				}
+				return
+			}
+			if len(entries) != 1 {
+				t.Fatalf("esperado um evento de auditoria, obtido %d:\n%s", len(entries), buf)
+			}
+			want := map[string]any{
+				"level":     "WARN",
+				"audit":     true,
+				"status":    float64(status),
+				"method":    http.MethodGet,
+				"route":     "/weather/{cep}",
+				"client_ip": "203.0.113.7",
+				"error":     "invalid zipcode",
+			}
+			for key, value := range want {
+				if got := entries[0][key]; got != value {
+					t.Errorf("%s = %v, esperado %v", key, got, value)
+				}
+			}
+		})
+	}
+}
+
+func TestAuditLimitsErrorBody(t *testing.T) {
+	buf := captureBase(t)
+	handler := AuditMiddleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(strings.Repeat("x", maxAuditErrorBytes*2)))
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/weather/01001000", nil))
+
+	// O cliente recebe o corpo completo; a auditoria guarda apenas o início.
+	if rec.Body.Len() != maxAuditErrorBytes*2 {
+		t.Errorf("o cliente recebeu %d bytes, esperado %d", rec.Body.Len(), maxAuditErrorBytes*2)
+	}
+	entries := logEntries(t, buf, "resposta de erro")
+	if len(entries) != 1 {
+		t.Fatalf("esperado um evento de auditoria, obtido %d", len(entries))
+	}
+	if got := entries[0]["error"].(string); len(got) != maxAuditErrorBytes {
+		t.Errorf("excerto do erro com %d bytes, esperado %d", len(got), maxAuditErrorBytes)
+	}
+}
+
+func TestAuditCoversResponsesOutsideMiddleware(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		target string
+		status int
+		route  string
+	}{
+		{name: "rota inexistente", method: http.MethodGet, target: "/nao-existe", status: http.StatusNotFound},
+		{name: "método não permitido", method: http.MethodDelete, target: "/weather/01001000", status: http.StatusMethodNotAllowed},
+		{name: "favicon", method: http.MethodGet, target: "/favicon.ico", status: http.StatusInternalServerError, route: "/favicon.ico"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := captureBase(t)
+			r := chi.NewRouter()
+			r.Use(middleware.RequestID)
+			r.Use(AuditMiddleware)
+			r.With(Middleware).Get("/weather/{cep}", func(w http.ResponseWriter, _ *http.Request) {})
+			// Tal como nos serviços, o favicon fica fora de `Middleware`.
+			r.Get("/favicon.ico", func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			})
+
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			req.Header.Set(middleware.RequestIDHeader, "req-404")
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, esperado %d", rec.Code, tt.status)
+			}
+
+			entries := logEntries(t, buf, "resposta de erro")
+			if len(entries) != 1 {
+				t.Fatalf("esperado um evento de auditoria, obtido %d:\n%s", len(entries), buf)
+			}
+			want := map[string]any{
+				"audit":      true,
+				"status":     float64(tt.status),
+				"method":     tt.method,
+				"request_id": "req-404",
+			}
+			if tt.route != "" {
+				want["route"] = tt.route
+			}
+			for key, value := range want {
+				if got := entries[0][key]; got != value {
+					t.Errorf("%s = %v, esperado %v", key, got, value)
+				}
+			}
+		})
+	}
+}
+
+func TestAuditUsesInstrumentedRequestLogger(t *testing.T) {
+	buf := captureBase(t)
+	tp := sdktrace.NewTracerProvider()
+	defer tp.Shutdown(context.Background())
+
+	var traceID string
+	// Faz o papel do middleware do OTEL, que cria o span do servidor antes do logger.
+	withSpan := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, span := tp.Tracer("test").Start(r.Context(), "WeatherHandler")
+			defer span.End()
+			traceID = span.SpanContext().TraceID().String()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+	r := chi.NewRouter()
+	r.Use(AuditMiddleware)
+	r.With(withSpan, Middleware).Get("/weather/{cep}", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/weather/01001000", nil))
+
+	entries := logEntries(t, buf, "resposta de erro")
+	if len(entries) != 1 {
+		t.Fatalf("esperado um evento de auditoria, obtido %d:\n%s", len(entries), buf)
+	}
+	if got := entries[0]["trace_id"]; got != traceID {
+		t.Errorf("trace_id = %v, esperado %q", got, traceID)
+	}
+}
@@ -0,0 +1,75 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// loggerKey é a chave (não exportada) usada para guardar o logger no contexto.
+type loggerKey struct{}
+
+// WithLogger devolve uma cópia do contexto que transporta o logger indicado.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// LoggerFromContext devolve o logger guardado no contexto pela Middleware, já com os
+// campos de correlação da requisição. Fora de uma requisição devolve o logger partilhado.
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return base
+}
+
+// With acrescenta campos ao logger do contexto (ex: o CEP, assim que é conhecido),
+// para que todas as funções chamadas a seguir os incluam nos seus logs.
+func With(ctx context.Context, args ...any) context.Context {
+	return WithLogger(ctx, LoggerFromContext(ctx).With(args...))
+}
+
+// Middleware injeta no contexto da requisição um logger com o trace ID, o request ID e o
+// padrão da rota. Deve envolver o handler final, dentro do middleware do OTEL, para que o
+// span do servidor já exista e o Chi já tenha resolvido a rota. O mesmo logger é usado
+// pela auditoria de `AuditMiddleware` e, com SLOW_REQUEST_LOG_MS, as requisições lentas
+// são registadas com a sua duração (ver `logAccess`).
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := base.With(requestAttrs(r)...)
+		if target, ok := r.Context().Value(auditKey{}).(*auditTarget); ok {
+			target.logger = logger
+		}
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+		next.ServeHTTP(ww, r.WithContext(WithLogger(r.Context(), logger)))
+		logAccess(logger, ww, time.Since(start))
+	})
+}
+
+// requestAttrs devolve os campos de correlação da requisição: o método, o trace e o span
+// (se houver um span no contexto), o request ID e o padrão da rota resolvida pelo Chi.
+func requestAttrs(r *http.Request) []any {
+	ctx := r.Context()
+	attrs := []any{slog.String("method", r.Method)}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		attrs = append(attrs,
+			slog.String("trace_id", sc.TraceID().String()),
+			slog.String("span_id", sc.SpanID().String()),
+		)
+	}
+	if reqID := middleware.GetReqID(ctx); reqID != "" {
+		attrs = append(attrs, slog.String("request_id", reqID))
+	}
+	if rctx := chi.RouteContext(ctx); rctx != nil {
+		if pattern := rctx.RoutePattern(); pattern != "" {
+			attrs = append(attrs, slog.String("route", pattern))
+		}
+	}
+	return attrs
+}
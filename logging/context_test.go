@@ -0,0 +1,103 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// logEntries devolve as entradas JSON do buffer com a mensagem indicada.
+func logEntries(t *testing.T, buf *bytes.Buffer, msg string) []map[string]any {
+	t.Helper()
+	var entries []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("log inválido %q: %v", line, err)
+		}
+		if entry["msg"] == msg {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func TestMiddlewareSeedsRequestLogger(t *testing.T) {
+	buf := captureBase(t)
+	tp := sdktrace.NewTracerProvider()
+	defer tp.Shutdown(context.Background())
+
+	var span trace.Span
+	// Faz o papel do middleware do OTEL, que cria o span do servidor antes do logger.
+	withSpan := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var ctx context.Context
+			ctx, span = tp.Tracer("test").Start(r.Context(), "WeatherHandler")
+			defer span.End()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+	// fetch simula uma função chamada mais abaixo, que só recebe o contexto.
+	fetch := func(ctx context.Context) {
+		LoggerFromContext(ctx).Info("a consultar a API")
+	}
+
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.With(withSpan, Middleware).Get("/weather/{cep}", func(w http.ResponseWriter, r *http.Request) {
+		ctx := With(r.Context(), "cep", chi.URLParam(r, "cep"))
+		fetch(ctx)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/weather/01001000", nil)
+	req.Header.Set(middleware.RequestIDHeader, "req-123")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	entries := logEntries(t, buf, "a consultar a API")
+	if len(entries) != 1 {
+		t.Fatalf("esperada uma entrada, obtido %d:\n%s", len(entries), buf)
+	}
+	want := map[string]string{
+		"method":     http.MethodGet,
+		"trace_id":   span.SpanContext().TraceID().String(),
+		"span_id":    span.SpanContext().SpanID().String(),
+		"request_id": "req-123",
+		"route":      "/weather/{cep}",
+		"cep":        "01001000",
+	}
+	for key, value := range want {
+		if got := entries[0][key]; got != value {
+			t.Errorf("%s = %v, esperado %q", key, got, value)
+		}
+	}
+}
+
+func TestLoggerFromContextWithoutRequest(t *testing.T) {
+	if got := LoggerFromContext(context.Background()); got != base {
+		t.Error("fora de uma requisição deveria ser devolvido o logger partilhado")
+	}
+}
+
+func TestWithAccumulatesFields(t *testing.T) {
+	buf := captureBase(t)
+	ctx := With(context.Background(), "cep", "01001000")
+	ctx = With(ctx, "provider", "viacep")
+	LoggerFromContext(ctx).Info("evento")
+
+	entries := logEntries(t, buf, "evento")
+	if len(entries) != 1 || entries[0]["cep"] != "01001000" || entries[0]["provider"] != "viacep" {
+		t.Errorf("entrada = %v, esperado os dois campos", entries)
+	}
+}
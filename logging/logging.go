@@ -0,0 +1,59 @@
+package logging
+
+import (
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+)
+
+// redacted substitui o valor de qualquer configuração sensível nos logs.
+const redacted = "[REDACTED]"
+
+// sensitiveKeyParts são os fragmentos de nome que identificam uma configuração sensível
+// (chaves de API, segredos, credenciais). A comparação ignora maiúsculas/minúsculas.
+var sensitiveKeyParts = []string{"KEY", "SECRET", "TOKEN", "PASSWORD", "CREDENTIAL", "HEADERS"}
+
+// base é o logger estruturado partilhado pelos serviços. Emite uma entrada JSON por linha
+// no stdout, o que facilita a recolha e a pesquisa dos logs.
+var base = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+// Default devolve o logger estruturado partilhado.
+func Default() *slog.Logger {
+	return base
+}
+
+// LogEffectiveConfig regista, numa única entrada JSON, a configuração efetiva com que o
+// serviço arrancou. Os valores das chaves sensíveis são substituídos por "[REDACTED]",
+// e as chaves são ordenadas para que a saída seja estável entre arranques.
+func LogEffectiveConfig(serviceName string, cfg map[string]string) {
+	keys := make([]string, 0, len(cfg))
+	for k := range cfg {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]any, 0, len(keys))
+	for _, k := range keys {
+		attrs = append(attrs, slog.String(k, Redact(k, cfg[k])))
+	}
+	base.Info("effective configuration",
+		slog.String("service", serviceName),
+		slog.Group("config", attrs...),
+	)
+}
+
+// Redact devolve o valor sem alterações, a menos que a chave indique uma configuração
+// sensível. Valores vazios são mantidos, para deixar claro que a chave não está definida.
+func Redact(key, value string) string {
+	if value == "" {
+		return value
+	}
+	upper := strings.ToUpper(key)
+	for _, part := range sensitiveKeyParts {
+		if strings.Contains(upper, part) {
+			return redacted
+		}
+	}
+	return value
+}
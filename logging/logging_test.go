@@ -0,0 +1,68 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+// captureBase faz com que o logger partilhado escreva para um buffer durante o teste.
+func captureBase(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	previous := base
+	base = slog.New(slog.NewJSONHandler(buf, nil))
+	t.Cleanup(func() { base = previous })
+	return buf
+}
+
+func TestLogEffectiveConfigRedactsSecrets(t *testing.T) {
+	buf := captureBase(t)
+	LogEffectiveConfig("service-b", map[string]string{
+		"WEATHER_API_KEY":            "chave-secreta",
+		"SERVICE_B_SHARED_SECRET":    "segredo",
+		"OTEL_EXPORTER_OTLP_HEADERS": "Authorization=Bearer%20abc",
+		"DB_PASSWORD":                "senha",
+		"GITHUB_TOKEN":               "ghp_x",
+		"EMPTY_API_KEY":              "",
+		"PORT":                       "8081",
+	})
+
+	var entry struct {
+		Msg     string            `json:"msg"`
+		Service string            `json:"service"`
+		Config  map[string]string `json:"config"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("a configuração deveria ser uma única entrada JSON: %v\n%s", err, buf)
+	}
+	if entry.Msg != "effective configuration" || entry.Service != "service-b" {
+		t.Errorf("entrada inesperada: %+v", entry)
+	}
+	for _, key := range []string{"WEATHER_API_KEY", "SERVICE_B_SHARED_SECRET", "OTEL_EXPORTER_OTLP_HEADERS", "DB_PASSWORD", "GITHUB_TOKEN"} {
+		if got := entry.Config[key]; got != redacted {
+			t.Errorf("%s = %q, esperado %q", key, got, redacted)
+		}
+	}
+	if got := entry.Config["PORT"]; got != "8081" {
+		t.Errorf("PORT = %q, esperado 8081", got)
+	}
+	if got, ok := entry.Config["EMPTY_API_KEY"]; !ok || got != "" {
+		t.Errorf("uma chave sensível vazia deveria continuar vazia, obtido %q", got)
+	}
+	for _, secret := range []string{"chave-secreta", "segredo", "Bearer", "senha", "ghp_x"} {
+		if bytes.Contains(buf.Bytes(), []byte(secret)) {
+			t.Errorf("o log contém o valor sensível %q", secret)
+		}
+	}
+}
+
+func TestRedactIgnoresCase(t *testing.T) {
+	if got := Redact("weather_api_key", "abc"); got != redacted {
+		t.Errorf("Redact em minúsculas = %q, esperado %q", got, redacted)
+	}
+	if got := Redact("SERVICE_B_URL", "http://service-b:8081"); got != "http://service-b:8081" {
+		t.Errorf("Redact de uma chave não sensível = %q", got)
+	}
+}
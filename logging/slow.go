@@ -0,0 +1,54 @@
+package logging
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// slowRequestThreshold é o limiar acima do qual uma requisição é registada como lenta.
+// Zero (padrão) desativa o registo de acesso feito por `Middleware`.
+var slowRequestThreshold time.Duration
+
+// SlowRequestThresholdFromEnv lê o limiar (em milissegundos) da variável SLOW_REQUEST_LOG_MS.
+// Devolve zero quando a variável não está definida.
+func SlowRequestThresholdFromEnv() (time.Duration, error) {
+	value := os.Getenv("SLOW_REQUEST_LOG_MS")
+	if value == "" {
+		return 0, nil
+	}
+	ms, err := strconv.Atoi(value)
+	if err != nil || ms <= 0 {
+		return 0, fmt.Errorf("SLOW_REQUEST_LOG_MS deve ser um inteiro positivo: %q", value)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// SetSlowRequestThreshold ativa o registo de acesso por latência: as requisições mais
+// lentas do que `d` são registadas em WARN, com todos os detalhes, e as restantes apenas
+// em DEBUG (fora dos logs com o nível padrão). Serve de alternativa ao log de acesso do Chi.
+func SetSlowRequestThreshold(d time.Duration) {
+	slowRequestThreshold = d
+}
+
+// logAccess regista a requisição concluída de acordo com o limiar de latência.
+func logAccess(logger *slog.Logger, ww middleware.WrapResponseWriter, elapsed time.Duration) {
+	if slowRequestThreshold <= 0 {
+		return
+	}
+	attrs := []any{
+		slog.Int("status", ww.Status()),
+		slog.Int("bytes", ww.BytesWritten()),
+		slog.Float64("duration_ms", float64(elapsed.Microseconds())/1000),
+	}
+	if elapsed < slowRequestThreshold {
+		logger.Debug("requisição concluída", attrs...)
+		return
+	}
+	attrs = append(attrs, slog.Float64("threshold_ms", float64(slowRequestThreshold.Milliseconds())))
+	logger.Warn("requisição lenta", attrs...)
+}
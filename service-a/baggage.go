@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Limites recomendados pela especificação W3C Baggage: 8192 bytes no total e 4096 bytes
+// por item (`chave=valor`, já codificado).
+const (
+	defaultBaggageMaxBytes     = 8192
+	defaultBaggageMaxItemBytes = 4096
+)
+
+// Limites do baggage enviado ao Serviço B. São preenchidos em `main` a partir de
+// BAGGAGE_MAX_BYTES e BAGGAGE_MAX_ITEM_BYTES.
+var (
+	baggageMaxBytes     = defaultBaggageMaxBytes
+	baggageMaxItemBytes = defaultBaggageMaxItemBytes
+)
+
+// withBaggageMember adiciona o par chave/valor ao baggage do contexto, que o propagador
+// envia ao Serviço B. Um item maior do que `baggageMaxItemBytes` tem o valor truncado
+// (evento `baggage.truncated` no span); um item que não caiba no limite total
+// `baggageMaxBytes` é descartado (evento `baggage.dropped`). Em caso de erro (ex: valor
+// inválido), devolve o contexto original.
+func withBaggageMember(ctx context.Context, key, value string) context.Context {
+	span := trace.SpanFromContext(ctx)
+
+	member, err := baggage.NewMemberRaw(key, value)
+	if err != nil {
+		return ctx
+	}
+	if size := len(member.String()); size > baggageMaxItemBytes {
+		// A codificação pode aumentar o tamanho do valor (ex: "é" ocupa 6 bytes), por isso
+		// cortamos o valor na proporção do excesso e depois carácter a carácter, até o item
+		// codificado caber no limite.
+		value = truncateUTF8(value, len(value)*baggageMaxItemBytes/size)
+		for {
+			if member, err = baggage.NewMemberRaw(key, value); err != nil {
+				return ctx
+			}
+			if len(member.String()) <= baggageMaxItemBytes || value == "" {
+				break
+			}
+			_, last := utf8.DecodeLastRuneInString(value)
+			value = value[:len(value)-last]
+		}
+		if len(member.String()) > baggageMaxItemBytes {
+			span.AddEvent("baggage.dropped", trace.WithAttributes(
+				attribute.String("baggage.key", key),
+				attribute.String("baggage.reason", "item_too_large"),
+			))
+			return ctx
+		}
+		span.AddEvent("baggage.truncated", trace.WithAttributes(
+			attribute.String("baggage.key", key),
+			attribute.Int("baggage.original_bytes", size),
+			attribute.Int("baggage.max_item_bytes", baggageMaxItemBytes),
+		))
+	}
+
+	bag, err := baggage.FromContext(ctx).SetMember(member)
+	if err != nil {
+		return ctx
+	}
+	if size := len(bag.String()); size > baggageMaxBytes {
+		span.AddEvent("baggage.dropped", trace.WithAttributes(
+			attribute.String("baggage.key", key),
+			attribute.String("baggage.reason", "total_too_large"),
+			attribute.Int("baggage.total_bytes", size),
+			attribute.Int("baggage.max_bytes", baggageMaxBytes),
+		))
+		return ctx
+	}
+	return baggage.ContextWithBaggage(ctx, bag)
+}
+
+// truncateUTF8 corta `s` a no máximo `n` bytes, sem partir um carácter multibyte.
+func truncateUTF8(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// setBaggageLimits define os limites do baggage durante o teste.
+func setBaggageLimits(t *testing.T, maxBytes, maxItemBytes int) {
+	t.Helper()
+	previousMax, previousItem := baggageMaxBytes, baggageMaxItemBytes
+	baggageMaxBytes, baggageMaxItemBytes = maxBytes, maxItemBytes
+	t.Cleanup(func() { baggageMaxBytes, baggageMaxItemBytes = previousMax, previousItem })
+}
+
+// addBaggage aplica withBaggageMember a cada par, dentro de um span, e devolve o
+// baggage resultante e os eventos registados no span.
+func addBaggage(pairs ...[2]string) (baggage.Baggage, []sdktrace.Event) {
+	recorder := tracetest.NewSpanRecorder()
+	ctx, span := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test").Start(context.Background(), "orchestrate-weather")
+	for _, pair := range pairs {
+		ctx = withBaggageMember(ctx, pair[0], pair[1])
+	}
+	span.End()
+	return baggage.FromContext(ctx), recorder.Ended()[0].Events()
+}
+
+// baggageEvent devolve os atributos do único evento com o nome indicado.
+func baggageEvent(t *testing.T, events []sdktrace.Event, name string) map[string]string {
+	t.Helper()
+	var attrs map[string]string
+	for _, event := range events {
+		if event.Name != name {
+			continue
+		}
+		if attrs != nil {
+			t.Fatalf("mais de um evento %s", name)
+		}
+		attrs = map[string]string{}
+		for _, attr := range event.Attributes {
+			attrs[string(attr.Key)] = attr.Value.Emit()
+		}
+	}
+	if attrs == nil {
+		t.Fatalf("esperado o evento %s, obtidos %v", name, events)
+	}
+	return attrs
+}
+
+func TestBaggageWithinLimits(t *testing.T) {
+	setBaggageLimits(t, defaultBaggageMaxBytes, defaultBaggageMaxItemBytes)
+	bag, events := addBaggage([2]string{"tenant", "acme"}, [2]string{incidentKey, "INC-42"})
+
+	if bag.Member("tenant").Value() != "acme" || bag.Member(incidentKey).Value() != "INC-42" {
+		t.Errorf("baggage = %q", bag.String())
+	}
+	if len(events) != 0 {
+		t.Errorf("não deveria haver eventos, obtidos %v", events)
+	}
+}
+
+func TestOversizedBaggageItemIsTruncated(t *testing.T) {
+	tests := []struct {
+		name, value string
+	}{
+		{"ASCII", strings.Repeat("a", 100)},
+		{"multibyte", strings.Repeat("é", 100)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setBaggageLimits(t, defaultBaggageMaxBytes, 40)
+			bag, events := addBaggage([2]string{"tenant", tt.value})
+
+			member := bag.Member("tenant")
+			if size := len(member.String()); size == 0 || size > 40 {
+				t.Fatalf("item codificado com %d bytes, esperado entre 1 e 40: %q", size, member.String())
+			}
+			if !utf8.ValidString(member.Value()) || !strings.HasPrefix(tt.value, member.Value()) {
+				t.Errorf("valor = %q, esperado um prefixo válido do original", member.Value())
+			}
+			attrs := baggageEvent(t, events, "baggage.truncated")
+			if attrs["baggage.key"] != "tenant" || attrs["baggage.max_item_bytes"] != "40" {
+				t.Errorf("atributos do evento = %v", attrs)
+			}
+		})
+	}
+}
+
+func TestBaggageItemDroppedWhenKeyExceedsLimit(t *testing.T) {
+	setBaggageLimits(t, defaultBaggageMaxBytes, 8)
+	bag, events := addBaggage([2]string{"tenant-identifier", "acme"})
+
+	if bag.Len() != 0 {
+		t.Errorf("baggage = %q, esperado vazio", bag.String())
+	}
+	if attrs := baggageEvent(t, events, "baggage.dropped"); attrs["baggage.reason"] != "item_too_large" {
+		t.Errorf("atributos do evento = %v", attrs)
+	}
+}
+
+func TestBaggageItemDroppedWhenTotalExceedsLimit(t *testing.T) {
+	setBaggageLimits(t, 30, defaultBaggageMaxItemBytes)
+	bag, events := addBaggage([2]string{"tenant", "acme"}, [2]string{incidentKey, strings.Repeat("9", 30)})
+
+	// O item que já estava no baggage mantém-se; só o que excede o total é descartado.
+	if bag.Member("tenant").Value() != "acme" || bag.Len() != 1 {
+		t.Errorf("baggage = %q, esperado apenas tenant=acme", bag.String())
+	}
+	attrs := baggageEvent(t, events, "baggage.dropped")
+	if attrs["baggage.key"] != incidentKey || attrs["baggage.reason"] != "total_too_large" || attrs["baggage.max_bytes"] != "30" {
+		t.Errorf("atributos do evento = %v", attrs)
+	}
+}
+
+func TestTruncateUTF8(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"abcdef", 3, "abc"},
+		{"abc", 10, "abc"},
+		{"ação", 2, "a"}, // não parte o "ç", que ocupa 2 bytes
+		{"ação", 3, "aç"},
+		{"abc", 0, ""},
+	}
+	for _, tt := range tests {
+		if got := truncateUTF8(tt.s, tt.n); got != tt.want {
+			t.Errorf("truncateUTF8(%q, %d) = %q, esperado %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"Observabilidade/logging"
+	"bytes"
+	"encoding/json"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxCaptureBodyBytes limita o tamanho de cada corpo guardado (requisição e resposta).
+const maxCaptureBodyBytes = 4 << 10
+
+// captureBufferSize é o número de trocas guardadas; as mais antigas são descartadas.
+const captureBufferSize = 100
+
+// sensitiveHeaders são os cabeçalhos cujo valor nunca é guardado, além dos que
+// `logging.Redact` já considera sensíveis pelo nome (chaves, segredos, tokens).
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+// capturedExchange é uma requisição, e a respetiva resposta, guardada para depuração.
+type capturedExchange struct {
+	Time              time.Time         `json:"time"`
+	TraceID           string            `json:"trace_id,omitempty"`
+	Method            string            `json:"method"`
+	Path              string            `json:"path"`
+	RequestHeaders    map[string]string `json:"request_headers"`
+	RequestBody       string            `json:"request_body"`
+	RequestTruncated  bool              `json:"request_truncated,omitempty"`
+	Status            int               `json:"status"`
+	ResponseBody      string            `json:"response_body"`
+	ResponseTruncated bool              `json:"response_truncated,omitempty"`
+}
+
+// captureBuffer guarda as últimas trocas capturadas num buffer circular, para que a
+// memória usada seja limitada independentemente do volume de tráfego.
+type captureBuffer struct {
+	rate float64
+
+	mu    sync.Mutex
+	items []capturedExchange
+	next  int
+}
+
+// newCaptureBuffer cria um buffer que captura a fração `rate` (0 a 1) das requisições.
+func newCaptureBuffer(rate float64) *captureBuffer {
+	return &captureBuffer{rate: rate, items: make([]capturedExchange, 0, captureBufferSize)}
+}
+
+// add guarda uma troca, substituindo a mais antiga quando o buffer está cheio.
+func (b *captureBuffer) add(e capturedExchange) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.items) < captureBufferSize {
+		b.items = append(b.items, e)
+		return
+	}
+	b.items[b.next] = e
+	b.next = (b.next + 1) % captureBufferSize
+}
+
+// snapshot devolve uma cópia das trocas guardadas, da mais recente para a mais antiga.
+func (b *captureBuffer) snapshot() []capturedExchange {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := make([]capturedExchange, 0, len(b.items))
+	for i := len(b.items) - 1; i >= 0; i-- {
+		out = append(out, b.items[(b.next+i)%len(b.items)])
+	}
+	return out
+}
+
+// Middleware captura o corpo da requisição e a resposta de uma fração das requisições.
+// O corpo é lido até ao limite e depois reposto em `r.Body`, para que o handler o leia
+// normalmente. Deve envolver o handler dentro do middleware do OTEL, para incluir o trace ID.
+func (b *captureBuffer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if b.rate <= 0 || rand.Float64() >= b.rate {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Lemos um byte além do limite para saber se o corpo foi truncado.
+		reqBody, _ := io.ReadAll(io.LimitReader(r.Body, maxCaptureBodyBytes+1))
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(reqBody), r.Body), r.Body}
+
+		cw := &captureWriter{ResponseWriter: w}
+		next.ServeHTTP(cw, r)
+
+		exchange := capturedExchange{
+			Time:              time.Now(),
+			Method:            r.Method,
+			Path:              r.URL.Path,
+			RequestHeaders:    redactHeaders(r.Header),
+			RequestBody:       string(reqBody[:min(len(reqBody), maxCaptureBodyBytes)]),
+			RequestTruncated:  len(reqBody) > maxCaptureBodyBytes,
+			Status:            cw.status,
+			ResponseBody:      cw.body.String(),
+			ResponseTruncated: cw.truncated,
+		}
+		if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+			exchange.TraceID = sc.TraceID().String()
+		}
+		b.add(exchange)
+	})
+}
+
+// ServeHTTP expõe as trocas capturadas em JSON (rota de depuração).
+func (b *captureBuffer) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(b.snapshot())
+}
+
+// redactHeaders copia os cabeçalhos, ocultando os valores sensíveis.
+func redactHeaders(h http.Header) map[string]string {
+	out := make(map[string]string, len(h))
+	for key, values := range h {
+		value := strings.Join(values, ", ")
+		if sensitiveHeaders[key] {
+			value = "[REDACTED]"
+		}
+		out[key] = logging.Redact(key, value)
+	}
+	return out
+}
+
+// captureWriter repassa a resposta ao cliente e guarda uma cópia do corpo até ao limite.
+type captureWriter struct {
+	http.ResponseWriter
+	status    int
+	body      bytes.Buffer
+	truncated bool
+}
+
+func (cw *captureWriter) WriteHeader(status int) {
+	if cw.status == 0 {
+		cw.status = status
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *captureWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if room := maxCaptureBodyBytes - cw.body.Len(); room > 0 {
+		cw.body.Write(b[:min(len(b), room)])
+		cw.truncated = cw.truncated || len(b) > room
+	} else if len(b) > 0 {
+		cw.truncated = true
+	}
+	return cw.ResponseWriter.Write(b)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// echoHandler devolve o corpo recebido, para verificar que a captura o repõe intacto.
+var echoHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	w.WriteHeader(http.StatusCreated)
+	w.Write(body)
+})
+
+// captureRequest envia uma requisição com o corpo indicado pelo middleware de captura.
+func captureRequest(b *captureBuffer, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/weather", strings.NewReader(body))
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	rec := httptest.NewRecorder()
+	b.Middleware(echoHandler).ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCaptureSampling(t *testing.T) {
+	for rate, want := range map[float64]int{0: 0, 1: 10} {
+		t.Run(strconv.FormatFloat(rate, 'g', -1, 64), func(t *testing.T) {
+			b := newCaptureBuffer(rate)
+			for i := 0; i < 10; i++ {
+				captureRequest(b, `{"cep":"01001000"}`, nil)
+			}
+			if got := len(b.snapshot()); got != want {
+				t.Errorf("trocas capturadas = %d, esperado %d", got, want)
+			}
+		})
+	}
+}
+
+func TestCaptureKeepsRequestBodyForHandler(t *testing.T) {
+	b := newCaptureBuffer(1)
+	body := strings.Repeat("x", maxCaptureBodyBytes+100)
+	rec := captureRequest(b, body, nil)
+
+	// O handler lê o corpo completo, mesmo para além do limite da captura.
+	if rec.Body.String() != body {
+		t.Fatalf("o handler recebeu %d bytes, esperado %d", rec.Body.Len(), len(body))
+	}
+	got := b.snapshot()[0]
+	if len(got.RequestBody) != maxCaptureBodyBytes || !got.RequestTruncated {
+		t.Errorf("corpo da requisição capturado com %d bytes (truncado: %v), esperado %d truncado",
+			len(got.RequestBody), got.RequestTruncated, maxCaptureBodyBytes)
+	}
+	if len(got.ResponseBody) != maxCaptureBodyBytes || !got.ResponseTruncated {
+		t.Errorf("corpo da resposta capturado com %d bytes (truncado: %v), esperado %d truncado",
+			len(got.ResponseBody), got.ResponseTruncated, maxCaptureBodyBytes)
+	}
+	if got.Status != http.StatusCreated {
+		t.Errorf("status capturado = %d, esperado 201", got.Status)
+	}
+}
+
+func TestCaptureSmallBodyIsNotTruncated(t *testing.T) {
+	b := newCaptureBuffer(1)
+	captureRequest(b, `{"cep":"01001000"}`, nil)
+
+	got := b.snapshot()[0]
+	if got.RequestBody != `{"cep":"01001000"}` || got.RequestTruncated || got.ResponseTruncated {
+		t.Errorf("troca capturada = %+v", got)
+	}
+}
+
+func TestCaptureRedactsSensitiveHeaders(t *testing.T) {
+	b := newCaptureBuffer(1)
+	captureRequest(b, `{}`, map[string]string{
+		"Authorization": "Bearer abc",
+		"Cookie":        "session=1",
+		"X-Api-Key":     "segredo",
+		"Accept":        "application/json",
+	})
+
+	headers := b.snapshot()[0].RequestHeaders
+	for _, key := range []string{"Authorization", "Cookie", "X-Api-Key"} {
+		if headers[key] != "[REDACTED]" {
+			t.Errorf("%s = %q, esperado [REDACTED]", key, headers[key])
+		}
+	}
+	if headers["Accept"] != "application/json" {
+		t.Errorf("Accept = %q, esperado o valor original", headers["Accept"])
+	}
+}
+
+func TestCaptureBufferKeepsMostRecent(t *testing.T) {
+	b := newCaptureBuffer(1)
+	for i := 0; i < captureBufferSize+5; i++ {
+		b.add(capturedExchange{Status: i})
+	}
+
+	got := b.snapshot()
+	if len(got) != captureBufferSize {
+		t.Fatalf("trocas guardadas = %d, esperado %d", len(got), captureBufferSize)
+	}
+	if got[0].Status != captureBufferSize+4 || got[len(got)-1].Status != 5 {
+		t.Errorf("ordem = %d..%d, esperado da mais recente (%d) à mais antiga (5)",
+			got[0].Status, got[len(got)-1].Status, captureBufferSize+4)
+	}
+}
+
+func TestCaptureEndpointServesJSON(t *testing.T) {
+	b := newCaptureBuffer(1)
+	captureRequest(b, `{"cep":"01001000"}`, nil)
+
+	rec := httptest.NewRecorder()
+	b.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/captures", nil))
+	var got []capturedExchange
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("JSON inválido: %v", err)
+	}
+	if len(got) != 1 || got[0].Path != "/weather" {
+		t.Errorf("trocas = %+v", got)
+	}
+}
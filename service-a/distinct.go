@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// defaultDistinctCEPWindow é a janela padrão da contagem de CEPs distintos.
+const defaultDistinctCEPWindow = time.Hour
+
+// hllPrecision é o número de bits do hash que escolhem o registo do sketch: 2^14 registos
+// (16 KiB) dão um erro padrão de cerca de 0,8% (1,04/√m).
+const hllPrecision = 14
+
+// distinctCEPs estima os CEPs distintos servidos na janela atual. A janela pode ser
+// ajustada em `main` (DISTINCT_CEP_WINDOW).
+var distinctCEPs = newDistinctCounter(defaultDistinctCEPWindow)
+
+// distinctCEPsGauge expõe a estimativa de distinctCEPs.
+var distinctCEPsGauge = registerDistinctCEPsGauge()
+
+// distinctCounter conta valores distintos com um sketch HyperLogLog, sem guardar os
+// valores: cada registo guarda apenas o maior número de zeros iniciais visto nos hashes
+// que lhe calharam. A contagem recomeça a cada `window`.
+type distinctCounter struct {
+	window time.Duration
+	now    func() time.Time
+
+	mu        sync.Mutex
+	start     time.Time
+	registers [1 << hllPrecision]uint8
+}
+
+func newDistinctCounter(window time.Duration) *distinctCounter {
+	return &distinctCounter{window: window, now: time.Now}
+}
+
+// add regista um valor na janela atual.
+func (c *distinctCounter) add(value string) {
+	h := hash64(value)
+	index := h >> (64 - hllPrecision)
+	// Posição do primeiro bit a 1 nos bits restantes (o bit de guarda limita-a a 64-p+1).
+	rank := uint8(bits.LeadingZeros64(h<<hllPrecision|1<<(hllPrecision-1)) + 1)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rotate()
+	if rank > c.registers[index] {
+		c.registers[index] = rank
+	}
+}
+
+// estimate devolve a estimativa de valores distintos na janela atual.
+func (c *distinctCounter) estimate() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rotate()
+
+	const m = float64(1 << hllPrecision)
+	sum, zeros := 0.0, 0
+	for _, r := range c.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	// Com poucos valores, a contagem linear dos registos vazios é mais precisa.
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(math.Round(estimate))
+}
+
+// rotate esvazia o sketch quando a janela atual terminou. Deve ser chamado com `mu`.
+func (c *distinctCounter) rotate() {
+	now := c.now()
+	if c.start.IsZero() || now.Sub(c.start) >= c.window {
+		c.start = now
+		clear(c.registers[:])
+	}
+}
+
+// hash64 devolve um hash de 64 bits do valor. O FNV-1a é seguido de uma mistura final
+// (a do SplitMix64), já que o HyperLogLog precisa de bits bem distribuídos e os CEPs
+// diferem apenas em poucos caracteres.
+func hash64(value string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(value))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// registerDistinctCEPsGauge cria o gauge `ceps.distinct_estimate`, com a estimativa de CEPs
+// distintos pedidos na janela atual.
+func registerDistinctCEPsGauge() metric.Registration {
+	meter := otel.Meter("service-a")
+	gauge, err := meter.Int64ObservableGauge(
+		"ceps.distinct_estimate",
+		metric.WithDescription("Estimativa (HyperLogLog) dos CEPs distintos pedidos na janela atual."),
+		metric.WithUnit("{cep}"),
+	)
+	if err != nil {
+		otel.Handle(err)
+		return nil
+	}
+	reg, err := meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		o.ObserveInt64(gauge, int64(distinctCEPs.estimate()))
+		return nil
+	}, gauge)
+	if err != nil {
+		otel.Handle(err)
+	}
+	return reg
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// cep devolve o i-ésimo CEP de teste.
+func cep(i int) string {
+	return fmt.Sprintf("%08d", i)
+}
+
+func TestDistinctCounterEstimateWithinErrorBounds(t *testing.T) {
+	for _, n := range []int{0, 1, 100, 1_000, 10_000, 100_000} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			c := newDistinctCounter(time.Hour)
+			for i := 0; i < n; i++ {
+				c.add(cep(i))
+				c.add(cep(i)) // os repetidos não contam
+			}
+			got := c.estimate()
+			// O erro padrão com 2^14 registos é de cerca de 0,8%; 3% dá uma margem folgada.
+			if diff := math.Abs(float64(got) - float64(n)); diff > 0.03*float64(n) {
+				t.Errorf("estimativa = %d para %d CEPs distintos (erro de %.1f%%)", got, n, 100*diff/float64(n))
+			}
+		})
+	}
+}
+
+func TestDistinctCounterResetsEachWindow(t *testing.T) {
+	clock := time.Unix(1_700_000_000, 0)
+	c := newDistinctCounter(time.Hour)
+	c.now = func() time.Time { return clock }
+
+	for i := 0; i < 500; i++ {
+		c.add(cep(i))
+	}
+	clock = clock.Add(59 * time.Minute)
+	if got := c.estimate(); got < 485 || got > 515 {
+		t.Fatalf("estimativa = %d dentro da janela, esperado cerca de 500", got)
+	}
+
+	clock = clock.Add(time.Minute)
+	if got := c.estimate(); got != 0 {
+		t.Fatalf("estimativa = %d no início de uma nova janela, esperado 0", got)
+	}
+	for i := 0; i < 10; i++ {
+		c.add(cep(i))
+	}
+	if got := c.estimate(); got != 10 {
+		t.Errorf("estimativa = %d na nova janela, esperado 10", got)
+	}
+}
+
+func TestDistinctCEPsGauge(t *testing.T) {
+	reader := testMetricReader()
+	previous := distinctCEPs
+	distinctCEPs = newDistinctCounter(time.Hour)
+	t.Cleanup(func() { distinctCEPs = previous })
+	stubServiceB(t, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte(`{"city":"São Paulo"}`))
+	}))
+
+	for _, value := range []string{"01001000", "01001000", "20040020", "123"} {
+		postWeather(t, value, nil)
+	}
+
+	data, ok := findMetric(t, reader, "ceps.distinct_estimate")
+	if !ok {
+		t.Fatal("gauge ceps.distinct_estimate não encontrado")
+	}
+	// O CEP inválido não conta; o repetido conta uma vez.
+	if points := data.(metricdata.Gauge[int64]).DataPoints; len(points) != 1 || points[0].Value != 2 {
+		t.Errorf("ceps.distinct_estimate = %v, esperado 2", points)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"Observabilidade/signing"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultHealthCEP é o CEP conhecido (Praça da Sé, São Paulo) usado na verificação profunda.
+const defaultHealthCEP = "01001000"
+
+// deepHealthTimeout é o prazo da requisição sintética da verificação profunda.
+const deepHealthTimeout = 3 * time.Second
+
+// deepHealthCacheTTL é o tempo durante o qual o resultado da verificação profunda é
+// reaproveitado, para que chamadas repetidas não sobrecarreguem o Serviço B e as APIs externas.
+const deepHealthCacheTTL = 10 * time.Second
+
+// healthStatus é o corpo da resposta de /healthz.
+type healthStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// healthChecker responde a GET /healthz. Por omissão a verificação é superficial (o
+// processo responde); com `?deep=true` faz uma requisição real ao Serviço B para um CEP
+// conhecido. A verificação profunda só existe quando ativada, e o seu resultado é
+// reaproveitado durante `deepHealthCacheTTL`.
+type healthChecker struct {
+	deepEnabled bool
+	cep         string
+	client      *http.Client
+
+	mu        sync.Mutex
+	lastCheck time.Time
+	lastErr   error
+}
+
+// newHealthChecker cria o verificador de saúde. O cliente HTTP não é instrumentado, para
+// que as requisições sintéticas não se misturem com as métricas do tráfego normal.
+func newHealthChecker(deepEnabled bool, cep string) *healthChecker {
+	return &healthChecker{
+		deepEnabled: deepEnabled,
+		cep:         cep,
+		client:      &http.Client{Timeout: deepHealthTimeout},
+	}
+}
+
+func (h *healthChecker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	deep, _ := strconv.ParseBool(r.URL.Query().Get("deep"))
+	if !deep {
+		json.NewEncoder(w).Encode(healthStatus{Status: "ok"})
+		return
+	}
+	if !h.deepEnabled {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(healthStatus{Status: "unknown", Error: "deep health check disabled"})
+		return
+	}
+
+	if err := h.deepCheck(r.Context()); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(healthStatus{Status: "degraded", Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(healthStatus{Status: "ok"})
+}
+
+// deepCheck devolve o resultado da última verificação profunda, se ainda for recente,
+// ou executa uma nova. O mutex garante uma única verificação de cada vez.
+func (h *healthChecker) deepCheck(ctx context.Context) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if time.Since(h.lastCheck) < deepHealthCacheTTL {
+		return h.lastErr
+	}
+	h.lastErr = h.checkServiceB(ctx)
+	h.lastCheck = time.Now()
+	return h.lastErr
+}
+
+// checkServiceB pede ao Serviço B o clima do CEP conhecido e valida a resposta.
+func (h *healthChecker) checkServiceB(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, deepHealthTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/weather/%s", serviceBURL, h.cep), nil)
+	if err != nil {
+		return err
+	}
+	if len(serviceBSecret) > 0 {
+		signing.Sign(req, serviceBSecret)
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("serviço B indisponível: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("serviço B respondeu %d", resp.StatusCode)
+	}
+	var body struct {
+		City string `json:"city"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("resposta inválida do serviço B: %w", err)
+	}
+	if body.City == "" {
+		return errors.New("resposta do serviço B sem cidade")
+	}
+	return nil
+}
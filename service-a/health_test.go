@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// getHealth envia GET /healthz com a query indicada e devolve o status e o corpo.
+func getHealth(t *testing.T, h *healthChecker, query string) (int, healthStatus) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz"+query, nil))
+	var status healthStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("JSON inválido: %v: %s", err, rec.Body)
+	}
+	return rec.Code, status
+}
+
+func TestHealthShallowDoesNotCallServiceB(t *testing.T) {
+	var calls atomic.Int32
+	stubServiceB(t, http.HandlerFunc(func(http.ResponseWriter, *http.Request) { calls.Add(1) }))
+
+	code, status := getHealth(t, newHealthChecker(true, defaultHealthCEP), "")
+	if code != http.StatusOK || status.Status != "ok" {
+		t.Errorf("resposta = %d %+v, esperado 200 ok", code, status)
+	}
+	if calls.Load() != 0 {
+		t.Errorf("a verificação superficial não deveria chamar o Serviço B")
+	}
+}
+
+func TestHealthDeepDisabled(t *testing.T) {
+	code, status := getHealth(t, newHealthChecker(false, defaultHealthCEP), "?deep=true")
+	if code != http.StatusForbidden || status.Status != "unknown" {
+		t.Errorf("resposta = %d %+v, esperado 403 unknown", code, status)
+	}
+}
+
+func TestHealthDeepHealthyFlow(t *testing.T) {
+	var path string
+	stubServiceB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Write([]byte(`{"city":"São Paulo","temp_C":25}`))
+	}))
+
+	code, status := getHealth(t, newHealthChecker(true, defaultHealthCEP), "?deep=true")
+	if code != http.StatusOK || status.Status != "ok" {
+		t.Errorf("resposta = %d %+v, esperado 200 ok", code, status)
+	}
+	if path != "/weather/"+defaultHealthCEP {
+		t.Errorf("caminho pedido ao Serviço B = %q", path)
+	}
+}
+
+func TestHealthDeepBrokenFlow(t *testing.T) {
+	tests := map[string]http.HandlerFunc{
+		"status de erro": func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusBadGateway) },
+		"JSON inválido":  func(w http.ResponseWriter, _ *http.Request) { w.Write([]byte("<html>")) },
+		"sem cidade":     func(w http.ResponseWriter, _ *http.Request) { w.Write([]byte(`{"temp_C":25}`)) },
+	}
+	for name, handler := range tests {
+		t.Run(name, func(t *testing.T) {
+			stubServiceB(t, handler)
+
+			code, status := getHealth(t, newHealthChecker(true, defaultHealthCEP), "?deep=true")
+			if code != http.StatusServiceUnavailable || status.Status != "degraded" || status.Error == "" {
+				t.Errorf("resposta = %d %+v, esperado 503 degraded com o erro", code, status)
+			}
+		})
+	}
+}
+
+func TestHealthDeepServiceBDown(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	previous := serviceBURL
+	serviceBURL = srv.URL
+	t.Cleanup(func() { serviceBURL = previous })
+
+	code, status := getHealth(t, newHealthChecker(true, defaultHealthCEP), "?deep=true")
+	if code != http.StatusServiceUnavailable || !strings.Contains(status.Error, "indisponível") {
+		t.Errorf("resposta = %d %+v, esperado 503 com o serviço indisponível", code, status)
+	}
+}
+
+func TestHealthDeepResultIsCached(t *testing.T) {
+	var calls atomic.Int32
+	stubServiceB(t, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		w.Write([]byte(`{"city":"São Paulo"}`))
+	}))
+
+	h := newHealthChecker(true, defaultHealthCEP)
+	for i := 0; i < 3; i++ {
+		getHealth(t, h, "?deep=true")
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("chamadas ao Serviço B = %d, esperado 1 dentro de deepHealthCacheTTL", got)
+	}
+}
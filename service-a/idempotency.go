@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// idempotencyHeader é o cabeçalho com a chave de idempotência enviada pelo cliente.
+// idempotencyReplayHeader marca as respostas reaproveitadas de uma requisição anterior.
+const (
+	idempotencyHeader       = "Idempotency-Key"
+	idempotencyReplayHeader = "Idempotent-Replayed"
+)
+
+// maxIdempotencyKeyLength limita o tamanho da chave aceite no cabeçalho.
+const maxIdempotencyKeyLength = 255
+
+// defaultIdempotencyTTL é o tempo durante o qual uma resposta fica disponível para repetição.
+const defaultIdempotencyTTL = 5 * time.Minute
+
+// storedResponse é uma resposta já enviada ao cliente, guardada para ser repetida.
+type storedResponse struct {
+	cep    string
+	status int
+	header http.Header
+	body   []byte
+}
+
+// idempotencyEntry representa uma chave em processamento ou já concluída. O canal `done`
+// é fechado quando a primeira requisição termina; `resp` fica nil se a resposta não puder
+// ser reaproveitada (ex: erro 5xx), caso em que a próxima requisição volta a executar.
+type idempotencyEntry struct {
+	done      chan struct{}
+	resp      *storedResponse
+	expiresAt time.Time
+}
+
+// idempotencyStore é uma cache em memória, com TTL, das respostas por chave de idempotência.
+// Requisições concorrentes com a mesma chave esperam pela primeira (à semelhança do
+// singleflight), em vez de chamarem o Serviço B em paralelo.
+type idempotencyStore struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	entries   map[string]*idempotencyEntry
+	lastSweep time.Time
+}
+
+// newIdempotencyStore cria uma cache vazia com o TTL indicado.
+func newIdempotencyStore(ttl time.Duration) *idempotencyStore {
+	return &idempotencyStore{ttl: ttl, entries: make(map[string]*idempotencyEntry), lastSweep: time.Now()}
+}
+
+// acquire devolve a entrada da chave e indica se o chamador é o responsável por a executar.
+// Entradas expiradas são removidas de forma preguiçosa, no máximo uma vez por TTL.
+func (s *idempotencyStore) acquire(key string) (*idempotencyEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) > s.ttl {
+		for k, e := range s.entries {
+			if !e.expiresAt.IsZero() && now.After(e.expiresAt) {
+				delete(s.entries, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	if e, ok := s.entries[key]; ok && (e.expiresAt.IsZero() || now.Before(e.expiresAt)) {
+		return e, false
+	}
+	e := &idempotencyEntry{done: make(chan struct{})}
+	s.entries[key] = e
+	return e, true
+}
+
+// complete guarda a resposta da primeira requisição e liberta as que estavam à espera.
+// Respostas 5xx não são guardadas, para que um novo envio da mesma chave possa ter sucesso.
+func (s *idempotencyStore) complete(key string, e *idempotencyEntry, resp *storedResponse) {
+	s.mu.Lock()
+	if resp != nil && resp.status < http.StatusInternalServerError {
+		e.resp = resp
+		e.expiresAt = time.Now().Add(s.ttl)
+	} else if s.entries[key] == e {
+		delete(s.entries, key)
+	}
+	s.mu.Unlock()
+	close(e.done)
+}
+
+// withIdempotency executa `handle` no máximo uma vez por chave dentro da janela do TTL.
+// Sem chave, executa sempre. Com uma chave já conhecida, repete a resposta guardada
+// (ou espera que a requisição em curso termine). Devolve sem escrever nada se o
+// contexto for cancelado durante a espera.
+func (s *idempotencyStore) withIdempotency(ctx context.Context, w http.ResponseWriter, key, cep string, handle func(http.ResponseWriter)) {
+	span := trace.SpanFromContext(ctx)
+	if key == "" || len(key) > maxIdempotencyKeyLength {
+		handle(w)
+		return
+	}
+
+	waited := false
+	for {
+		entry, leader := s.acquire(key)
+		if leader {
+			span.SetAttributes(attribute.Bool("idempotency.hit", false))
+			rec := &responseRecorder{ResponseWriter: w}
+			inflightGroups.Add(ctx, 1)
+			defer func() {
+				s.complete(key, entry, rec.stored(cep))
+				inflightGroups.Add(context.WithoutCancel(ctx), -1)
+			}()
+			handle(rec)
+			return
+		}
+
+		// Uma chave ainda em execução significa que esta requisição se junta à que está em curso.
+		select {
+		case <-entry.done:
+		default:
+			if !waited {
+				recordCoalesced(ctx)
+			}
+		}
+		waited = true
+		select {
+		case <-entry.done:
+		case <-ctx.Done():
+			return
+		}
+		if entry.resp == nil {
+			// A requisição anterior não produziu uma resposta reaproveitável: tentamos de novo.
+			continue
+		}
+
+		span.SetAttributes(
+			attribute.Bool("idempotency.hit", true),
+			attribute.Bool("idempotency.waited", waited),
+		)
+		// A mesma chave com um CEP diferente indica um erro do cliente, não uma repetição.
+		if entry.resp.cep != cep {
+			http.Error(w, "idempotency key reused with a different request", http.StatusUnprocessableEntity)
+			return
+		}
+		entry.resp.replay(w)
+		return
+	}
+}
+
+// replay escreve novamente a resposta guardada, marcando-a como repetida. Os cabeçalhos
+// guardados substituem os já definidos, já que incluem os que os middlewares exteriores
+// voltam a definir na repetição (ex: `X-Trace-Sampled`).
+func (r *storedResponse) replay(w http.ResponseWriter) {
+	for key, values := range r.header {
+		w.Header().Del(key)
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	w.Header().Set(idempotencyReplayHeader, "true")
+	w.WriteHeader(r.status)
+	w.Write(r.body)
+}
+
+// responseRecorder repassa a resposta ao cliente e, em simultâneo, guarda uma cópia
+// do status e do corpo para a cache de idempotência.
+type responseRecorder struct {
+	http.ResponseWriter
+	status    int
+	body      bytes.Buffer
+	discarded bool
+}
+
+// discard impede que a resposta seja guardada (ex: quando o corpo do Serviço B chegou
+// truncado); o cliente atual recebe o que já foi escrito, mas as repetições voltam a
+// chamar o Serviço B.
+func (rec *responseRecorder) discard() {
+	rec.discarded = true
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// stored devolve a resposta capturada, ou nil se nada chegou a ser escrito ou se a
+// resposta foi descartada.
+func (rec *responseRecorder) stored(cep string) *storedResponse {
+	if rec.status == 0 || rec.discarded {
+		return nil
+	}
+	return &storedResponse{
+		cep:    cep,
+		status: rec.status,
+		header: rec.Header().Clone(),
+		body:   bytes.Clone(rec.body.Bytes()),
+	}
+}
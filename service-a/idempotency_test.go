@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingHandler responde com o status indicado e conta as execuções.
+func countingHandler(calls *atomic.Int32, status int) func(http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"city":"São Paulo"}`))
+	}
+}
+
+func TestIdempotencyWithoutKeyAlwaysRuns(t *testing.T) {
+	store := newIdempotencyStore(time.Minute)
+	var calls atomic.Int32
+	for i := 0; i < 3; i++ {
+		store.withIdempotency(context.Background(), httptest.NewRecorder(), "", "01001000", countingHandler(&calls, http.StatusOK))
+	}
+	if calls.Load() != 3 {
+		t.Fatalf("handler executado %d vezes, esperado 3", calls.Load())
+	}
+}
+
+func TestIdempotencyReplaysStoredResponse(t *testing.T) {
+	store := newIdempotencyStore(time.Minute)
+	var calls atomic.Int32
+
+	first := httptest.NewRecorder()
+	store.withIdempotency(context.Background(), first, "key-1", "01001000", countingHandler(&calls, http.StatusOK))
+	second := httptest.NewRecorder()
+	store.withIdempotency(context.Background(), second, "key-1", "01001000", countingHandler(&calls, http.StatusOK))
+
+	if calls.Load() != 1 {
+		t.Fatalf("handler executado %d vezes, esperado 1", calls.Load())
+	}
+	if second.Code != http.StatusOK || second.Body.String() != first.Body.String() {
+		t.Fatalf("repetição = %d %q, original = %d %q", second.Code, second.Body, first.Code, first.Body)
+	}
+	if second.Header().Get(idempotencyReplayHeader) != "true" {
+		t.Fatalf("a repetição não tem o cabeçalho %s", idempotencyReplayHeader)
+	}
+	if first.Header().Get(idempotencyReplayHeader) != "" {
+		t.Fatalf("a resposta original não deve ser marcada como repetida")
+	}
+}
+
+func TestIdempotencyReplayDoesNotDuplicateHeaders(t *testing.T) {
+	store := newIdempotencyStore(time.Minute)
+	var calls atomic.Int32
+
+	// Um middleware exterior (ex: X-Trace-Sampled) define o cabeçalho em cada requisição,
+	// antes de a resposta guardada ser repetida.
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		rec.Header().Set("X-Trace-Sampled", "true")
+		store.withIdempotency(context.Background(), rec, "key-1", "01001000", countingHandler(&calls, http.StatusOK))
+		if got := rec.Header().Values("X-Trace-Sampled"); len(got) != 1 {
+			t.Fatalf("requisição %d: X-Trace-Sampled = %v, esperado um único valor", i, got)
+		}
+		if got := rec.Header().Values("Content-Type"); len(got) != 1 {
+			t.Fatalf("requisição %d: Content-Type = %v, esperado um único valor", i, got)
+		}
+	}
+}
+
+func TestIdempotencyKeyReusedWithDifferentCEP(t *testing.T) {
+	store := newIdempotencyStore(time.Minute)
+	var calls atomic.Int32
+	store.withIdempotency(context.Background(), httptest.NewRecorder(), "key-1", "01001000", countingHandler(&calls, http.StatusOK))
+
+	rec := httptest.NewRecorder()
+	store.withIdempotency(context.Background(), rec, "key-1", "22021001", countingHandler(&calls, http.StatusOK))
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, esperado %d", rec.Code, http.StatusUnprocessableEntity)
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("handler executado %d vezes, esperado 1", calls.Load())
+	}
+}
+
+func TestIdempotencyDoesNotStoreServerErrors(t *testing.T) {
+	store := newIdempotencyStore(time.Minute)
+	var calls atomic.Int32
+	store.withIdempotency(context.Background(), httptest.NewRecorder(), "key-1", "01001000", countingHandler(&calls, http.StatusBadGateway))
+
+	rec := httptest.NewRecorder()
+	store.withIdempotency(context.Background(), rec, "key-1", "01001000", countingHandler(&calls, http.StatusOK))
+	if calls.Load() != 2 {
+		t.Fatalf("handler executado %d vezes; um 5xx não deve ser repetido", calls.Load())
+	}
+	if rec.Code != http.StatusOK || rec.Header().Get(idempotencyReplayHeader) != "" {
+		t.Fatalf("segunda requisição = %d (repetida: %q)", rec.Code, rec.Header().Get(idempotencyReplayHeader))
+	}
+}
+
+func TestIdempotencyDiscardedResponseIsNotStored(t *testing.T) {
+	store := newIdempotencyStore(time.Minute)
+	var calls atomic.Int32
+	store.withIdempotency(context.Background(), httptest.NewRecorder(), "key-1", "01001000", func(w http.ResponseWriter) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusOK)
+		w.(interface{ discard() }).discard()
+	})
+	store.withIdempotency(context.Background(), httptest.NewRecorder(), "key-1", "01001000", countingHandler(&calls, http.StatusOK))
+	if calls.Load() != 2 {
+		t.Fatalf("handler executado %d vezes; uma resposta descartada não deve ser repetida", calls.Load())
+	}
+}
+
+func TestIdempotencyEntryExpires(t *testing.T) {
+	store := newIdempotencyStore(10 * time.Millisecond)
+	var calls atomic.Int32
+	store.withIdempotency(context.Background(), httptest.NewRecorder(), "key-1", "01001000", countingHandler(&calls, http.StatusOK))
+	time.Sleep(20 * time.Millisecond)
+	store.withIdempotency(context.Background(), httptest.NewRecorder(), "key-1", "01001000", countingHandler(&calls, http.StatusOK))
+	if calls.Load() != 2 {
+		t.Fatalf("handler executado %d vezes; a entrada devia ter expirado", calls.Load())
+	}
+}
+
+func TestIdempotencyOversizedKeyIsIgnored(t *testing.T) {
+	store := newIdempotencyStore(time.Minute)
+	var calls atomic.Int32
+	key := string(make([]byte, maxIdempotencyKeyLength+1))
+	for i := 0; i < 2; i++ {
+		store.withIdempotency(context.Background(), httptest.NewRecorder(), key, "01001000", countingHandler(&calls, http.StatusOK))
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("handler executado %d vezes, esperado 2", calls.Load())
+	}
+}
+
+func TestIdempotencyConcurrentRequestsWaitForFirst(t *testing.T) {
+	store := newIdempotencyStore(time.Minute)
+	var calls atomic.Int32
+	release := make(chan struct{})
+	handle := func(w http.ResponseWriter) {
+		calls.Add(1)
+		<-release
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	}
+
+	const n = 5
+	recs := make([]*httptest.ResponseRecorder, n)
+	var wg sync.WaitGroup
+	for i := range recs {
+		recs[i] = httptest.NewRecorder()
+		wg.Add(1)
+		go func(rec *httptest.ResponseRecorder) {
+			defer wg.Done()
+			store.withIdempotency(context.Background(), rec, "key-1", "01001000", handle)
+		}(recs[i])
+	}
+	// Damos tempo a todas as requisições para chegarem antes de a primeira terminar.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Fatalf("handler executado %d vezes em requisições concorrentes, esperado 1", calls.Load())
+	}
+	for i, rec := range recs {
+		if rec.Code != http.StatusOK || rec.Body.String() != "ok" {
+			t.Fatalf("requisição %d: %d %q", i, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestIdempotencyWaiterGivesUpOnCancel(t *testing.T) {
+	store := newIdempotencyStore(time.Minute)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		store.withIdempotency(context.Background(), httptest.NewRecorder(), "key-1", "01001000", func(w http.ResponseWriter) {
+			close(started)
+			<-release
+		})
+	}()
+	// A requisição em curso termina antes do fim do teste, para não afetar as métricas dos seguintes.
+	defer func() {
+		close(release)
+		<-finished
+	}()
+	<-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec := httptest.NewRecorder()
+	store.withIdempotency(ctx, rec, "key-1", "01001000", func(http.ResponseWriter) {
+		t.Error("o handler não devia ser executado por quem espera")
+	})
+	if rec.Body.Len() != 0 || len(rec.Header()) != 0 {
+		t.Fatalf("nada devia ser escrito após o cancelamento: %v %q", rec.Header(), rec.Body)
+	}
+}
+
+func TestIdempotencyCoalescingMetrics(t *testing.T) {
+	coalescedBefore := int64SumTotal(t, "requests.coalesced")
+	inflightBefore := int64SumTotal(t, "inflight.singleflight_groups")
+	store := newIdempotencyStore(time.Minute)
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	const n = 5
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		store.withIdempotency(context.Background(), httptest.NewRecorder(), "key-1", "01001000", func(w http.ResponseWriter) {
+			close(started)
+			<-release
+			w.WriteHeader(http.StatusOK)
+		})
+	}()
+	<-started
+	for i := 1; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			store.withIdempotency(context.Background(), httptest.NewRecorder(), "key-1", "01001000", func(http.ResponseWriter) {})
+		}()
+	}
+
+	// Cada requisição que se junta à que está em curso conta uma vez em requests.coalesced.
+	deadline := time.Now().Add(5 * time.Second)
+	for int64SumTotal(t, "requests.coalesced")-coalescedBefore < n-1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("requests.coalesced aumentou %d, esperado %d", int64SumTotal(t, "requests.coalesced")-coalescedBefore, n-1)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := int64SumTotal(t, "inflight.singleflight_groups") - inflightBefore; got != 1 {
+		t.Errorf("inflight.singleflight_groups = +%d durante a execução, esperado +1", got)
+	}
+
+	close(release)
+	wg.Wait()
+	if got := int64SumTotal(t, "requests.coalesced") - coalescedBefore; got != n-1 {
+		t.Errorf("requests.coalesced aumentou %d, esperado %d", got, n-1)
+	}
+	if got := int64SumTotal(t, "inflight.singleflight_groups") - inflightBefore; got != 0 {
+		t.Errorf("inflight.singleflight_groups = %+d depois de terminar, esperado 0", got)
+	}
+}
+
+func TestIdempotencyReplayIsNotCoalesced(t *testing.T) {
+	store := newIdempotencyStore(time.Minute)
+	store.withIdempotency(context.Background(), httptest.NewRecorder(), "key-1", "01001000", func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	// Repetir uma resposta já guardada não é coalescência: não havia chamada em curso.
+	before := int64SumTotal(t, "requests.coalesced")
+	store.withIdempotency(context.Background(), httptest.NewRecorder(), "key-1", "01001000", func(http.ResponseWriter) {})
+	if got := int64SumTotal(t, "requests.coalesced") - before; got != 0 {
+		t.Errorf("requests.coalesced aumentou %d numa repetição, esperado 0", got)
+	}
+}
@@ -1,21 +1,82 @@
 package main
 
 import (
+	"Observabilidade/lifecycle"
+	"Observabilidade/logging"
 	"Observabilidade/tracer"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"maps"
+	"net"
 	"net/http"
 	"os"
 	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/contrib/instrumentation/runtime"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// incidentHeader é o cabeçalho opcional com o ID do incidente em investigação.
+// incidentKey é a chave usada tanto no atributo do span como no baggage propagado.
+const (
+	incidentHeader = "X-Incident-ID"
+	incidentKey    = "incident.id"
+)
+
+// sentAtHeader é o cabeçalho com a hora (Unix, em milissegundos) do envio ao Serviço B.
+const sentAtHeader = "X-Sent-At"
+
+// cepBaggageKey é a chave do baggage com o CEP consultado, propagado ao Serviço B como
+// chave de correlação independente da URL.
+const cepBaggageKey = "cep"
+
+// maxIncidentIDLength limita o tamanho do ID de incidente aceite no cabeçalho.
+const maxIncidentIDLength = 64
+
+// shutdownHooksTimeout é o prazo partilhado pelos hooks de encerramento.
+const shutdownHooksTimeout = 5 * time.Second
+
+// defaultDownstreamTimeout é o prazo padrão da chamada ao Serviço B.
+const defaultDownstreamTimeout = 5 * time.Second
+
+// downstreamTimeout é o prazo da chamada ao Serviço B, incluindo a leitura da resposta.
+// É preenchido em `main` a partir de DOWNSTREAM_TIMEOUT.
+var downstreamTimeout = defaultDownstreamTimeout
+
+// serviceBURL é o endereço base do Serviço B. Por omissão, "service-b" é o nome do
+// container no docker-compose; pode ser alterado com SERVICE_B_URL.
+var serviceBURL = "http://service-b:8081"
+
+// defaultPassthroughHeaders são os cabeçalhos da resposta do Serviço B repassados ao
+// cliente quando PASSTHROUGH_HEADERS não está definida.
+const defaultPassthroughHeaders = "Content-Type,Content-Length,X-Request-Id,Traceparent,Tracestate"
+
+// passthroughHeaders é o conjunto, em forma canónica, dos cabeçalhos repassados ao cliente.
+var passthroughHeaders = parseHeaderList(defaultPassthroughHeaders)
+
+// serviceBSecret é o segredo partilhado com que as chamadas ao Serviço B são assinadas.
+// Vazio (padrão) desativa a assinatura. É preenchido em `main` a partir de SERVICE_B_SHARED_SECRET.
+var serviceBSecret []byte
+
+// idempotency guarda as respostas por chave de idempotência. O TTL pode ser ajustado em `main`.
+var idempotency = newIdempotencyStore(defaultIdempotencyTTL)
+
 // CEPRequest define a estrutura do JSON que esperamos receber no corpo da requisição.
 type CEPRequest struct {
 	CEP string `json:"cep"`
@@ -30,6 +91,135 @@ func main() {
 		collectorURL = "localhost:4317" // Fallback para execuções locais fora do Docker.
 	}
 
+	// Janela durante a qual uma resposta pode ser repetida para a mesma chave de idempotência.
+	idempotencyTTL, err := durationFromEnv("IDEMPOTENCY_TTL", defaultIdempotencyTTL)
+	if err != nil {
+		log.Fatalf("configuração inválida: %v", err)
+	}
+	idempotency = newIdempotencyStore(idempotencyTTL)
+
+	// Janela da estimativa de CEPs distintos (gauge `ceps.distinct_estimate`).
+	distinctCEPWindow, err := durationFromEnv("DISTINCT_CEP_WINDOW", defaultDistinctCEPWindow)
+	if err != nil || distinctCEPWindow <= 0 {
+		log.Fatalf("configuração inválida: DISTINCT_CEP_WINDOW deve ser uma duração positiva")
+	}
+	distinctCEPs = newDistinctCounter(distinctCEPWindow)
+
+	// Por omissão aceitamos o contexto de trace recebido. Como o Serviço A é a porta de
+	// entrada pública, TRUST_INCOMING_TRACE=false permite ignorá-lo e evitar trace IDs forjados.
+	trustIncomingTrace, err := boolFromEnv("TRUST_INCOMING_TRACE", true)
+	if err != nil {
+		log.Fatalf("configuração inválida: %v", err)
+	}
+
+	// Idade máxima do contexto de trace recebido, validada pelo carimbo que o próprio
+	// Serviço A coloca no `tracestate` (ver tracer.TraceAgePropagators). Desativada por omissão.
+	if traceContextMaxAge, err = durationFromEnv("TRACE_CONTEXT_MAX_AGE", 0); err != nil {
+		log.Fatalf("configuração inválida: %v", err)
+	}
+
+	// Prazo da chamada ao Serviço B; esgotado, o cliente recebe 504 em vez de ficar à espera.
+	if downstreamTimeout, err = durationFromEnv("DOWNSTREAM_TIMEOUT", defaultDownstreamTimeout); err != nil {
+		log.Fatalf("configuração inválida: %v", err)
+	}
+
+	// Novas tentativas da chamada ao Serviço B após falhas de ligação ou respostas 5xx,
+	// dentro do mesmo prazo DOWNSTREAM_TIMEOUT.
+	if serviceBRetries, err = intFromEnv("SERVICE_B_RETRIES", defaultServiceBRetries); err != nil || serviceBRetries < 0 {
+		log.Fatalf("configuração inválida: SERVICE_B_RETRIES deve ser um inteiro não negativo")
+	}
+
+	// Captura, para depuração, do corpo da requisição e da resposta de uma fração
+	// (CAPTURE_SAMPLE_RATE, entre 0 e 1) das requisições. Desativada por omissão.
+	captureRate, err := floatFromEnv("CAPTURE_SAMPLE_RATE", 0)
+	if err != nil || captureRate < 0 || captureRate > 1 {
+		log.Fatalf("configuração inválida: CAPTURE_SAMPLE_RATE deve ser um número entre 0 e 1")
+	}
+	captures := newCaptureBuffer(captureRate)
+
+	// Limite de requisições por segundo para cada IP de cliente (0 desativa o limite).
+	perIPRate, err := floatFromEnv("PER_IP_RATE_LIMIT", 0)
+	if err != nil || perIPRate < 0 {
+		log.Fatalf("configuração inválida: PER_IP_RATE_LIMIT deve ser um número não negativo")
+	}
+	limiter := newIPRateLimiter(perIPRate)
+
+	// Limites do baggage propagado ao Serviço B (por omissão, os recomendados pelo W3C).
+	if baggageMaxBytes, err = intFromEnv("BAGGAGE_MAX_BYTES", defaultBaggageMaxBytes); err != nil || baggageMaxBytes <= 0 {
+		log.Fatalf("configuração inválida: BAGGAGE_MAX_BYTES deve ser um inteiro positivo")
+	}
+	if baggageMaxItemBytes, err = intFromEnv("BAGGAGE_MAX_ITEM_BYTES", defaultBaggageMaxItemBytes); err != nil || baggageMaxItemBytes <= 0 {
+		log.Fatalf("configuração inválida: BAGGAGE_MAX_ITEM_BYTES deve ser um inteiro positivo")
+	}
+
+	if value := os.Getenv("SERVICE_B_URL"); value != "" {
+		serviceBURL = strings.TrimRight(value, "/")
+	}
+
+	// Com SERVICE_B_SHARED_SECRET, as chamadas ao Serviço B levam uma assinatura HMAC.
+	serviceBSecret = []byte(os.Getenv("SERVICE_B_SHARED_SECRET"))
+
+	// Cabeçalhos da resposta do Serviço B que podem chegar ao cliente.
+	if value := os.Getenv("PASSTHROUGH_HEADERS"); value != "" {
+		passthroughHeaders = parseHeaderList(value)
+	}
+
+	// A verificação de saúde profunda (GET /healthz?deep=true) faz uma requisição real ao
+	// Serviço B e, por isso, só fica disponível com HEALTHZ_DEEP_ENABLED=true.
+	deepHealth, err := boolFromEnv("HEALTHZ_DEEP_ENABLED", false)
+	if err != nil {
+		log.Fatalf("configuração inválida: %v", err)
+	}
+	healthCEP := os.Getenv("HEALTHZ_DEEP_CEP")
+	if healthCEP == "" {
+		healthCEP = defaultHealthCEP
+	}
+	if !isValidCEP(healthCEP) {
+		log.Fatalf("configuração inválida: HEALTHZ_DEEP_CEP deve ter 8 dígitos: %q", healthCEP)
+	}
+
+	// As rotas de depuração só são expostas com ENABLE_DEBUG_ENDPOINTS=true.
+	debugEndpoints, err := boolFromEnv("ENABLE_DEBUG_ENDPOINTS", false)
+	if err != nil {
+		log.Fatalf("configuração inválida: %v", err)
+	}
+
+	// Porta de escuta: SERVICE_A_PORT ou PORT (por omissão, 8080).
+	port, err := portFromEnv("SERVICE_A_PORT", "PORT", "8080")
+	if err != nil {
+		log.Fatalf("configuração inválida: %v", err)
+	}
+
+	// Registo de acesso apenas das requisições lentas (SLOW_REQUEST_LOG_MS, desativado por omissão).
+	slowRequestThreshold, err := logging.SlowRequestThresholdFromEnv()
+	if err != nil {
+		log.Fatalf("configuração inválida: %v", err)
+	}
+	logging.SetSlowRequestThreshold(slowRequestThreshold)
+
+	// Registamos a configuração efetiva com que o serviço arrancou, para análise posterior.
+	logging.LogEffectiveConfig("service-a", map[string]string{
+		"OTEL_EXPORTER_OTLP_ENDPOINT": collectorURL,
+		"IDEMPOTENCY_TTL":             idempotencyTTL.String(),
+		"DISTINCT_CEP_WINDOW":         distinctCEPWindow.String(),
+		"TRUST_INCOMING_TRACE":        strconv.FormatBool(trustIncomingTrace),
+		"TRACE_CONTEXT_MAX_AGE":       traceContextMaxAge.String(),
+		"DOWNSTREAM_TIMEOUT":          downstreamTimeout.String(),
+		"SERVICE_B_RETRIES":           strconv.Itoa(serviceBRetries),
+		"CAPTURE_SAMPLE_RATE":         strconv.FormatFloat(captureRate, 'f', -1, 64),
+		"PER_IP_RATE_LIMIT":           strconv.FormatFloat(perIPRate, 'f', -1, 64),
+		"BAGGAGE_MAX_BYTES":           strconv.Itoa(baggageMaxBytes),
+		"BAGGAGE_MAX_ITEM_BYTES":      strconv.Itoa(baggageMaxItemBytes),
+		"ENABLE_DEBUG_ENDPOINTS":      strconv.FormatBool(debugEndpoints),
+		"SERVICE_B_URL":               serviceBURL,
+		"SERVICE_B_SHARED_SECRET":     string(serviceBSecret),
+		"PASSTHROUGH_HEADERS":         strings.Join(slices.Sorted(maps.Keys(passthroughHeaders)), ","),
+		"HEALTHZ_DEEP_ENABLED":        strconv.FormatBool(deepHealth),
+		"HEALTHZ_DEEP_CEP":            healthCEP,
+		"PORT":                        port,
+		"SLOW_REQUEST_LOG_MS":         strconv.FormatInt(slowRequestThreshold.Milliseconds(), 10),
+	})
+
 	// Inicializamos o Tracer Provider para o "service-a".
 	// A função `InitTracerProvider` vem do nosso pacote partilhado `tracer`.
 	tp, err := tracer.InitTracerProvider("service-a", collectorURL)
@@ -39,76 +229,348 @@ func main() {
 	// `defer` garante que o `Shutdown` será chamado quando a função `main` terminar,
 	// assegurando que todos os spans em buffer sejam enviados.
 	defer func() {
-		if err := tp.Shutdown(context.Background()); err != nil {
-			log.Printf("erro ao desligar tracer provider: %v", err)
+		// Antes de desligar o tracer provider, executamos os hooks de encerramento
+		// registados pelos outros componentes, com um prazo partilhado.
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownHooksTimeout)
+		defer cancel()
+		if err := lifecycle.Shutdown(ctx); err != nil {
+			log.Printf("erro ao executar hooks de encerramento: %v", err)
 		}
+		// O prazo evita que um coletor que não responde bloqueie o fim do processo;
+		// o erro já é registado por ShutdownWithTimeout.
+		_ = tracer.ShutdownWithTimeout(tp, tracer.DefaultShutdownTimeout)
 	}()
+
+	// Métricas, enviadas ao mesmo coletor dos traces. O envio das métricas pendentes é
+	// feito como hook de encerramento, antes de o tracer provider ser desligado.
+	mp, err := tracer.InitMeterProvider("service-a", collectorURL)
+	if err != nil {
+		log.Fatalf("falha ao inicializar meter provider: %v", err)
+	}
+	lifecycle.RegisterShutdownHook(mp.Shutdown)
+	// Métricas do runtime do Go (goroutines, memória, GC), lidas em cada exportação, a cada
+	// OTEL_METRIC_EXPORT_INTERVAL, para detetar fugas de goroutines ou de memória.
+	if err := runtime.Start(); err != nil {
+		log.Fatalf("falha ao iniciar as métricas do runtime: %v", err)
+	}
 	// --- Fim da Configuração do OpenTelemetry ---
 
 	// Configuramos o router HTTP usando a biblioteca Chi.
 	r := chi.NewRouter()
-	r.Use(middleware.Logger) // Adiciona um logger para cada requisição.
+	r.Use(middleware.RequestID) // Atribui (ou reaproveita) um ID a cada requisição.
+	// Audita as respostas 4xx e 5xx de todas as rotas, incluindo os 404 e 405 do Chi.
+	r.Use(logging.AuditMiddleware)
+	// Com SLOW_REQUEST_LOG_MS, o log de acesso do Chi dá lugar ao de `logging.Middleware`,
+	// que só regista (em WARN) as requisições mais lentas do que o limiar.
+	if slowRequestThreshold == 0 {
+		r.Use(middleware.Logger) // Adiciona um logger para cada requisição.
+	}
 
 	// Criamos um handler que envolve a nossa lógica (`GetWeatherViaServiceB`) com o middleware do OTEL.
 	// Este middleware cria automaticamente um span para cada requisição recebida por este serviço.
 	// O nome "WeatherHandler" será o nome do span principal no Zipkin para este serviço.
-	otelHandler := otelhttp.NewHandler(http.HandlerFunc(GetWeatherViaServiceB), "WeatherHandler")
+	// Dentro dele, `logging.Middleware` coloca no contexto um logger com o trace ID e o request ID,
+	// `limiter.Middleware` aplica o limite por IP e `captures.Middleware` guarda uma amostra
+	// das requisições para depuração.
+	// Com as rotas de depuração ativas, a resposta indica ainda se o trace foi amostrado.
+	// Com DEBUG_SAMPLING=true, a decisão de amostragem é registada com o logger da requisição.
+	var weatherHandler http.Handler = logging.Middleware(tracer.SamplingLogMiddleware(limiter.Middleware(captures.Middleware(http.HandlerFunc(GetWeatherViaServiceB)))))
+	if debugEndpoints {
+		weatherHandler = tracer.SampledHeaderMiddleware(weatherHandler)
+	}
+	// A duração de cada requisição alimenta o histograma `http.server.duration`.
+	weatherHandler = tracer.DurationMiddleware(weatherHandler)
+	otelHandler := otelhttp.NewHandler(
+		weatherHandler,
+		"WeatherHandler",
+		serverTraceOptions(trustIncomingTrace)...,
+	)
 
-	// Mapeamos a rota POST /weather para o nosso handler instrumentado.
-	r.Post("/weather", otelHandler.ServeHTTP)
+	// Mapeamos a rota POST /weather para o nosso handler instrumentado. O contexto recebe a
+	// decisão de amostragem antes de o middleware do OTEL criar o span.
+	r.Post("/weather", tracer.SamplingDecisionMiddleware(otelHandler).ServeHTTP)
+
+	// Os browsers pedem /favicon.ico automaticamente. Respondemos 204 numa rota sem o
+	// middleware do OTEL, para que estes pedidos não gerem spans de ruído.
+	r.Get("/favicon.ico", faviconHandler)
+
+	// Verificação de saúde, fora da instrumentação para não gerar spans a cada sonda.
+	r.Method(http.MethodGet, "/healthz", newHealthChecker(deepHealth, healthCEP))
+
+	// Rotas de depuração, fora da instrumentação e desativadas por omissão.
+	if debugEndpoints {
+		r.Method(http.MethodGet, "/debug/captures", captures)
+	}
 
-	fmt.Println("Serviço A está a correr na porta 8080...")
-	http.ListenAndServe(":8080", r)
+	ln, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		log.Fatalf("falha ao escutar na porta %s: %v", port, err)
+	}
+	fmt.Printf("Serviço A está a correr em %s...\n", ln.Addr())
+	// Em SIGINT/SIGTERM, o servidor termina as requisições em curso antes de retornar;
+	// só depois os `defer` acima enviam os spans pendentes.
+	if err := lifecycle.Serve(ln, r, lifecycle.DefaultGracePeriod); err != nil {
+		log.Printf("erro no servidor HTTP: %v", err)
+	}
 }
 
 // GetWeatherViaServiceB é o handler que processa a requisição.
 func GetWeatherViaServiceB(w http.ResponseWriter, r *http.Request) {
 	// O contexto `r.Context()` já contém as informações do span criado pelo middleware otelHandler.
-	ctx := r.Context()
+	// Criamos um span filho "orchestrate-weather" que cobre a validação, a chamada ao Serviço B
+	// e o repasse da resposta, separando o processamento do Serviço A do tempo de rede.
+	ctx, span := otel.Tracer("service-a-tracer").Start(r.Context(), "orchestrate-weather")
+	defer span.End()
 
 	var req CEPRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		span.SetStatus(codes.Error, "invalid request body")
+		tracer.LogError(ctx, "corpo da requisição inválido", err)
 		http.Error(w, "invalid request body", http.StatusBadRequest)
 		return
 	}
+	span.SetAttributes(attribute.String("cep", req.CEP))
 
 	// Validamos o formato do CEP.
 	if !isValidCEP(req.CEP) {
+		span.SetStatus(codes.Error, "invalid zipcode")
+		tracer.LogInfo(ctx, "CEP inválido recebido", "cep", req.CEP)
 		http.Error(w, "invalid zipcode", http.StatusUnprocessableEntity) // [cite: 4]
 		return
 	}
+	distinctCEPs.add(req.CEP)
+	// A partir daqui, todos os logs desta requisição incluem o CEP.
+	ctx = logging.With(ctx, "cep", req.CEP)
+	// O CEP segue também no baggage, para que o Serviço B o associe aos seus spans.
+	ctx = withBaggageMember(ctx, cepBaggageKey, req.CEP)
+
+	// Se a requisição pertence a um incidente, marcamos o span e colocamos o ID no baggage,
+	// para que o Serviço B possa marcar os seus spans com o mesmo ID.
+	ctx = withIncidentID(ctx, r.Header.Get(incidentHeader))
 
+	// Com o cabeçalho `Idempotency-Key`, uma repetição da mesma requisição dentro da janela
+	// do TTL devolve a resposta anterior, sem voltar a chamar o Serviço B.
+	idempotency.withIdempotency(ctx, w, r.Header.Get(idempotencyHeader), req.CEP, func(w http.ResponseWriter) {
+		forwardToServiceB(ctx, w, r, req.CEP)
+	})
+}
+
+// forwardToServiceB chama o Serviço B para o CEP indicado e repassa a resposta ao cliente.
+// A query string e o cabeçalho `Accept` são repassados tal como recebidos, já que as opções
+// de resposta (ex: `pretty`, `verbose`, XML) são tratadas pelo Serviço B.
+func forwardToServiceB(ctx context.Context, w http.ResponseWriter, r *http.Request, cep string) {
 	// Criamos um cliente HTTP cujo transporte é instrumentado pelo OTEL.
 	// `otelhttp.NewTransport` envolve o transporte HTTP padrão. Ele automaticamente
 	// injeta os cabeçalhos de propagação de contexto (Trace ID, Span ID) na requisição
 	// que será feita para o Serviço B. É isto que conecta os dois traces.
-	client := http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
+	client := http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport, clientTraceOptions()...)}
 
-	// Montamos a URL para chamar o Serviço B. "service-b" é o nome do container no docker-compose.
-	url := fmt.Sprintf("http://service-b:8081/weather/%s", req.CEP)
+	// O prazo cobre a chamada e o repasse do corpo, para que um Serviço B lento não
+	// prenda o cliente indefinidamente.
+	ctx, cancel := context.WithTimeout(ctx, downstreamTimeout)
+	defer cancel()
+
+	// Montamos a URL para chamar o Serviço B.
+	url := fmt.Sprintf("%s/weather/%s", serviceBURL, cep)
+	if r.URL.RawQuery != "" {
+		url += "?" + r.URL.RawQuery
+	}
 	httpReq, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		http.Error(w, "erro ao criar requisição para o serviço B", http.StatusInternalServerError)
 		return
 	}
+	if accept := r.Header.Get("Accept"); accept != "" {
+		httpReq.Header.Set("Accept", accept)
+	}
+	// Repassamos o request ID para que os logs do Serviço B partilhem o mesmo identificador.
+	if reqID := middleware.GetReqID(ctx); reqID != "" {
+		httpReq.Header.Set(middleware.RequestIDHeader, reqID)
+	}
 
-	// Executamos a chamada. O span gerado por esta chamada será filho do span "WeatherHandler".
-	resp, err := client.Do(httpReq)
+	// Executamos a chamada, com novas tentativas em caso de falha transitória. Os spans
+	// das tentativas serão filhos do span "orchestrate-weather".
+	resp, err := doWithRetry(ctx, &client, httpReq)
+	if errors.Is(err, context.DeadlineExceeded) {
+		// O span do cliente HTTP já fica com o erro; marcamos também o span da orquestração.
+		span := trace.SpanFromContext(ctx)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "timeout ao chamar o serviço B")
+		logging.LoggerFromContext(ctx).Error("timeout ao chamar o serviço B", "error", err, "timeout", downstreamTimeout)
+		writeJSONError(w, http.StatusGatewayTimeout, "service b timed out")
+		return
+	}
 	if err != nil {
+		logging.LoggerFromContext(ctx).Error("erro ao chamar o serviço B", "error", err)
 		http.Error(w, "erro ao chamar o serviço B", http.StatusInternalServerError)
 		return
 	}
 	defer resp.Body.Close()
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("downstream.status_code", resp.StatusCode))
+	logging.LoggerFromContext(ctx).Info("resposta do serviço B recebida", "status", resp.StatusCode)
 
-	// Simplesmente repassamos a resposta (cabeçalhos, status e corpo) do Serviço B
-	// de volta para o cliente original.
+	// Repassamos a resposta (status e corpo) do Serviço B de volta para o cliente original.
+	// Dos cabeçalhos, apenas os aprovados em `passthroughHeaders` são repassados, para não
+	// expor cabeçalhos internos (ex: versões de servidores ou cabeçalhos de depuração).
 	for key, values := range resp.Header {
+		if !passthroughHeaders[http.CanonicalHeaderKey(key)] {
+			continue
+		}
 		for _, value := range values {
 			w.Header().Add(key, value)
 		}
 	}
 	w.WriteHeader(resp.StatusCode)
-	io.Copy(w, resp.Body)
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		recordRelayError(ctx, err)
+		// Uma resposta incompleta (ex: corpo mais curto do que o `Content-Length` enviado
+		// pelo Serviço B) não deve ser guardada para as repetições idempotentes.
+		if rec, ok := w.(interface{ discard() }); ok {
+			rec.discard()
+		}
+	}
+}
+
+// recordRelayError regista uma falha ao repassar o corpo da resposta ao cliente. O cliente
+// desligar-se a meio é comum e pouco grave: fica como evento no span e log informativo.
+// Os restantes erros (ex: falha na leitura da resposta do Serviço B) marcam o span como
+// falhado e são registados como erro.
+func recordRelayError(ctx context.Context, err error) {
+	span := trace.SpanFromContext(ctx)
+	logger := logging.LoggerFromContext(ctx)
+
+	if isClientDisconnect(ctx, err) {
+		span.AddEvent("client.disconnected", trace.WithAttributes(attribute.String("error", err.Error())))
+		logger.Info("cliente desligou-se antes do fim da resposta", "error", err)
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, "falha ao repassar a resposta do serviço B")
+	logger.Error("erro ao repassar a resposta do serviço B", "error", err)
+}
+
+// isClientDisconnect indica se o erro resulta de o cliente ter fechado a ligação.
+func isClientDisconnect(ctx context.Context, err error) bool {
+	return errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(ctx.Err(), context.Canceled)
+}
+
+// serverTraceOptions devolve as opções do middleware do OTEL para os handlers expostos.
+// Sem confiança no contexto recebido, usamos um propagador vazio na extração: os cabeçalhos
+// `traceparent`/`tracestate` (e o baggage) são ignorados e cada requisição inicia um trace
+// novo. A propagação para o Serviço B continua a usar o propagador global. Com
+// TRACE_CONTEXT_MAX_AGE definido, os contextos com um carimbo expirado são descartados.
+func serverTraceOptions(trustIncomingTrace bool) []otelhttp.Option {
+	if trustIncomingTrace {
+		if traceContextMaxAge > 0 {
+			return []otelhttp.Option{otelhttp.WithPropagators(tracer.TraceAgePropagators(traceContextMaxAge))}
+		}
+		return nil
+	}
+	return []otelhttp.Option{otelhttp.WithPropagators(propagation.NewCompositeTextMapPropagator())}
+}
+
+// durationFromEnv lê uma duração (ex: "2s", "500ms") da variável de ambiente indicada,
+// devolvendo o valor padrão quando a variável não está definida.
+func durationFromEnv(key string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%s deve ser uma duração positiva (ex: 2s, 500ms): %q", key, value)
+	}
+	return d, nil
+}
+
+// errorResponse é o corpo JSON das respostas de erro geradas pelo próprio Serviço A.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// writeJSONError responde com o status indicado e a mensagem num corpo JSON.
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{Error: message})
+}
+
+// faviconHandler responde 204 (sem conteúdo) aos pedidos de favicon dos browsers.
+func faviconHandler(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseHeaderList converte uma lista de cabeçalhos separados por vírgulas num conjunto
+// de nomes em forma canónica (ex: "content-type" -> "Content-Type").
+func parseHeaderList(list string) map[string]bool {
+	headers := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			headers[http.CanonicalHeaderKey(name)] = true
+		}
+	}
+	return headers
+}
+
+// boolFromEnv lê um booleano (true/false) da variável de ambiente indicada,
+// devolvendo o valor padrão quando a variável não está definida.
+func boolFromEnv(key string, fallback bool) (bool, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s deve ser true ou false: %q", key, value)
+	}
+	return b, nil
+}
+
+// floatFromEnv lê um número decimal da variável de ambiente indicada,
+// devolvendo o valor padrão quando a variável não está definida.
+func floatFromEnv(key string, fallback float64) (float64, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s deve ser um número: %q", key, value)
+	}
+	return f, nil
+}
+
+// intFromEnv lê um inteiro da variável de ambiente indicada, devolvendo o valor padrão
+// quando a variável não está definida.
+func intFromEnv(key string, fallback int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s deve ser um inteiro: %q", key, value)
+	}
+	return n, nil
+}
+
+// portFromEnv lê a porta de escuta da primeira variável de ambiente definida entre as
+// indicadas, devolvendo o valor padrão quando nenhuma está definida.
+func portFromEnv(key, fallbackKey, fallback string) (string, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		key, value = fallbackKey, os.Getenv(fallbackKey)
+	}
+	if value == "" {
+		return fallback, nil
+	}
+	if n, err := strconv.Atoi(value); err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("%s deve ser uma porta entre 1 e 65535: %q", key, value)
+	}
+	return value, nil
 }
 
 // isValidCEP valida se a string do CEP contém exatamente 8 dígitos numéricos.
@@ -116,3 +578,13 @@ func isValidCEP(cep string) bool {
 	match, _ := regexp.MatchString("^[0-9]{8}$", cep)
 	return match
 }
+
+// withIncidentID regista o ID do incidente como atributo do span atual e adiciona-o
+// ao baggage do contexto. Não faz nada quando o ID está vazio ou é inválido.
+func withIncidentID(ctx context.Context, incidentID string) context.Context {
+	if incidentID == "" || len(incidentID) > maxIncidentIDLength {
+		return ctx
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String(incidentKey, incidentID))
+	return withBaggageMember(ctx, incidentKey, incidentID)
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"Observabilidade/signing"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// stubServiceB substitui o Serviço B, durante o teste, pelo handler indicado.
+func stubServiceB(t *testing.T, handler http.Handler) {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	previous := serviceBURL
+	serviceBURL = srv.URL
+	t.Cleanup(func() { serviceBURL = previous })
+}
+
+// usePropagators regista, durante o teste, os propagadores que `main` regista por omissão.
+func usePropagators(t *testing.T) {
+	t.Helper()
+	previous := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	t.Cleanup(func() { otel.SetTextMapPropagator(previous) })
+}
+
+// postWeather envia o POST /weather ao handler do Serviço A, com os cabeçalhos indicados.
+func postWeather(t *testing.T, cep string, headers map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/weather", strings.NewReader(`{"cep":"`+cep+`"}`))
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	rec := httptest.NewRecorder()
+	GetWeatherViaServiceB(rec, req)
+	return rec
+}
+
+// findSpan devolve o span terminado com o nome indicado.
+func findSpan(t *testing.T, spans []sdktrace.ReadOnlySpan, name string) sdktrace.ReadOnlySpan {
+	t.Helper()
+	for _, span := range spans {
+		if span.Name() == name {
+			return span
+		}
+	}
+	t.Fatalf("span %q não encontrado", name)
+	return nil
+}
+
+func TestIncidentIDPropagatesToServiceB(t *testing.T) {
+	recorder := recordSpans(t)
+	usePropagators(t)
+	var received baggage.Baggage
+	stubServiceB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = baggage.Parse(r.Header.Get("baggage"))
+		w.Write([]byte(`{"city":"São Paulo"}`))
+	}))
+
+	rec := postWeather(t, "01001000", map[string]string{incidentHeader: "INC-42"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, esperado 200", rec.Code)
+	}
+	if got := received.Member(incidentKey).Value(); got != "INC-42" {
+		t.Errorf("baggage %s recebido pelo Serviço B = %q, esperado INC-42", incidentKey, got)
+	}
+	span := findSpan(t, recorder.Ended(), "orchestrate-weather")
+	if value, ok := spanAttribute(span, incidentKey); !ok || value.AsString() != "INC-42" {
+		t.Errorf("atributo %s = %q, esperado INC-42", incidentKey, value.AsString())
+	}
+}
+
+func TestIncidentIDIgnoredWhenAbsentOrTooLong(t *testing.T) {
+	usePropagators(t)
+	for name, headers := range map[string]map[string]string{
+		"ausente":      nil,
+		"longo demais": {incidentHeader: strings.Repeat("x", maxIncidentIDLength+1)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			recorder := recordSpans(t)
+			var received baggage.Baggage
+			stubServiceB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received, _ = baggage.Parse(r.Header.Get("baggage"))
+			}))
+
+			postWeather(t, "01001000", headers)
+			if member := received.Member(incidentKey); member.Key() != "" {
+				t.Errorf("o baggage não deveria ter %s: %q", incidentKey, member.Value())
+			}
+			if got := received.Member(cepBaggageKey).Value(); got != "01001000" {
+				t.Errorf("baggage %s = %q, esperado o CEP", cepBaggageKey, got)
+			}
+			span := findSpan(t, recorder.Ended(), "orchestrate-weather")
+			if _, ok := spanAttribute(span, incidentKey); ok {
+				t.Errorf("o span não deveria ter o atributo %s", incidentKey)
+			}
+		})
+	}
+}
+
+func TestPrettyIsForwardedToServiceB(t *testing.T) {
+	var query string
+	stubServiceB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		w.Write([]byte("{\n  \"city\": \"São Paulo\"\n}\n"))
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/weather?pretty=true", strings.NewReader(`{"cep":"01001000"}`))
+	rec := httptest.NewRecorder()
+	GetWeatherViaServiceB(rec, req)
+
+	if query != "pretty=true" {
+		t.Errorf("query recebida pelo Serviço B = %q, esperado pretty=true", query)
+	}
+	if !strings.Contains(rec.Body.String(), "\n  \"city\"") {
+		t.Errorf("o corpo indentado do Serviço B deveria ser repassado: %q", rec.Body)
+	}
+}
+
+func TestTrustIncomingTrace(t *testing.T) {
+	usePropagators(t)
+	const incoming = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	incomingTraceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	for _, trust := range []bool{true, false} {
+		t.Run(strconv.FormatBool(trust), func(t *testing.T) {
+			recorder := recordSpans(t)
+			var outgoing string
+			stubServiceB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				outgoing = r.Header.Get("traceparent")
+				w.Write([]byte(`{"city":"São Paulo"}`))
+			}))
+			handler := otelhttp.NewHandler(http.HandlerFunc(GetWeatherViaServiceB), "WeatherHandler", serverTraceOptions(trust)...)
+
+			req := httptest.NewRequest(http.MethodPost, "/weather", strings.NewReader(`{"cep":"01001000"}`))
+			req.Header.Set("traceparent", incoming)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, esperado 200", rec.Code)
+			}
+
+			span := findSpan(t, recorder.Ended(), "WeatherHandler")
+			traceID := span.SpanContext().TraceID().String()
+			if got := traceID == incomingTraceID; got != trust {
+				t.Errorf("trace ID do servidor = %s, esperado continuar o trace recebido: %v", traceID, trust)
+			}
+			if !trust && span.Parent().IsValid() {
+				t.Errorf("sem confiança, o span do servidor deveria ser raiz, pai = %s", span.Parent().SpanID())
+			}
+			// Em ambos os modos, o Serviço B recebe o trace deste serviço.
+			if !strings.Contains(outgoing, traceID) {
+				t.Errorf("traceparent enviado ao Serviço B = %q, esperado o trace %s", outgoing, traceID)
+			}
+		})
+	}
+}
+
+func TestFaviconIsNotInstrumented(t *testing.T) {
+	recorder := recordSpans(t)
+	rec := httptest.NewRecorder()
+	faviconHandler(rec, httptest.NewRequest(http.MethodGet, "/favicon.ico", nil))
+
+	if rec.Code != http.StatusNoContent || rec.Body.Len() != 0 {
+		t.Errorf("status = %d com %d bytes, esperado 204 sem corpo", rec.Code, rec.Body.Len())
+	}
+	if spans := recorder.Ended(); len(spans) != 0 {
+		t.Errorf("o favicon não deveria gerar spans, obtido %d", len(spans))
+	}
+}
+
+func TestServiceBHeadersAreWhitelisted(t *testing.T) {
+	stubServiceB(t, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Request-Id", "req-1")
+		w.Header().Set("Server", "service-b/1.2.3")
+		w.Header().Set("X-Debug-Upstream", "viacep")
+		w.Write([]byte(`{"city":"São Paulo"}`))
+	}))
+
+	rec := postWeather(t, "01001000", nil)
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, esperado repassado", got)
+	}
+	if got := rec.Header().Get("X-Request-Id"); got != "req-1" {
+		t.Errorf("X-Request-Id = %q, esperado repassado", got)
+	}
+	for _, key := range []string{"Server", "X-Debug-Upstream"} {
+		if got := rec.Header().Get(key); got != "" {
+			t.Errorf("%s = %q, não deveria ser repassado", key, got)
+		}
+	}
+}
+
+func TestPassthroughHeadersFromConfig(t *testing.T) {
+	previous := passthroughHeaders
+	passthroughHeaders = parseHeaderList(" x-debug-upstream , ")
+	t.Cleanup(func() { passthroughHeaders = previous })
+	stubServiceB(t, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("X-Debug-Upstream", "viacep")
+		w.Header().Set("X-Request-Id", "req-1")
+	}))
+
+	rec := postWeather(t, "01001000", nil)
+	if got := rec.Header().Get("X-Debug-Upstream"); got != "viacep" {
+		t.Errorf("X-Debug-Upstream = %q, esperado repassado por PASSTHROUGH_HEADERS", got)
+	}
+	if got := rec.Header().Get("X-Request-Id"); got != "" {
+		t.Errorf("X-Request-Id = %q, fora da lista configurada", got)
+	}
+}
+
+// closedClientWriter simula um cliente que fecha a ligação após receber os cabeçalhos:
+// todas as escritas do corpo falham com EPIPE.
+type closedClientWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (w closedClientWriter) Write([]byte) (int, error) {
+	return 0, &net.OpError{Op: "write", Net: "tcp", Err: os.NewSyscallError("write", syscall.EPIPE)}
+}
+
+func TestRelayClientDisconnectIsNotAFailure(t *testing.T) {
+	recorder := recordSpans(t)
+	stubServiceB(t, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte(`{"city":"São Paulo"}`))
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/weather", strings.NewReader(`{"cep":"01001000"}`))
+	GetWeatherViaServiceB(closedClientWriter{httptest.NewRecorder()}, req)
+
+	span := findSpan(t, recorder.Ended(), "orchestrate-weather")
+	if span.Status().Code == codes.Error {
+		t.Errorf("o cliente desligar-se não deveria marcar o span como falhado: %v", span.Status())
+	}
+	var disconnected bool
+	for _, event := range span.Events() {
+		disconnected = disconnected || event.Name == "client.disconnected"
+	}
+	if !disconnected {
+		t.Error("esperado o evento client.disconnected no span")
+	}
+}
+
+func TestRelayUpstreamReadErrorFailsSpan(t *testing.T) {
+	recorder := recordSpans(t)
+	// O Serviço B anuncia mais bytes do que envia, pelo que a leitura do corpo falha.
+	stubServiceB(t, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		w.Write([]byte(`{"city":`))
+	}))
+
+	postWeather(t, "01001000", nil)
+	span := findSpan(t, recorder.Ended(), "orchestrate-weather")
+	if span.Status().Code != codes.Error {
+		t.Errorf("status do span = %v, esperado erro ao repassar a resposta", span.Status())
+	}
+}
+
+func TestTruncatedRelayIsNotStoredForIdempotency(t *testing.T) {
+	previous := idempotency
+	idempotency = newIdempotencyStore(time.Minute)
+	t.Cleanup(func() { idempotency = previous })
+	var calls atomic.Int32
+	stubServiceB(t, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Length", "100")
+		w.Write([]byte(`{"city":`))
+	}))
+
+	// Uma resposta truncada não é repetida: a segunda requisição volta a chamar o Serviço B.
+	for i := 0; i < 2; i++ {
+		if rec := postWeather(t, "01001000", map[string]string{idempotencyHeader: "key-1"}); rec.Header().Get(idempotencyReplayHeader) != "" {
+			t.Fatalf("requisição %d repetida a partir de uma resposta truncada", i)
+		}
+	}
+	if calls.Load() != 2 {
+		t.Errorf("Serviço B chamado %d vezes, esperado 2", calls.Load())
+	}
+}
+
+func TestIsClientDisconnect(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want bool
+	}{
+		{"EPIPE", context.Background(), syscall.EPIPE, true},
+		{"ECONNRESET", context.Background(), &net.OpError{Op: "write", Err: syscall.ECONNRESET}, true},
+		{"contexto cancelado", cancelled, io.ErrShortWrite, true},
+		{"corpo truncado", context.Background(), io.ErrUnexpectedEOF, false},
+	}
+	for _, tt := range tests {
+		if got := isClientDisconnect(tt.ctx, tt.err); got != tt.want {
+			t.Errorf("%s: isClientDisconnect = %v, esperado %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOrchestrateWeatherSpanHierarchy(t *testing.T) {
+	recorder := recordSpans(t)
+	usePropagators(t)
+	stubServiceB(t, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("can not find zipcode"))
+	}))
+	handler := otelhttp.NewHandler(http.HandlerFunc(GetWeatherViaServiceB), "WeatherHandler")
+
+	req := httptest.NewRequest(http.MethodPost, "/weather", strings.NewReader(`{"cep":"01001000"}`))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	server := findSpan(t, spans, "WeatherHandler")
+	orchestrate := findSpan(t, spans, "orchestrate-weather")
+	if orchestrate.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Errorf("orchestrate-weather deveria ser filho do span do servidor")
+	}
+	// Cada tentativa de chamada ao Serviço B fica dentro de orchestrate-weather, e o span
+	// do cliente HTTP dentro da tentativa.
+	attempt := findSpan(t, spans, "call-service-b")
+	if attempt.Parent().SpanID() != orchestrate.SpanContext().SpanID() {
+		t.Errorf("call-service-b deveria ser filho de orchestrate-weather")
+	}
+	var clientSpans int
+	for _, span := range spans {
+		if span.SpanKind() == trace.SpanKindClient {
+			clientSpans++
+			if span.Parent().SpanID() != attempt.SpanContext().SpanID() {
+				t.Errorf("o span %q deveria ser filho de call-service-b", span.Name())
+			}
+		}
+	}
+	if clientSpans != 1 {
+		t.Errorf("spans do cliente HTTP = %d, esperado 1", clientSpans)
+	}
+	if value, _ := spanAttribute(orchestrate, "cep"); value.AsString() != "01001000" {
+		t.Errorf("cep = %q, esperado 01001000", value.AsString())
+	}
+	if value, _ := spanAttribute(orchestrate, "downstream.status_code"); value.AsInt64() != http.StatusNotFound {
+		t.Errorf("downstream.status_code = %d, esperado 404", value.AsInt64())
+	}
+}
+
+func TestOrchestrateWeatherSpanMarksInvalidZipcode(t *testing.T) {
+	recorder := recordSpans(t)
+	postWeather(t, "123", nil)
+
+	span := findSpan(t, recorder.Ended(), "orchestrate-weather")
+	if span.Status().Code != codes.Error || span.Status().Description != "invalid zipcode" {
+		t.Errorf("status = %+v, esperado erro invalid zipcode", span.Status())
+	}
+}
+
+func TestServiceBCallsAreSigned(t *testing.T) {
+	previous := serviceBSecret
+	serviceBSecret = []byte("segredo-partilhado")
+	t.Cleanup(func() { serviceBSecret = previous })
+	var verifyErr error
+	stubServiceB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		verifyErr = signing.Verify(r, serviceBSecret, signing.DefaultMaxSkew)
+		w.Write([]byte(`{"city":"São Paulo"}`))
+	}))
+
+	postWeather(t, "01001000", nil)
+	if verifyErr != nil {
+		t.Errorf("assinatura recebida pelo Serviço B inválida: %v", verifyErr)
+	}
+}
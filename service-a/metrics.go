@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// requestsCoalesced conta as requisições que, em vez de chamarem o Serviço B, esperaram
+// pela resposta de uma requisição em curso com a mesma chave de idempotência.
+// inflightGroups mede quantas chaves estão a ser executadas nesse momento. Usam o
+// MeterProvider global, configurado em `main` por InitMeterProvider.
+var (
+	requestsCoalesced = newRequestsCoalescedCounter()
+	inflightGroups    = newInflightGroupsGauge()
+)
+
+// rateLimitRejected conta as requisições recusadas com 429 pelo limite por IP.
+var rateLimitRejected = newRateLimitRejectedCounter()
+
+func newRequestsCoalescedCounter() metric.Int64Counter {
+	counter, err := otel.Meter("service-a").Int64Counter(
+		"requests.coalesced",
+		metric.WithDescription("Requisições que reaproveitaram uma chamada ao Serviço B já em curso."),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+	return counter
+}
+
+func newInflightGroupsGauge() metric.Int64UpDownCounter {
+	gauge, err := otel.Meter("service-a").Int64UpDownCounter(
+		"inflight.singleflight_groups",
+		metric.WithDescription("Chaves de idempotência com uma chamada ao Serviço B em curso."),
+		metric.WithUnit("{group}"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+	return gauge
+}
+
+func newRateLimitRejectedCounter() metric.Int64Counter {
+	counter, err := otel.Meter("service-a").Int64Counter(
+		"ratelimit.rejected",
+		metric.WithDescription("Requisições recusadas pelo limite de requisições por IP."),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+	return counter
+}
+
+// recordCoalesced incrementa `requests.coalesced` para uma requisição que esperou por outra.
+func recordCoalesced(ctx context.Context) {
+	requestsCoalesced.Add(ctx, 1)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+var (
+	metricReaderOnce sync.Once
+	metricReader     *sdkmetric.ManualReader
+)
+
+// testMetricReader instala, uma única vez por processo, um MeterProvider global com um
+// leitor manual. Os instrumentos do pacote são criados antes, sobre o provider global por
+// omissão, e passam a usar este provider quando ele é instalado.
+func testMetricReader() *sdkmetric.ManualReader {
+	metricReaderOnce.Do(func() {
+		metricReader = sdkmetric.NewManualReader()
+		otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(metricReader)))
+	})
+	return metricReader
+}
+
+// findMetric devolve os dados atuais da métrica indicada. Uma métrica ainda sem
+// medições não aparece na recolha, e nesse caso devolve false.
+func findMetric(t *testing.T, reader *sdkmetric.ManualReader, name string) (metricdata.Aggregation, bool) {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == name {
+				return m.Data, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// int64SumTotal devolve a soma atual dos pontos da métrica (contador ou UpDownCounter)
+// indicada, ou 0 se ainda não tem medições.
+func int64SumTotal(t *testing.T, name string) int64 {
+	t.Helper()
+	data, ok := findMetric(t, testMetricReader(), name)
+	if !ok {
+		return 0
+	}
+	var total int64
+	for _, dp := range data.(metricdata.Sum[int64]).DataPoints {
+		total += dp.Value
+	}
+	return total
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"Observabilidade/logging"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// rateLimitIdleTTL é o tempo sem requisições após o qual o balde de um IP é descartado.
+const rateLimitIdleTTL = 10 * time.Minute
+
+// tokenBucket guarda os tokens disponíveis de um IP e a última vez que foi reabastecido.
+type tokenBucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// ipRateLimiter limita as requisições por IP de cliente com um token bucket: cada IP
+// recebe `rate` tokens por segundo, até ao máximo de `burst`. Os baldes de IPs inativos
+// são removidos de forma preguiçosa, para que a memória não cresça sem limite.
+type ipRateLimiter struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// newIPRateLimiter cria um limitador com `rate` requisições por segundo por IP.
+// Com `rate` igual a 0, o limitador fica desativado.
+func newIPRateLimiter(rate float64) *ipRateLimiter {
+	return &ipRateLimiter{
+		rate:      rate,
+		burst:     math.Max(1, math.Ceil(rate)),
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// allow consome um token do IP indicado. Quando não há tokens, devolve false e o tempo
+// até o próximo token ficar disponível.
+func (l *ipRateLimiter) allow(ip string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) > rateLimitIdleTTL {
+		for k, b := range l.buckets {
+			if now.Sub(b.lastSeen) > rateLimitIdleTTL {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[ip]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, lastSeen: now}
+		l.buckets[ip] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.lastSeen).Seconds()*l.rate)
+	b.lastSeen = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// Middleware rejeita com 429 as requisições de IPs que excederam o limite, indicando em
+// `Retry-After` quantos segundos esperar. Cada rejeição incrementa o contador
+// `ratelimit.rejected`. Deve envolver o handler dentro do middleware
+// do OTEL, para que a rejeição fique registada como evento no span.
+func (l *ipRateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if l.rate <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ip := clientIP(r)
+		ok, wait := l.allow(ip)
+		if ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		retryAfter := int(math.Ceil(wait.Seconds()))
+		trace.SpanFromContext(r.Context()).AddEvent("rate_limit.rejected", trace.WithAttributes(
+			attribute.String("client.address", ip),
+			attribute.Int("retry_after", retryAfter),
+		))
+		rateLimitRejected.Add(r.Context(), 1)
+		logging.LoggerFromContext(r.Context()).Warn("limite de requisições por IP excedido", "client_ip", ip)
+
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+	})
+}
+
+// clientIP devolve o IP do cliente a partir de `r.RemoteAddr`. Não confiamos em
+// X-Forwarded-For nem X-Real-IP: como o Serviço A é a porta de entrada pública,
+// qualquer cliente poderia forjá-los para contornar o limite.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
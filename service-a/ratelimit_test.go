@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIPRateLimiterBurstAndRetryAfter(t *testing.T) {
+	l := newIPRateLimiter(2)
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.allow("10.0.0.1"); !ok {
+			t.Fatalf("requisição %d recusada dentro do burst", i)
+		}
+	}
+	ok, wait := l.allow("10.0.0.1")
+	if ok {
+		t.Fatal("requisição acima do burst foi aceite")
+	}
+	if wait <= 0 || wait > 500*time.Millisecond {
+		t.Fatalf("espera = %v, esperado até 500ms com 2 req/s", wait)
+	}
+}
+
+func TestIPRateLimiterIsPerIP(t *testing.T) {
+	l := newIPRateLimiter(1)
+	l.allow("10.0.0.1")
+	if ok, _ := l.allow("10.0.0.1"); ok {
+		t.Fatal("o segundo pedido do mesmo IP devia ser recusado")
+	}
+	if ok, _ := l.allow("10.0.0.2"); !ok {
+		t.Fatal("outro IP não devia ser afetado")
+	}
+}
+
+func TestIPRateLimiterRefills(t *testing.T) {
+	l := newIPRateLimiter(1)
+	l.allow("10.0.0.1")
+	l.buckets["10.0.0.1"].lastSeen = time.Now().Add(-time.Second)
+	if ok, _ := l.allow("10.0.0.1"); !ok {
+		t.Fatal("o balde devia ter sido reabastecido após 1s")
+	}
+}
+
+func TestIPRateLimiterExpiresIdleBuckets(t *testing.T) {
+	l := newIPRateLimiter(1)
+	l.allow("10.0.0.1")
+	l.buckets["10.0.0.1"].lastSeen = time.Now().Add(-2 * rateLimitIdleTTL)
+	l.lastSweep = time.Now().Add(-2 * rateLimitIdleTTL)
+
+	l.allow("10.0.0.2")
+	if _, ok := l.buckets["10.0.0.1"]; ok {
+		t.Fatal("o balde do IP inativo devia ter sido removido")
+	}
+	if len(l.buckets) != 1 {
+		t.Fatalf("baldes = %d, esperado 1", len(l.buckets))
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	before := rateLimitRejectedTotal(t)
+
+	l := newIPRateLimiter(1)
+	handler := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	send := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/weather", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		// Um X-Forwarded-For forjado não deve permitir contornar o limite.
+		req.Header.Set("X-Forwarded-For", "203.0.113.9")
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := send(); rec.Code != http.StatusOK {
+		t.Fatalf("primeira requisição = %d", rec.Code)
+	}
+	rec := send()
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("segunda requisição = %d, esperado %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Fatalf("Retry-After = %q, esperado \"1\"", got)
+	}
+	if got := rateLimitRejectedTotal(t) - before; got != 1 {
+		t.Fatalf("ratelimit.rejected aumentou %d, esperado 1", got)
+	}
+}
+
+func TestRateLimitMiddlewareDisabled(t *testing.T) {
+	l := newIPRateLimiter(0)
+	handler := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for i := 0; i < 5; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/weather", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("requisição %d = %d com o limite desativado", i, rec.Code)
+		}
+	}
+}
+
+// rateLimitRejectedTotal devolve o valor atual do contador `ratelimit.rejected`.
+func rateLimitRejectedTotal(t *testing.T) int64 {
+	t.Helper()
+	return int64SumTotal(t, "ratelimit.rejected")
+}
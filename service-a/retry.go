@@ -0,0 +1,168 @@
+package main
+
+import (
+	"Observabilidade/signing"
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// defaultServiceBRetries é o número padrão de novas tentativas da chamada ao Serviço B.
+const defaultServiceBRetries = 3
+
+// retryBaseDelay e retryMaxDelay delimitam a espera entre tentativas: a espera máxima
+// duplica a cada tentativa, até retryMaxDelay, e a espera efetiva é sorteada entre zero e
+// esse máximo (jitter), para que as repetições de vários clientes não coincidam.
+const (
+	retryBaseDelay = 100 * time.Millisecond
+	retryMaxDelay  = 2 * time.Second
+)
+
+// serviceBRetries é o número de novas tentativas após uma falha transitória do Serviço B.
+// É preenchido em `main` a partir de SERVICE_B_RETRIES; 0 desativa as repetições.
+var serviceBRetries = defaultServiceBRetries
+
+// doWithRetry executa o GET ao Serviço B, repetindo-o até `serviceBRetries` vezes quando a
+// ligação falha ou a resposta é 5xx. Respostas 4xx (ex: 404, 422) não são repetidas. Cada
+// tentativa tem o seu próprio span `call-service-b`, filho do span do contexto, para que as
+// repetições fiquem visíveis no Zipkin. A assinatura e o cabeçalho `X-Sent-At` são
+// recalculados em cada tentativa. O span da última tentativa leva `http.retry_count`, o
+// número de repetições feitas (0 quando a primeira tentativa basta). Devolve a resposta ou
+// o erro da última tentativa.
+//
+// Com um prazo no contexto, o tempo que resta é repartido pelas tentativas que faltam (ver
+// attemptContext), e não há nova tentativa quando a espera já não cabe no prazo: o total,
+// incluindo as esperas, fica dentro do prazo.
+func doWithRetry(ctx context.Context, client *http.Client, req *http.Request) (*http.Response, error) {
+	tr := otel.Tracer("service-a-tracer")
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := attemptContext(ctx, serviceBRetries+2-attempt)
+		attemptCtx, span := tr.Start(attemptCtx, "call-service-b", trace.WithAttributes(attribute.Int("retry.attempt", attempt)))
+		if deadline, ok := attemptCtx.Deadline(); ok {
+			span.AddEvent("retry.budget", trace.WithAttributes(
+				attribute.Int64("retry.budget_ms", time.Until(deadline).Milliseconds()),
+			))
+		}
+		resp, err := client.Do(newAttemptRequest(attemptCtx, req))
+		retryable := isRetryable(ctx, resp, err)
+		switch {
+		case err != nil:
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		case resp.StatusCode >= http.StatusInternalServerError:
+			span.SetStatus(codes.Error, fmt.Sprintf("status %d", resp.StatusCode))
+		}
+
+		var delay time.Duration
+		last := !retryable || attempt > serviceBRetries
+		if !last {
+			delay = backoffDelay(attempt)
+			last = !fitsDeadline(ctx, delay)
+		}
+		if last {
+			span.SetAttributes(attribute.Int("http.retry_count", attempt-1))
+			span.End()
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+			// O prazo da tentativa cobre também a leitura do corpo: só o libertamos quando
+			// quem chamou fecha a resposta.
+			resp.Body = cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+			return resp, nil
+		}
+		span.End()
+		if resp != nil {
+			// Ler o corpo até ao fim devolve a ligação ao pool antes da próxima tentativa.
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		cancel()
+
+		trace.SpanFromContext(ctx).AddEvent("service_b.retry", trace.WithAttributes(
+			attribute.Int("retry.attempt", attempt),
+			attribute.Int64("retry.delay_ms", delay.Milliseconds()),
+		))
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// attemptContext devolve o contexto de uma tentativa. Com um prazo em `ctx`, a tentativa
+// fica com a sua parte do tempo que resta, dividido pelas `attemptsLeft` tentativas que
+// faltam (incluindo esta): as primeiras tentativas não esgotam o prazo das seguintes, e
+// a última fica com todo o tempo que sobra.
+func attemptContext(ctx context.Context, attemptsLeft int) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok || attemptsLeft <= 1 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Until(deadline)/time.Duration(attemptsLeft))
+}
+
+// fitsDeadline indica se uma espera de `delay` ainda deixa tempo para outra tentativa
+// antes do prazo de `ctx`.
+func fitsDeadline(ctx context.Context, delay time.Duration) bool {
+	deadline, ok := ctx.Deadline()
+	return !ok || delay < time.Until(deadline)
+}
+
+// cancelOnClose liberta o contexto da tentativa quando o corpo da resposta é fechado.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// newAttemptRequest copia a requisição para o contexto da tentativa, com o instante de
+// envio e a assinatura atuais.
+func newAttemptRequest(ctx context.Context, req *http.Request) *http.Request {
+	attemptReq := req.Clone(ctx)
+	if len(serviceBSecret) > 0 {
+		signing.Sign(attemptReq, serviceBSecret)
+	}
+	// A hora de envio permite ao Serviço B detetar diferenças entre os relógios.
+	attemptReq.Header.Set(sentAtHeader, strconv.FormatInt(time.Now().UnixMilli(), 10))
+	return attemptReq
+}
+
+// isRetryable indica se a tentativa falhou de forma transitória: um erro de ligação, o
+// fim do prazo da própria tentativa ou uma resposta 5xx. Com o contexto da requisição
+// terminado (prazo esgotado ou cliente desligado), não há nova tentativa.
+func isRetryable(ctx context.Context, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode >= http.StatusInternalServerError
+}
+
+// backoffDelay devolve a espera antes da tentativa seguinte à indicada (a partir de 1).
+func backoffDelay(attempt int) time.Duration {
+	ceiling := retryMaxDelay
+	if shift := attempt - 1; shift < 8 {
+		ceiling = min(retryBaseDelay<<shift, retryMaxDelay)
+	}
+	return rand.N(ceiling + 1)
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recordSpans regista como global, durante o teste, um provider que guarda os spans.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+// spanAttribute devolve o valor do atributo `key` do span, e se existe.
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+// failingServer responde 503 às primeiras `failures` requisições e 200 às seguintes.
+func failingServer(t *testing.T, failures int32) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func setServiceBRetries(t *testing.T, retries int) {
+	t.Helper()
+	previous := serviceBRetries
+	serviceBRetries = retries
+	t.Cleanup(func() { serviceBRetries = previous })
+}
+
+func TestDoWithRetryRecordsRetryCount(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int32
+		retries   int
+		wantCalls int32
+		wantCount int64
+		wantCode  int
+	}{
+		{"primeira tentativa", 0, 3, 1, 0, http.StatusOK},
+		{"duas repetições", 2, 3, 3, 2, http.StatusOK},
+		{"repetições esgotadas", 5, 1, 2, 1, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := recordSpans(t)
+			setServiceBRetries(t, tt.retries)
+			srv, calls := failingServer(t, tt.failures)
+
+			req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+			resp, err := doWithRetry(context.Background(), srv.Client(), req)
+			if err != nil {
+				t.Fatalf("doWithRetry: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantCode {
+				t.Errorf("status = %d, esperado %d", resp.StatusCode, tt.wantCode)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("chamadas = %d, esperado %d", got, tt.wantCalls)
+			}
+
+			spans := recorder.Ended()
+			if len(spans) != int(tt.wantCalls) {
+				t.Fatalf("spans = %d, esperado %d", len(spans), tt.wantCalls)
+			}
+			last := spans[len(spans)-1]
+			count, ok := spanAttribute(last, "http.retry_count")
+			if !ok || count.AsInt64() != tt.wantCount {
+				t.Errorf("http.retry_count = %v (existe: %v), esperado %d", count.AsInt64(), ok, tt.wantCount)
+			}
+			for _, span := range spans[:len(spans)-1] {
+				if _, ok := spanAttribute(span, "http.retry_count"); ok {
+					t.Errorf("http.retry_count só deveria estar no span da última tentativa")
+				}
+			}
+		})
+	}
+}
+
+func TestDoWithRetryDoesNotRetryClientErrors(t *testing.T) {
+	setServiceBRetries(t, 3)
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	resp, err := doWithRetry(context.Background(), srv.Client(), req)
+	if err != nil {
+		t.Fatalf("doWithRetry: %v", err)
+	}
+	resp.Body.Close()
+	if calls.Load() != 1 {
+		t.Errorf("um 404 não deveria ser repetido: %d chamadas", calls.Load())
+	}
+}
+
+// hangingServer só responde depois de `hangs` requisições terem ficado à espera até o
+// cliente desistir; as seguintes recebem 200 de imediato.
+func hangingServer(t *testing.T, hangs int32) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= hangs {
+			<-r.Context().Done()
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+// attemptBudgets devolve, por ordem, o orçamento registado no evento `retry.budget` de
+// cada tentativa.
+func attemptBudgets(t *testing.T, spans []sdktrace.ReadOnlySpan) []int64 {
+	t.Helper()
+	var budgets []int64
+	for _, span := range spans {
+		for _, event := range span.Events() {
+			if event.Name != "retry.budget" {
+				continue
+			}
+			for _, kv := range event.Attributes {
+				if kv.Key == "retry.budget_ms" {
+					budgets = append(budgets, kv.Value.AsInt64())
+				}
+			}
+		}
+	}
+	return budgets
+}
+
+func TestDoWithRetrySplitsDeadlineAcrossAttempts(t *testing.T) {
+	recorder := recordSpans(t)
+	setServiceBRetries(t, 2)
+	srv, calls := hangingServer(t, 2)
+
+	const deadline = time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), deadline)
+	defer cancel()
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+
+	start := time.Now()
+	resp, err := doWithRetry(ctx, srv.Client(), req)
+	if err != nil {
+		t.Fatalf("doWithRetry: %v (chamadas: %d)", err, calls.Load())
+	}
+	resp.Body.Close()
+	if elapsed := time.Since(start); elapsed >= deadline {
+		t.Errorf("as tentativas demoraram %v, para lá do prazo de %v", elapsed, deadline)
+	}
+	if resp.StatusCode != http.StatusOK || calls.Load() != 3 {
+		t.Errorf("status = %d com %d chamadas, esperado 200 à terceira", resp.StatusCode, calls.Load())
+	}
+
+	budgets := attemptBudgets(t, recorder.Ended())
+	if len(budgets) != 3 {
+		t.Fatalf("orçamentos = %v, esperado um por tentativa", budgets)
+	}
+	// A primeira tentativa fica com um terço do prazo, e as seguintes com cada vez menos.
+	if budgets[0] > deadline.Milliseconds()/3 || budgets[0] < deadline.Milliseconds()/3-50 {
+		t.Errorf("orçamento da primeira tentativa = %dms, esperado cerca de %dms", budgets[0], deadline.Milliseconds()/3)
+	}
+	for i := 1; i < len(budgets); i++ {
+		if budgets[i] > budgets[i-1] {
+			t.Errorf("os orçamentos deveriam diminuir: %v", budgets)
+		}
+	}
+}
+
+func TestDoWithRetryStaysWithinTightDeadline(t *testing.T) {
+	setServiceBRetries(t, 3)
+	srv, calls := hangingServer(t, 100)
+
+	const deadline = 300 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), deadline)
+	defer cancel()
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+
+	start := time.Now()
+	_, err := doWithRetry(ctx, srv.Client(), req)
+	elapsed := time.Since(start)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("erro = %v, esperado context.DeadlineExceeded", err)
+	}
+	if elapsed > deadline+100*time.Millisecond {
+		t.Errorf("as tentativas demoraram %v, para lá do prazo de %v", elapsed, deadline)
+	}
+	// Sem a divisão do prazo, a primeira tentativa esgotá-lo-ia sozinha.
+	if calls.Load() < 2 {
+		t.Errorf("chamadas = %d, esperado pelo menos uma repetição dentro do prazo", calls.Load())
+	}
+}
+
+func TestDoWithRetryBodyOutlivesAttempt(t *testing.T) {
+	setServiceBRetries(t, 3)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "corpo")
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	resp, err := doWithRetry(ctx, srv.Client(), req)
+	if err != nil {
+		t.Fatalf("doWithRetry: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil || string(body) != "corpo" {
+		t.Errorf("corpo = %q (erro %v), esperado \"corpo\"", body, err)
+	}
+}
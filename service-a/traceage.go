@@ -0,0 +1,22 @@
+package main
+
+import (
+	"Observabilidade/tracer"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// traceContextMaxAge é a idade máxima aceite para o contexto de trace recebido (0 desativa).
+// É preenchido em `main` a partir de TRACE_CONTEXT_MAX_AGE.
+var traceContextMaxAge time.Duration
+
+// clientTraceOptions devolve as opções do transporte do OTEL para as chamadas ao
+// Serviço B. Com TRACE_CONTEXT_MAX_AGE definido, o contexto propagado leva o carimbo
+// (ver tracer.TraceAgePropagators), que o Serviço B verifica.
+func clientTraceOptions() []otelhttp.Option {
+	if traceContextMaxAge <= 0 {
+		return nil
+	}
+	return []otelhttp.Option{otelhttp.WithPropagators(tracer.TraceAgePropagators(traceContextMaxAge))}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Valores padrão dos circuit breakers das APIs externas.
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+// ErrCircuitOpen indica que a chamada foi recusada localmente porque o circuit breaker
+// da API externa está aberto, após falhas consecutivas.
+var ErrCircuitOpen = errors.New("upstream circuit breaker open")
+
+// Estados de um circuit breaker, usados também como valor do atributo no span.
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half_open"
+)
+
+// Circuit breakers de cada API externa. São independentes, para que uma falha do ViaCEP
+// não bloqueie as chamadas à WeatherAPI (e vice-versa). São configurados em `main`.
+var (
+	viaCEPBreaker  = newCircuitBreaker("viacep", defaultBreakerThreshold, defaultBreakerCooldown)
+	weatherBreaker = newCircuitBreaker("weatherapi", defaultBreakerThreshold, defaultBreakerCooldown)
+)
+
+// circuitBreaker abre após `threshold` falhas consecutivas de uma API externa e recusa
+// as chamadas durante `cooldown`. Passado esse tempo, deixa passar uma única chamada de
+// teste (half-open): se tiver sucesso o circuito fecha, caso contrário volta a abrir.
+// Com `threshold` igual a 0, o breaker fica desativado.
+type circuitBreaker struct {
+	provider  string
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+}
+
+// newCircuitBreaker cria um breaker fechado para a API externa indicada.
+func newCircuitBreaker(provider string, threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{provider: provider, threshold: threshold, cooldown: cooldown, state: breakerClosed}
+}
+
+// allow indica se a chamada pode avançar, registando o estado do breaker no span.
+// Devolve ErrCircuitOpen enquanto o circuito estiver aberto ou a chamada de teste em curso.
+func (b *circuitBreaker) allow(span trace.Span) error {
+	if b.threshold <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerOpen && time.Since(b.openedAt) >= b.cooldown {
+		// Esta chamada é a de teste; as restantes continuam recusadas até ela terminar.
+		b.state = breakerHalfOpen
+		span.SetAttributes(attribute.String("circuit_breaker.state", b.state))
+		return nil
+	}
+	span.SetAttributes(attribute.String("circuit_breaker.state", b.state))
+	if b.state != breakerClosed {
+		span.AddEvent("circuit_breaker.rejected", trace.WithAttributes(
+			attribute.String("circuit_breaker.provider", b.provider),
+		))
+		return ErrCircuitOpen
+	}
+	return nil
+}
+
+// record atualiza o breaker com o resultado da chamada. Só as falhas da própria API
+// (*UpstreamError) contam como falha, e só uma resposta da API (sucesso ou CEP
+// inexistente) conta como sucesso. Os restantes resultados (quota esgotada, cliente que
+// desistiu, erros internos) não dizem nada sobre a saúde da API: deixam o breaker como
+// estava e, se a chamada era a de teste, devolvem-no a aberto para que a chamada seguinte
+// volte a testar a API, em vez de o deixar preso em half-open.
+func (b *circuitBreaker) record(span trace.Span, err error) {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch breakerOutcome(err) {
+	case outcomeSuccess:
+		b.state = breakerClosed
+		b.failures = 0
+	case outcomeNeutral:
+		if b.state == breakerHalfOpen {
+			b.state = breakerOpen
+		}
+	case outcomeFailure:
+		b.failures++
+		if b.state == breakerHalfOpen || b.failures >= b.threshold {
+			if b.state != breakerOpen {
+				span.AddEvent("circuit_breaker.opened", trace.WithAttributes(
+					attribute.String("circuit_breaker.provider", b.provider),
+					attribute.Int("circuit_breaker.failures", b.failures),
+				))
+			}
+			b.state = breakerOpen
+			b.openedAt = time.Now()
+		}
+	}
+}
+
+// Resultados de uma chamada, do ponto de vista do circuit breaker.
+const (
+	outcomeSuccess = iota
+	outcomeFailure
+	outcomeNeutral
+)
+
+// breakerOutcome classifica o resultado de uma chamada. As falhas de rede e os timeouts
+// chegam já como *UpstreamError e contam como falha, exceto quando a causa é o
+// cancelamento do contexto pelo cliente, que não indica um problema da API.
+func breakerOutcome(err error) int {
+	if err == nil || errors.Is(err, ErrZipcodeNotFound) {
+		return outcomeSuccess
+	}
+	var upstreamErr *UpstreamError
+	if errors.As(err, &upstreamErr) && !errors.Is(err, context.Canceled) {
+		return outcomeFailure
+	}
+	return outcomeNeutral
+}
+
+// currentState devolve o estado atual do breaker.
+func (b *circuitBreaker) currentState() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var noSpan = trace.SpanFromContext(context.Background())
+
+func upstreamFailure(provider string) error {
+	return newUpstreamError(provider, 500, errors.New("Internal Server Error"))
+}
+
+// expireCooldown faz com que o cooldown do breaker aberto já tenha passado.
+func expireCooldown(b *circuitBreaker) {
+	b.mu.Lock()
+	b.openedAt = time.Now().Add(-b.cooldown)
+	b.mu.Unlock()
+}
+
+func TestCircuitBreakerOpensAfterThreshold(t *testing.T) {
+	b := newCircuitBreaker("viacep", 3, time.Minute)
+	for i := 0; i < 2; i++ {
+		if err := b.allow(noSpan); err != nil {
+			t.Fatalf("chamada %d recusada com o circuito fechado: %v", i, err)
+		}
+		b.record(noSpan, upstreamFailure("viacep"))
+	}
+	if got := b.currentState(); got != breakerClosed {
+		t.Fatalf("estado após 2 falhas = %q, esperado %q", got, breakerClosed)
+	}
+
+	b.record(noSpan, upstreamFailure("viacep"))
+	if got := b.currentState(); got != breakerOpen {
+		t.Fatalf("estado após 3 falhas = %q, esperado %q", got, breakerOpen)
+	}
+	if err := b.allow(noSpan); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("allow com o circuito aberto = %v, esperado ErrCircuitOpen", err)
+	}
+}
+
+func TestCircuitBreakerSuccessResetsFailures(t *testing.T) {
+	b := newCircuitBreaker("viacep", 2, time.Minute)
+	b.record(noSpan, upstreamFailure("viacep"))
+	b.record(noSpan, nil)
+	b.record(noSpan, upstreamFailure("viacep"))
+	if got := b.currentState(); got != breakerClosed {
+		t.Fatalf("estado = %q; as falhas deviam ser consecutivas", got)
+	}
+}
+
+func TestCircuitBreakerHalfOpenClosesOnSuccess(t *testing.T) {
+	b := newCircuitBreaker("weatherapi", 1, time.Minute)
+	b.record(noSpan, upstreamFailure("weatherapi"))
+	expireCooldown(b)
+
+	if err := b.allow(noSpan); err != nil {
+		t.Fatalf("a chamada de teste foi recusada: %v", err)
+	}
+	if got := b.currentState(); got != breakerHalfOpen {
+		t.Fatalf("estado durante a chamada de teste = %q, esperado %q", got, breakerHalfOpen)
+	}
+	if err := b.allow(noSpan); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("uma segunda chamada durante o teste devia ser recusada: %v", err)
+	}
+
+	b.record(noSpan, nil)
+	if got := b.currentState(); got != breakerClosed {
+		t.Fatalf("estado após a chamada de teste com sucesso = %q, esperado %q", got, breakerClosed)
+	}
+	if err := b.allow(noSpan); err != nil {
+		t.Fatalf("chamada recusada com o circuito fechado: %v", err)
+	}
+}
+
+func TestCircuitBreakerHalfOpenReopensOnFailure(t *testing.T) {
+	b := newCircuitBreaker("weatherapi", 1, time.Minute)
+	b.record(noSpan, upstreamFailure("weatherapi"))
+	expireCooldown(b)
+	b.allow(noSpan)
+
+	b.record(noSpan, upstreamFailure("weatherapi"))
+	if got := b.currentState(); got != breakerOpen {
+		t.Fatalf("estado após a chamada de teste falhada = %q, esperado %q", got, breakerOpen)
+	}
+	if err := b.allow(noSpan); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("o cooldown devia recomeçar após a falha da chamada de teste: %v", err)
+	}
+}
+
+func TestCircuitBreakerNeutralOutcomeReleasesHalfOpen(t *testing.T) {
+	neutral := map[string]error{
+		"quota esgotada":   ErrWeatherQuotaExhausted,
+		"cliente desistiu": newUpstreamError("weatherapi", 0, context.Canceled),
+		"erro interno":     errors.New("WEATHER_API_KEY não definida"),
+		"quota embrulhada": errors.Join(errors.New("x"), ErrWeatherQuotaExhausted),
+	}
+	for name, err := range neutral {
+		t.Run(name, func(t *testing.T) {
+			b := newCircuitBreaker("weatherapi", 1, time.Minute)
+			b.record(noSpan, upstreamFailure("weatherapi"))
+			expireCooldown(b)
+			if err := b.allow(noSpan); err != nil {
+				t.Fatalf("a chamada de teste foi recusada: %v", err)
+			}
+
+			b.record(noSpan, err)
+			if got := b.currentState(); got != breakerOpen {
+				t.Fatalf("estado = %q, esperado %q", got, breakerOpen)
+			}
+			// O cooldown já tinha passado: a chamada seguinte volta a ser a de teste.
+			if err := b.allow(noSpan); err != nil {
+				t.Fatalf("o breaker ficou preso depois de um resultado neutro: %v", err)
+			}
+			b.record(noSpan, nil)
+			if got := b.currentState(); got != breakerClosed {
+				t.Fatalf("estado após o novo teste = %q, esperado %q", got, breakerClosed)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerNeutralOutcomeKeepsClosedState(t *testing.T) {
+	b := newCircuitBreaker("weatherapi", 2, time.Minute)
+	b.record(noSpan, upstreamFailure("weatherapi"))
+	b.record(noSpan, ErrWeatherQuotaExhausted)
+	b.record(noSpan, upstreamFailure("weatherapi"))
+	if got := b.currentState(); got != breakerOpen {
+		t.Fatalf("a quota esgotada não devia repor a contagem de falhas: estado %q", got)
+	}
+}
+
+func TestCircuitBreakerZipcodeNotFoundIsSuccess(t *testing.T) {
+	b := newCircuitBreaker("viacep", 1, time.Minute)
+	b.record(noSpan, ErrZipcodeNotFound)
+	if got := b.currentState(); got != breakerClosed {
+		t.Fatalf("um CEP inexistente abriu o circuito: estado %q", got)
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	b := newCircuitBreaker("viacep", 0, time.Minute)
+	for i := 0; i < 10; i++ {
+		b.record(noSpan, upstreamFailure("viacep"))
+	}
+	if err := b.allow(noSpan); err != nil {
+		t.Fatalf("breaker desativado recusou a chamada: %v", err)
+	}
+}
+
+func TestCircuitBreakersAreIndependent(t *testing.T) {
+	oldViaCEP, oldWeather := viaCEPBreaker, weatherBreaker
+	t.Cleanup(func() { viaCEPBreaker, weatherBreaker = oldViaCEP, oldWeather })
+	viaCEPBreaker = newCircuitBreaker("viacep", 2, time.Minute)
+	weatherBreaker = newCircuitBreaker("weatherapi", 2, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		viaCEPBreaker.record(noSpan, upstreamFailure("viacep"))
+	}
+	if err := viaCEPBreaker.allow(noSpan); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("o breaker do ViaCEP devia estar aberto: %v", err)
+	}
+	if err := weatherBreaker.allow(noSpan); err != nil {
+		t.Fatalf("o breaker da WeatherAPI foi afetado pelas falhas do ViaCEP: %v", err)
+	}
+	if got := weatherBreaker.currentState(); got != breakerClosed {
+		t.Fatalf("estado da WeatherAPI = %q, esperado %q", got, breakerClosed)
+	}
+}
+
+func TestBreakerStateGauge(t *testing.T) {
+	reader := testMetricReader()
+	oldViaCEP, oldWeather := viaCEPBreaker, weatherBreaker
+	t.Cleanup(func() { viaCEPBreaker, weatherBreaker = oldViaCEP, oldWeather })
+	viaCEPBreaker = newCircuitBreaker("viacep", 1, time.Minute)
+	weatherBreaker = newCircuitBreaker("weatherapi", 1, time.Minute)
+	viaCEPBreaker.record(noSpan, upstreamFailure("viacep"))
+
+	got := map[string]int64{}
+	for _, dp := range collectMetric(t, reader, "circuit_breaker.state").(metricdata.Gauge[int64]).DataPoints {
+		provider, _ := dp.Attributes.Value(attribute.Key("provider"))
+		got[provider.AsString()] = dp.Value
+	}
+	if got["viacep"] != 2 || got["weatherapi"] != 0 {
+		t.Fatalf("circuit_breaker.state = %v, esperado viacep=2 e weatherapi=0", got)
+	}
+}
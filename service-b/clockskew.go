@@ -0,0 +1,43 @@
+package main
+
+import (
+	"Observabilidade/logging"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// sentAtHeader é o cabeçalho com a hora (Unix, em milissegundos) a que o Serviço A
+// enviou a requisição.
+const sentAtHeader = "X-Sent-At"
+
+// defaultClockSkewThreshold é a diferença mínima entre relógios que é reportada.
+const defaultClockSkewThreshold = 500 * time.Millisecond
+
+// clockSkewThreshold é preenchido em `main` a partir de CLOCK_SKEW_THRESHOLD.
+var clockSkewThreshold = defaultClockSkewThreshold
+
+// now é o relógio usado na comparação; é uma variável para poder ser substituído.
+var now = time.Now
+
+// clockSkewMiddleware compara a hora de envio indicada pelo Serviço A em `X-Sent-At`
+// com o relógio local. A diferença inclui a latência da rede, por isso só é reportada
+// acima de `clockSkewThreshold`: fica registada no atributo `clock.skew_ms` do span
+// (positiva quando o relógio do Serviço B está adiantado) e num aviso nos logs. Relógios
+// dessincronizados fazem, por exemplo, com que um span filho pareça começar antes do pai.
+func clockSkewMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if sentAt, err := strconv.ParseInt(r.Header.Get(sentAtHeader), 10, 64); err == nil {
+			skew := now().Sub(time.UnixMilli(sentAt))
+			if skew > clockSkewThreshold || skew < -clockSkewThreshold {
+				trace.SpanFromContext(r.Context()).SetAttributes(attribute.Int64("clock.skew_ms", skew.Milliseconds()))
+				logging.LoggerFromContext(r.Context()).Warn("diferença de relógio com o Serviço A",
+					"skew_ms", skew.Milliseconds(), "threshold_ms", clockSkewThreshold.Milliseconds())
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"Observabilidade/logging"
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// setNow fixa o relógio do Serviço B durante o teste.
+func setNow(t *testing.T, instant time.Time) {
+	t.Helper()
+	previous := now
+	now = func() time.Time { return instant }
+	t.Cleanup(func() { now = previous })
+}
+
+// serveWithSentAt passa pelo middleware uma requisição com `X-Sent-At` (vazio para
+// omitir o cabeçalho) e devolve o span da requisição e os logs produzidos.
+func serveWithSentAt(t *testing.T, sentAt string) (sdktrace.ReadOnlySpan, string) {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	tr := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+	var logs bytes.Buffer
+	ctx := logging.WithLogger(context.Background(), slog.New(slog.NewJSONHandler(&logs, nil)))
+	ctx, span := tr.Start(ctx, "GET /weather/{cep}")
+
+	req := httptest.NewRequest(http.MethodGet, "/weather/01001000", nil).WithContext(ctx)
+	if sentAt != "" {
+		req.Header.Set(sentAtHeader, sentAt)
+	}
+	clockSkewMiddleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})).ServeHTTP(httptest.NewRecorder(), req)
+	span.End()
+	return recorder.Ended()[0], logs.String()
+}
+
+func TestClockSkewIsReported(t *testing.T) {
+	local := time.UnixMilli(1_700_000_000_000)
+	setNow(t, local)
+	tests := []struct {
+		name   string
+		sentAt time.Time
+		want   int64
+	}{
+		{"Serviço B adiantado", local.Add(-2 * time.Second), 2000},
+		{"Serviço B atrasado", local.Add(1500 * time.Millisecond), -1500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			span, logs := serveWithSentAt(t, strconv.FormatInt(tt.sentAt.UnixMilli(), 10))
+			if value, ok := spanAttribute(span, "clock.skew_ms"); !ok || value.AsInt64() != tt.want {
+				t.Errorf("clock.skew_ms = %v, esperado %d", value.AsInt64(), tt.want)
+			}
+			if !strings.Contains(logs, "diferença de relógio com o Serviço A") {
+				t.Errorf("esperado um aviso nos logs, obtido %q", logs)
+			}
+		})
+	}
+}
+
+func TestClockSkewBelowThresholdIsIgnored(t *testing.T) {
+	local := time.UnixMilli(1_700_000_000_000)
+	setNow(t, local)
+	tests := []struct {
+		name, sentAt string
+	}{
+		{"latência normal", strconv.FormatInt(local.Add(-120*time.Millisecond).UnixMilli(), 10)},
+		{"sem cabeçalho", ""},
+		{"cabeçalho inválido", "ontem"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			span, logs := serveWithSentAt(t, tt.sentAt)
+			if _, ok := spanAttribute(span, "clock.skew_ms"); ok {
+				t.Error("clock.skew_ms não deveria estar definido")
+			}
+			if logs != "" {
+				t.Errorf("não deveria haver avisos, obtido %q", logs)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// debugEndpoints ativa as opções de depuração (ex: `?debug=raw`). É preenchido em `main`
+// a partir de ENABLE_DEBUG_ENDPOINTS e fica desativado por omissão.
+var debugEndpoints bool
+
+// debugPayload contém as respostas originais das APIs externas, incluídas em `_debug`
+// com `?debug=raw` para diagnosticar problemas de mapeamento. Os corpos vêm tal como
+// foram recebidos; a chave da WeatherAPI só segue na URL, nunca no corpo da resposta.
+type debugPayload struct {
+	ViaCEP     json.RawMessage `json:"viacep,omitempty"`
+	WeatherAPI json.RawMessage `json:"weatherapi,omitempty"`
+}
+
+// wantsRawDebug indica se o cliente pediu as respostas originais via `?debug=raw`.
+// Sem ENABLE_DEBUG_ENDPOINTS=true, o parâmetro é ignorado.
+func wantsRawDebug(r *http.Request) bool {
+	return debugEndpoints && r.URL.Query().Get("debug") == "raw"
+}
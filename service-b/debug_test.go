@@ -0,0 +1,105 @@
+package main
+
+import (
+	trc "Observabilidade/tracer"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// setDebugEndpoints define `debugEndpoints` durante o teste.
+func setDebugEndpoints(t *testing.T, enabled bool) {
+	t.Helper()
+	previous := debugEndpoints
+	debugEndpoints = enabled
+	t.Cleanup(func() { debugEndpoints = previous })
+}
+
+// getWeatherBody pede o clima de São Paulo com a query indicada e devolve o corpo JSON.
+func getWeatherBody(t *testing.T, query string) (map[string]json.RawMessage, string) {
+	t.Helper()
+	stubUpstreams(t, jsonHandler(viaCEPSaoPaulo), jsonHandler(weatherSaoPaulo))
+	r := chi.NewRouter()
+	registerRoutes(r)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/weather/01001000"+query, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("JSON inválido: %v", err)
+	}
+	return body, rec.Body.String()
+}
+
+func TestRawDebugPayloadWhenEnabled(t *testing.T) {
+	setDebugEndpoints(t, true)
+	body, raw := getWeatherBody(t, "?debug=raw")
+
+	var debug debugPayload
+	if err := json.Unmarshal(body["_debug"], &debug); err != nil {
+		t.Fatalf("_debug inválido: %v: %s", err, raw)
+	}
+	if !json.Valid(debug.ViaCEP) || !strings.Contains(string(debug.ViaCEP), `"localidade"`) {
+		t.Errorf("_debug.viacep = %s, esperado a resposta do ViaCEP", debug.ViaCEP)
+	}
+	if !json.Valid(debug.WeatherAPI) || !strings.Contains(string(debug.WeatherAPI), `"temp_c"`) {
+		t.Errorf("_debug.weatherapi = %s, esperado a resposta da WeatherAPI", debug.WeatherAPI)
+	}
+	if strings.Contains(raw, "test-key") {
+		t.Errorf("a chave da WeatherAPI não pode aparecer na resposta: %s", raw)
+	}
+	if _, ok := body["city"]; !ok {
+		t.Errorf("a resposta normal deveria continuar presente: %s", raw)
+	}
+}
+
+func TestRawDebugPayloadAbsent(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+		query   string
+	}{
+		{"depuração desativada", false, "?debug=raw"},
+		{"sem debug=raw", true, ""},
+		{"outro valor de debug", true, "?debug=1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setDebugEndpoints(t, tt.enabled)
+			body, raw := getWeatherBody(t, tt.query)
+			if _, ok := body["_debug"]; ok {
+				t.Errorf("_debug não deveria estar presente: %s", raw)
+			}
+		})
+	}
+}
+
+func TestSampledHeaderOnlyWithDebugEndpoints(t *testing.T) {
+	recordSpans(t)
+	for _, enabled := range []bool{true, false} {
+		t.Run(strconv.FormatBool(enabled), func(t *testing.T) {
+			setDebugEndpoints(t, enabled)
+			stubUpstreams(t, jsonHandler(viaCEPSaoPaulo), jsonHandler(weatherSaoPaulo))
+			r := chi.NewRouter()
+			registerRoutes(r)
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/weather/01001000", nil))
+			got := rec.Header().Get(trc.SampledHeader)
+			if enabled && got != "true" {
+				t.Errorf("%s = %q, esperado true", trc.SampledHeader, got)
+			}
+			if !enabled && got != "" {
+				t.Errorf("%s = %q, deveria estar ausente sem ENABLE_DEBUG_ENDPOINTS", trc.SampledHeader, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	net_url "net/url"
+)
+
+// ErrZipcodeNotFound indica que o ViaCEP não conhece o CEP consultado.
+var ErrZipcodeNotFound = errors.New("can not find zipcode")
+
+// UpstreamError descreve uma falha de uma API externa (ViaCEP ou WeatherAPI): erro de
+// rede, timeout, status não-2xx ou resposta num formato inesperado. Permite distinguir
+// as falhas das dependências ("culpa delas") dos erros internos do serviço.
+type UpstreamError struct {
+	Provider   string // "viacep" ou "weatherapi"
+	StatusCode int    // status HTTP devolvido; zero quando não houve resposta
+	Err        error
+}
+
+// newUpstreamError cria o erro de uma API externa. Os erros do cliente HTTP (*url.Error)
+// incluem a URL completa, que no caso da WeatherAPI contém a chave da API; guardamos
+// apenas o erro subjacente para que a chave nunca chegue a logs, spans ou respostas.
+func newUpstreamError(provider string, statusCode int, err error) *UpstreamError {
+	var urlErr *net_url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	return &UpstreamError{Provider: provider, StatusCode: statusCode, Err: err}
+}
+
+func (e *UpstreamError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("%s: status %d: %v", e.Provider, e.StatusCode, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.Provider, e.Err)
+}
+
+func (e *UpstreamError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout indica se a falha se deveu ao esgotar do prazo da chamada.
+func (e *UpstreamError) Timeout() bool {
+	if errors.Is(e.Err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(e.Err, &netErr) && netErr.Timeout()
+}
+
+// writeFetchError converte o erro das funções de busca no status HTTP adequado:
+// 404 para CEP desconhecido, 422 para um nome de cidade inválido na pesquisa, 503 quando
+// a quota da WeatherAPI está esgotada ou o circuit breaker da API externa está aberto,
+// 504 para timeouts das APIs externas, 502 para as restantes falhas externas e 500 para
+// erros internos. As mensagens são genéricas, para não expor detalhes internos ao
+// cliente; o erro completo fica no span e nos logs.
+func writeFetchError(w http.ResponseWriter, r *http.Request, err error) {
+	status, message := fetchErrorStatus(err)
+	writeError(w, r, status, message)
+}
+
+// fetchErrorStatus devolve o status HTTP e a mensagem genérica de um erro das funções de busca.
+func fetchErrorStatus(err error) (int, string) {
+	var upstreamErr *UpstreamError
+	switch {
+	case errors.Is(err, ErrZipcodeNotFound):
+		return http.StatusNotFound, "can not find zipcode"
+	case errors.Is(err, ErrInvalidCityName) && !errors.As(err, &upstreamErr):
+		return http.StatusUnprocessableEntity, "invalid city name"
+	case errors.Is(err, ErrWeatherQuotaExhausted):
+		return http.StatusServiceUnavailable, "upstream quota exhausted"
+	case errors.Is(err, ErrCircuitOpen):
+		return http.StatusServiceUnavailable, "upstream service unavailable"
+	case errors.As(err, &upstreamErr) && upstreamErr.Timeout():
+		return http.StatusGatewayTimeout, "upstream service timeout"
+	case errors.As(err, &upstreamErr):
+		return http.StatusBadGateway, "upstream service error"
+	default:
+		return http.StatusInternalServerError, "internal server error"
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	net_url "net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFetchErrorStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{"CEP desconhecido", ErrZipcodeNotFound, http.StatusNotFound},
+		{"cidade inválida na pesquisa", ErrInvalidCityName, http.StatusUnprocessableEntity},
+		{"cidade inválida vinda do ViaCEP", newUpstreamError("viacep", 200, ErrInvalidCityName), http.StatusBadGateway},
+		{"quota esgotada", ErrWeatherQuotaExhausted, http.StatusServiceUnavailable},
+		{"circuit breaker aberto", ErrCircuitOpen, http.StatusServiceUnavailable},
+		{"timeout da API", newUpstreamError("weatherapi", 0, context.DeadlineExceeded), http.StatusGatewayTimeout},
+		{"timeout de rede", newUpstreamError("viacep", 0, &os.SyscallError{Syscall: "read", Err: timeoutErr{}}), http.StatusGatewayTimeout},
+		{"5xx da API", newUpstreamError("weatherapi", 503, errors.New("Service Unavailable")), http.StatusBadGateway},
+		{"erro de rede", newUpstreamError("viacep", 0, errors.New("connection refused")), http.StatusBadGateway},
+		{"erro interno", errors.New("falha inesperada"), http.StatusInternalServerError},
+		{"erro embrulhado", fmt.Errorf("busca: %w", ErrZipcodeNotFound), http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, _ := fetchErrorStatus(tt.err); status != tt.status {
+				t.Fatalf("fetchErrorStatus(%v) = %d, esperado %d", tt.err, status, tt.status)
+			}
+		})
+	}
+}
+
+// timeoutErr é um erro de rede que indica um timeout.
+type timeoutErr struct{}
+
+func (timeoutErr) Error() string   { return "i/o timeout" }
+func (timeoutErr) Timeout() bool   { return true }
+func (timeoutErr) Temporary() bool { return true }
+
+func TestUpstreamErrorHidesURL(t *testing.T) {
+	err := newUpstreamError("weatherapi", 0, &net_url.Error{
+		Op:  "Get",
+		URL: "http://api.weatherapi.com/v1/current.json?key=secret",
+		Err: errors.New("connection refused"),
+	})
+	if strings.Contains(err.Error(), "key=") {
+		t.Fatalf("o erro expõe a URL com a chave da API: %v", err)
+	}
+}
+
+func TestWriteFetchErrorBody(t *testing.T) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/weather/01001000", nil)
+	writeFetchError(rec, req, newUpstreamError("weatherapi", 500, errors.New("Internal Server Error")))
+
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("status = %d, esperado %d", rec.Code, http.StatusBadGateway)
+	}
+	if body := strings.TrimSpace(rec.Body.String()); body != "upstream service error" {
+		t.Fatalf("corpo = %q; a mensagem deve ser genérica", body)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"Observabilidade/logging"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxLastKnownEntries limita o número de CEPs guardados para o fallback.
+const maxLastKnownEntries = 10000
+
+// fallbackEnabled ativa o fallback com o último valor bom conhecido de cada CEP. É
+// preenchido em `main` a partir de FALLBACK_ENABLED e fica desativado por omissão.
+var fallbackEnabled bool
+
+// lastKnownWeather é o último resultado obtido com sucesso para um CEP.
+type lastKnownWeather struct {
+	city             string
+	tempC            float64
+	lastUpdatedEpoch int64
+	storedAt         time.Time
+}
+
+// lastKnownStore guarda em memória o último resultado bom de cada CEP. Não é persistido:
+// depois de um reinício, o fallback só fica disponível para os CEPs consultados de novo.
+type lastKnownStore struct {
+	mu      sync.Mutex
+	entries map[string]lastKnownWeather
+}
+
+var lastKnown = &lastKnownStore{entries: map[string]lastKnownWeather{}}
+
+// remember guarda o resultado do CEP. Com a loja cheia, só os CEPs já conhecidos são atualizados.
+func (s *lastKnownStore) remember(cep string, entry lastKnownWeather) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[cep]; ok || len(s.entries) < maxLastKnownEntries {
+		s.entries[cep] = entry
+	}
+}
+
+func (s *lastKnownStore) get(cep string) (lastKnownWeather, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[cep]
+	return entry, ok
+}
+
+// isProviderFailure indica se o erro se deve à indisponibilidade das APIs externas (falha,
+// quota esgotada ou circuit breaker aberto), o único caso em que o fallback se aplica. Um
+// CEP inexistente continua a ser um 404.
+func isProviderFailure(err error) bool {
+	var upstreamErr *UpstreamError
+	return errors.As(err, &upstreamErr) ||
+		errors.Is(err, ErrWeatherQuotaExhausted) ||
+		errors.Is(err, ErrCircuitOpen)
+}
+
+// writeFetchErrorOrFallback responde com o último valor bom conhecido do CEP, com status
+// 203 e `fallback=true`, quando o fallback está ativo e as APIs externas falharam. Nos
+// restantes casos, responde com o erro, tal como `writeFetchError`. O uso do fallback fica
+// registado no span com o evento `weather.fallback`.
+func writeFetchErrorOrFallback(w http.ResponseWriter, r *http.Request, cep string, err error) {
+	entry, ok := lastKnownWeather{}, false
+	if fallbackEnabled && isProviderFailure(err) {
+		entry, ok = lastKnown.get(cep)
+	}
+	if !ok {
+		writeFetchError(w, r, err)
+		return
+	}
+
+	trace.SpanFromContext(r.Context()).AddEvent("weather.fallback", trace.WithAttributes(
+		attribute.String("error", err.Error()),
+		attribute.String("fallback.stored_at", entry.storedAt.Format(time.RFC3339)),
+	))
+	logging.LoggerFromContext(r.Context()).Warn("APIs externas indisponíveis: resposta com o último valor conhecido",
+		"error", err, "stored_at", entry.storedAt)
+
+	response := newFinalResponse(entry.city, entry.tempC)
+	response.DataAgeSeconds = dataAgeSeconds(entry.lastUpdatedEpoch, time.Now())
+	response.Fallback = true
+	writeResponse(w, r, http.StatusNonAuthoritativeInfo, response)
+}
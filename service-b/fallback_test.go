@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// setFallback ativa (ou desativa) o fallback durante o teste, com uma loja vazia.
+func setFallback(t *testing.T, enabled bool) {
+	t.Helper()
+	previousEnabled, previousStore := fallbackEnabled, lastKnown
+	fallbackEnabled = enabled
+	lastKnown = &lastKnownStore{entries: map[string]lastKnownWeather{}}
+	t.Cleanup(func() { fallbackEnabled, lastKnown = previousEnabled, previousStore })
+}
+
+// flakyWeather é uma WeatherAPI simulada que passa a falhar com 500 quando `down` é true.
+func flakyWeather(down *atomic.Bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(weatherSaoPaulo))
+	}
+}
+
+// getWeatherResponse pede o clima do CEP ao router do Serviço B.
+func getWeatherResponse(r http.Handler, cep string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/weather/"+cep, nil))
+	return rec
+}
+
+func TestFallbackServesLastKnownWeather(t *testing.T) {
+	recorder := recordSpans(t)
+	setFallback(t, true)
+	var down atomic.Bool
+	stubUpstreams(t, jsonHandler(viaCEPSaoPaulo), flakyWeather(&down))
+	r := chi.NewRouter()
+	registerRoutes(r)
+
+	if rec := getWeatherResponse(r, "01001000"); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, esperado 200 com as APIs disponíveis", rec.Code)
+	}
+	down.Store(true)
+	rec := getWeatherResponse(r, "01001000")
+	if rec.Code != http.StatusNonAuthoritativeInfo {
+		t.Fatalf("status = %d, esperado 203 com as APIs indisponíveis: %s", rec.Code, rec.Body)
+	}
+	var body FinalResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if !body.Fallback || body.City != "São Paulo" || body.TempC != 25 {
+		t.Errorf("resposta = %+v, esperado o último valor conhecido com fallback=true", body)
+	}
+	if len(spanEvents(recorder, "weather.fallback")) != 1 {
+		t.Error("esperado o evento weather.fallback no span")
+	}
+}
+
+func TestFallbackWithoutLastKnownValue(t *testing.T) {
+	setFallback(t, true)
+	var down atomic.Bool
+	down.Store(true)
+	stubUpstreams(t, jsonHandler(viaCEPSaoPaulo), flakyWeather(&down))
+	r := chi.NewRouter()
+	registerRoutes(r)
+
+	if rec := getWeatherResponse(r, "01001000"); rec.Code != http.StatusBadGateway {
+		t.Errorf("status = %d, esperado 502 sem valor conhecido", rec.Code)
+	}
+}
+
+func TestFallbackDisabledByDefault(t *testing.T) {
+	setFallback(t, false)
+	var down atomic.Bool
+	stubUpstreams(t, jsonHandler(viaCEPSaoPaulo), flakyWeather(&down))
+	r := chi.NewRouter()
+	registerRoutes(r)
+
+	getWeatherResponse(r, "01001000")
+	down.Store(true)
+	if rec := getWeatherResponse(r, "01001000"); rec.Code != http.StatusBadGateway {
+		t.Errorf("status = %d, esperado 502 com o fallback desativado", rec.Code)
+	}
+}
+
+func TestFallbackKeepsNotFound(t *testing.T) {
+	setFallback(t, true)
+	lastKnown.remember("99999999", lastKnownWeather{city: "Cidade", tempC: 20})
+	stubUpstreams(t, jsonHandler(`{"erro":"true"}`), nil)
+	r := chi.NewRouter()
+	registerRoutes(r)
+
+	if rec := getWeatherResponse(r, "99999999"); rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, esperado 404 para um CEP inexistente", rec.Code)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"Observabilidade/logging"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	net_url "net/url"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrLocationNotGeocoded indica que o geocoder não encontrou coordenadas para a localidade.
+var ErrLocationNotGeocoded = errors.New("location not geocoded")
+
+// Coordinates são as coordenadas geográficas (em graus decimais) de uma localidade.
+type Coordinates struct {
+	Lat float64
+	Lon float64
+}
+
+// String formata as coordenadas como `lat,lon`, o formato aceite na query da WeatherAPI.
+func (c Coordinates) String() string {
+	return strconv.FormatFloat(c.Lat, 'f', -1, 64) + "," + strconv.FormatFloat(c.Lon, 'f', -1, 64)
+}
+
+// Geocoder converte o nome de uma cidade (e a UF) nas suas coordenadas.
+type Geocoder interface {
+	Geocode(ctx context.Context, city, state string) (Coordinates, error)
+}
+
+// geocoder é o Geocoder usado antes da consulta à WeatherAPI. Fica a nil (desativado)
+// exceto com GEOCODE_ENABLED=true, caso em que `main` usa o weatherAPIGeocoder.
+var geocoder Geocoder
+
+// weatherAPIGeocoder é o Geocoder padrão: usa o endpoint de pesquisa da WeatherAPI, com a
+// mesma chave e quota das consultas de clima.
+type weatherAPIGeocoder struct {
+	client *weatherClient
+}
+
+// Geocode devolve as coordenadas do primeiro resultado da pesquisa por "cidade, UF, Brazil".
+func (g weatherAPIGeocoder) Geocode(ctx context.Context, city, state string) (Coordinates, error) {
+	q := city
+	if state != "" {
+		q += ", " + state
+	}
+	resp, err := g.client.get(ctx, "/v1/search.json", net_url.Values{"q": {q + ", Brazil"}})
+	if err != nil {
+		return Coordinates{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return Coordinates{}, newUpstreamError("weatherapi", resp.StatusCode, errors.New(http.StatusText(resp.StatusCode)))
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Coordinates{}, newUpstreamError("weatherapi", resp.StatusCode, err)
+	}
+	var results []struct {
+		Lat float64 `json:"lat"`
+		Lon float64 `json:"lon"`
+	}
+	if err := json.Unmarshal(body, &results); err != nil {
+		return Coordinates{}, newUpstreamError("weatherapi", resp.StatusCode, fmt.Errorf("erro ao decodificar JSON da pesquisa: %w", err))
+	}
+	if len(results) == 0 {
+		return Coordinates{}, ErrLocationNotGeocoded
+	}
+	return Coordinates{Lat: results[0].Lat, Lon: results[0].Lon}, nil
+}
+
+// weatherQuery devolve o valor a usar na query da WeatherAPI para a localidade do ViaCEP.
+// Com o geocoder ativo, usamos as coordenadas, o que evita confundir cidades homónimas;
+// se a geocodificação falhar, voltamos à consulta pelo nome da cidade. A chamada ao
+// geocoder tem um span próprio, `geocode-city`.
+func weatherQuery(ctx context.Context, tr trace.Tracer, location *ViaCEPResponse) string {
+	if geocoder == nil {
+		return location.Localidade
+	}
+
+	ctx, span := tr.Start(ctx, "geocode-city", trace.WithAttributes(
+		attribute.String("city", location.Localidade),
+		attribute.String("state", location.UF),
+	))
+	defer span.End()
+
+	coords, err := geocoder.Geocode(ctx, location.Localidade, location.UF)
+	if err != nil {
+		recordFailure(span, err)
+		span.SetAttributes(attribute.Bool("geocode.fallback", true))
+		logging.LoggerFromContext(ctx).Warn("falha na geocodificação: consulta pelo nome da cidade",
+			"city", location.Localidade, "error", err)
+		return location.Localidade
+	}
+	span.SetAttributes(
+		attribute.Float64("geocode.lat", coords.Lat),
+		attribute.Float64("geocode.lon", coords.Lon),
+	)
+	return coords.String()
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// fakeGeocoder devolve sempre as mesmas coordenadas, ou o erro indicado.
+type fakeGeocoder struct {
+	coords Coordinates
+	err    error
+}
+
+func (g fakeGeocoder) Geocode(context.Context, string, string) (Coordinates, error) {
+	return g.coords, g.err
+}
+
+// setGeocoder define `geocoder` durante o teste.
+func setGeocoder(t *testing.T, g Geocoder) {
+	t.Helper()
+	previous := geocoder
+	geocoder = g
+	t.Cleanup(func() { geocoder = previous })
+}
+
+var saoPaulo = &ViaCEPResponse{Localidade: "São Paulo", UF: "SP"}
+
+func TestWeatherQueryUsesCoordinates(t *testing.T) {
+	setGeocoder(t, fakeGeocoder{coords: Coordinates{Lat: -23.55, Lon: -46.63}})
+	recorder := tracetest.NewSpanRecorder()
+	tr := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	if got := weatherQuery(context.Background(), tr, saoPaulo); got != "-23.55,-46.63" {
+		t.Errorf("weatherQuery = %q, esperado as coordenadas", got)
+	}
+	spans := recorder.Ended()
+	if len(spans) != 1 || spans[0].Name() != "geocode-city" {
+		t.Fatalf("esperado o span geocode-city, obtido %d spans", len(spans))
+	}
+	if _, ok := spanAttribute(spans[0], "geocode.fallback"); ok {
+		t.Error("geocode.fallback não deveria estar definido")
+	}
+}
+
+func TestWeatherQueryFallsBackToCityName(t *testing.T) {
+	setGeocoder(t, fakeGeocoder{err: ErrLocationNotGeocoded})
+	recorder := tracetest.NewSpanRecorder()
+	tr := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	if got := weatherQuery(context.Background(), tr, saoPaulo); got != "São Paulo" {
+		t.Errorf("weatherQuery = %q, esperado o nome da cidade", got)
+	}
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("esperado o span geocode-city, obtido %d spans", len(spans))
+	}
+	if value, ok := spanAttribute(spans[0], "geocode.fallback"); !ok || !value.AsBool() {
+		t.Error("esperado geocode.fallback=true no span")
+	}
+}
+
+func TestWeatherQueryWithoutGeocoder(t *testing.T) {
+	setGeocoder(t, nil)
+	recorder := tracetest.NewSpanRecorder()
+	tr := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	if got := weatherQuery(context.Background(), tr, saoPaulo); got != "São Paulo" {
+		t.Errorf("weatherQuery = %q, esperado o nome da cidade", got)
+	}
+	if spans := recorder.Ended(); len(spans) != 0 {
+		t.Errorf("sem geocoder não deveria haver spans, obtido %d", len(spans))
+	}
+}
+
+func TestWeatherAPIGeocoder(t *testing.T) {
+	tests := []struct {
+		name, body string
+		want       Coordinates
+		wantErr    error
+	}{
+		{"com resultados", `[{"lat":-23.55,"lon":-46.63},{"lat":1,"lon":2}]`, Coordinates{Lat: -23.55, Lon: -46.63}, nil},
+		{"sem resultados", `[]`, Coordinates{}, ErrLocationNotGeocoded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var query string
+			stubUpstreams(t, nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				query = r.URL.Query().Get("q")
+				w.Write([]byte(tt.body))
+			}))
+
+			got, err := weatherAPIGeocoder{client: weatherAPI}.Geocode(context.Background(), "São Paulo", "SP")
+			if !errors.Is(err, tt.wantErr) || got != tt.want {
+				t.Errorf("Geocode = %v, %v, esperado %v, %v", got, err, tt.want, tt.wantErr)
+			}
+			if query != "São Paulo, SP, Brazil" {
+				t.Errorf("pesquisa = %q, esperado a cidade, a UF e o país", query)
+			}
+		})
+	}
+}
+
+func TestWeatherIsQueriedByCoordinates(t *testing.T) {
+	setGeocoder(t, fakeGeocoder{coords: Coordinates{Lat: -23.55, Lon: -46.63}})
+	var query string
+	stubUpstreams(t, jsonHandler(viaCEPSaoPaulo), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query().Get("q")
+		w.Write([]byte(weatherSaoPaulo))
+	}))
+	r := chi.NewRouter()
+	registerRoutes(r)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/weather/01001000", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if query != "-23.55,-46.63" {
+		t.Errorf("query da WeatherAPI = %q, esperado as coordenadas", query)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"time"
+	// A imagem final (alpine) não inclui a base de dados de fusos horários.
+	_ "time/tzdata"
+)
+
+// weatherAPILocaltimeLayout é o formato de `location.localtime` devolvido pela WeatherAPI.
+const weatherAPILocaltimeLayout = "2006-01-02 15:04"
+
+// localTimeRFC3339 converte a hora local devolvida pela WeatherAPI, no fuso `tzID`,
+// para RFC3339 (ex: "2024-01-15T14:30:00-03:00"). Devolve "" se a hora ou o fuso
+// não puderem ser interpretados, para que o campo seja omitido da resposta.
+func localTimeRFC3339(localtime, tzID string) string {
+	if localtime == "" || tzID == "" {
+		return ""
+	}
+	loc, err := time.LoadLocation(tzID)
+	if err != nil {
+		return ""
+	}
+	t, err := time.ParseInLocation(weatherAPILocaltimeLayout, localtime, loc)
+	if err != nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// dataAgeSeconds devolve há quantos segundos a WeatherAPI fez a leitura, a partir de
+// `current.last_updated_epoch`. Devolve nil quando o instante não é conhecido (zero),
+// para que o campo seja omitido; uma leitura "no futuro" (relógios dessincronizados)
+// conta como idade zero.
+func dataAgeSeconds(epoch int64, now time.Time) *int64 {
+	if epoch <= 0 {
+		return nil
+	}
+	age := int64(now.Sub(time.Unix(epoch, 0)) / time.Second)
+	if age < 0 {
+		age = 0
+	}
+	return &age
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestLocalTimeRFC3339(t *testing.T) {
+	tests := []struct {
+		name, localtime, tzID, want string
+	}{
+		{"São Paulo", "2024-01-15 14:30", "America/Sao_Paulo", "2024-01-15T14:30:00-03:00"},
+		{"horário de verão", "2024-07-01 09:05", "Europe/Lisbon", "2024-07-01T09:05:00+01:00"},
+		{"UTC", "2024-01-15 00:00", "UTC", "2024-01-15T00:00:00Z"},
+		{"fuso desconhecido", "2024-01-15 14:30", "America/Atlantida", ""},
+		{"hora inválida", "15/01/2024 14h30", "America/Sao_Paulo", ""},
+		{"sem hora", "", "America/Sao_Paulo", ""},
+		{"sem fuso", "2024-01-15 14:30", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := localTimeRFC3339(tt.localtime, tt.tzID); got != tt.want {
+				t.Errorf("localTimeRFC3339(%q, %q) = %q, esperado %q", tt.localtime, tt.tzID, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalTimeInResponse(t *testing.T) {
+	tests := []struct {
+		name, location, want string
+	}{
+		{"válida", `{"localtime":"2024-01-15 14:30","tz_id":"America/Sao_Paulo"}`, "2024-01-15T14:30:00-03:00"},
+		{"inválida", `{"localtime":"ontem","tz_id":"America/Sao_Paulo"}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubUpstreams(t, jsonHandler(viaCEPSaoPaulo),
+				jsonHandler(`{"location":`+tt.location+`,"current":{"temp_c":25}}`))
+			r := chi.NewRouter()
+			registerRoutes(r)
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/weather/01001000?localtime=true", nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			// Uma hora inválida não impede a resposta: o campo é apenas omitido.
+			var body map[string]any
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			got, ok := body["local_time"]
+			if tt.want == "" {
+				if ok {
+					t.Errorf("local_time = %v, deveria ser omitido", got)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("local_time = %v, esperado %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalTimeOnlyWhenRequested(t *testing.T) {
+	stubUpstreams(t, jsonHandler(viaCEPSaoPaulo),
+		jsonHandler(`{"location":{"localtime":"2024-01-15 14:30","tz_id":"America/Sao_Paulo"},"current":{"temp_c":25}}`))
+	r := chi.NewRouter()
+	registerRoutes(r)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/weather/01001000", nil))
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := body["local_time"]; ok {
+		t.Errorf("local_time só deveria existir com ?localtime=true: %s", rec.Body)
+	}
+}
+
+func TestDataAgeSeconds(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	tests := []struct {
+		name  string
+		epoch int64
+		want  int64 // -1 quando o campo deve ser omitido
+	}{
+		{"leitura há 15 minutos", now.Unix() - 900, 900},
+		{"leitura no instante atual", now.Unix(), 0},
+		{"leitura no futuro", now.Unix() + 60, 0},
+		{"sem instante", 0, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := dataAgeSeconds(tt.epoch, now)
+			if tt.want < 0 {
+				if got != nil {
+					t.Errorf("dataAgeSeconds(%d) = %d, esperado nil", tt.epoch, *got)
+				}
+				return
+			}
+			if got == nil || *got != tt.want {
+				t.Errorf("dataAgeSeconds(%d) = %v, esperado %d", tt.epoch, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDataAgeInResponse(t *testing.T) {
+	epoch := time.Now().Add(-10 * time.Minute).Unix()
+	for name, current := range map[string]string{
+		"com instante": `{"temp_c":25,"last_updated_epoch":` + strconv.FormatInt(epoch, 10) + `}`,
+		"sem instante": `{"temp_c":25}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			stubUpstreams(t, jsonHandler(viaCEPSaoPaulo), jsonHandler(`{"current":`+current+`}`))
+			r := chi.NewRouter()
+			registerRoutes(r)
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/weather/01001000", nil))
+			var body map[string]any
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			age, ok := body["data_age_seconds"].(float64)
+			if name == "sem instante" {
+				if ok {
+					t.Errorf("data_age_seconds = %v, deveria ser omitido", age)
+				}
+				return
+			}
+			if !ok || age < 600 || age > 605 {
+				t.Errorf("data_age_seconds = %v, esperado cerca de 600", body["data_age_seconds"])
+			}
+		})
+	}
+}
@@ -1,21 +1,32 @@
 package main
 
 import (
+	"Observabilidade/lifecycle"
+	"Observabilidade/logging"
+	"Observabilidade/signing"
 	trc "Observabilidade/tracer"
 	"context"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
 	net_url "net/url"
 	"regexp"
+	"strconv"
+	"strings"
 
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/contrib/instrumentation/runtime"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
 	"go.opentelemetry.io/otel/trace"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -23,23 +34,91 @@ import (
 
 // ViaCEPResponse é uma struct para receber a resposta da API ViaCEP
 type ViaCEPResponse struct {
-	Localidade string `json:"localidade"`
-	Erro       string `json:"erro"`
+	Localidade string `json:"localidade" xml:"localidade"`
+	UF         string `json:"uf" xml:"uf"`
+	Erro       string `json:"erro" xml:"erro"`
+	// Raw guarda o corpo original da resposta, para `?debug=raw`.
+	Raw json.RawMessage `json:"-"`
 }
 
 // WeatherAPIResponse é uma struct para receber a resposta da API WeatherAPI
 type WeatherAPIResponse struct {
-	Current struct {
+	Location WeatherAPILocation `json:"location"`
+	Current  struct {
 		TempC float64 `json:"temp_c"`
+		// LastUpdatedEpoch é o instante (Unix) da leitura; zero quando não é devolvido.
+		LastUpdatedEpoch int64 `json:"last_updated_epoch"`
 	} `json:"current"`
+	// Raw guarda o corpo original da resposta, para `?debug=raw`.
+	Raw json.RawMessage `json:"-"`
 }
 
-// FinalResponse é uma struct para a nossa resposta final
+// shutdownHooksTimeout é o prazo partilhado pelos hooks de encerramento.
+const shutdownHooksTimeout = 5 * time.Second
+
+// Chaves do baggage definidas pelo Serviço A: o ID do incidente e o CEP consultado.
+const (
+	incidentKey   = "incident.id"
+	cepBaggageKey = "cep"
+)
+
+// cepBaggageAttr é o atributo do span com o CEP recebido via baggage.
+const cepBaggageAttr = "baggage.cep"
+
+// maxSearchQueryLength limita o tamanho do nome da cidade aceite na pesquisa.
+const maxSearchQueryLength = 100
+
+// defaultDownstreamTimeout é o tempo máximo padrão de cada chamada às APIs externas.
+const defaultDownstreamTimeout = 5 * time.Second
+
+// sharedSecret é o segredo partilhado com o Serviço A para verificar a assinatura das
+// requisições. Vazio (padrão) desativa a verificação. É preenchido a partir de SERVICE_B_SHARED_SECRET.
+var sharedSecret []byte
+
+// traceContextMaxAge é a idade máxima do carimbo `obsts` que o Serviço A coloca no
+// `tracestate` (0 desativa). É preenchido em `main` a partir de TRACE_CONTEXT_MAX_AGE.
+var traceContextMaxAge time.Duration
+
+// defaultCEP é o CEP consultado por GET /weather. É preenchido em `main` a partir de DEFAULT_CEP.
+var defaultCEP string
+
+// Timeouts aplicados a cada chamada externa. São preenchidos em `main` a partir
+// das variáveis de ambiente, permitindo ajustar cada dependência de forma independente.
+var (
+	viaCEPTimeout  = defaultDownstreamTimeout
+	weatherTimeout = defaultDownstreamTimeout
+)
+
+// WeatherAPILocation é a localidade resolvida pela WeatherAPI. Todos os campos são
+// opcionais: quando ausentes na resposta, ficam vazios e são omitidos na resposta final.
+type WeatherAPILocation struct {
+	Name      string `json:"name,omitempty" xml:"name,omitempty"`
+	Region    string `json:"region,omitempty" xml:"region,omitempty"`
+	Country   string `json:"country,omitempty" xml:"country,omitempty"`
+	Localtime string `json:"localtime,omitempty" xml:"localtime,omitempty"`
+	TzID      string `json:"tz_id,omitempty" xml:"tz_id,omitempty"`
+}
+
+// FinalResponse é uma struct para a nossa resposta final, em JSON (padrão) ou XML
 type FinalResponse struct {
-	City  string  `json:"city"`
-	TempC float64 `json:"temp_C"`
-	TempF float64 `json:"temp_F"`
-	TempK float64 `json:"temp_K"`
+	XMLName xml.Name `json:"-" xml:"weather"`
+	City    string   `json:"city" xml:"city"`
+	TempC   float64  `json:"temp_C" xml:"temp_C"`
+	TempF   float64  `json:"temp_F" xml:"temp_F"`
+	TempK   float64  `json:"temp_K" xml:"temp_K"`
+	// LocalTime (RFC3339) só é preenchido com `?localtime=true` e quando a hora local
+	// e o fuso devolvidos pela WeatherAPI são válidos.
+	LocalTime string `json:"local_time,omitempty" xml:"local_time,omitempty"`
+	// DataAgeSeconds é a idade da leitura da WeatherAPI (`current.last_updated_epoch`),
+	// omitida quando a WeatherAPI não indica o instante da leitura.
+	DataAgeSeconds *int64 `json:"data_age_seconds,omitempty" xml:"data_age_seconds,omitempty"`
+	// Location só é preenchido na resposta detalhada (`?verbose=true`).
+	Location *WeatherAPILocation `json:"location,omitempty" xml:"location,omitempty"`
+	// Fallback indica que a resposta é o último valor conhecido do CEP (status 203),
+	// porque as APIs externas falharam (só com FALLBACK_ENABLED=true).
+	Fallback bool `json:"fallback,omitempty" xml:"fallback,omitempty"`
+	// Debug só é preenchido com `?debug=raw` e ENABLE_DEBUG_ENDPOINTS=true (apenas em JSON).
+	Debug *debugPayload `json:"_debug,omitempty" xml:"-"`
 }
 
 func main() {
@@ -50,109 +129,548 @@ func main() {
 		return
 	}
 
+	// Lemos o timeout global das chamadas externas e, a partir dele, os timeouts
+	// específicos do ViaCEP e da WeatherAPI, que por omissão herdam o valor global.
+	downstreamTimeout, err := durationFromEnv("DOWNSTREAM_TIMEOUT", defaultDownstreamTimeout)
+	if err != nil {
+		log.Fatalf("configuração inválida: %v", err)
+	}
+	if viaCEPTimeout, err = durationFromEnv("VIACEP_TIMEOUT", downstreamTimeout); err != nil {
+		log.Fatalf("configuração inválida: %v", err)
+	}
+	if weatherTimeout, err = durationFromEnv("WEATHER_TIMEOUT", downstreamTimeout); err != nil {
+		log.Fatalf("configuração inválida: %v", err)
+	}
+
+	// Com TRACE_INCLUDE_BODY_ON_ERROR=true, as falhas de decodificação das respostas externas
+	// incluem no span um excerto do corpo recebido.
+	if value := os.Getenv("TRACE_INCLUDE_BODY_ON_ERROR"); value != "" {
+		if includeBodyOnError, err = strconv.ParseBool(value); err != nil {
+			log.Fatalf("configuração inválida: TRACE_INCLUDE_BODY_ON_ERROR deve ser true ou false: %q", value)
+		}
+	}
+
+	// Cliente HTTP das chamadas externas, opcionalmente através de um proxy dedicado.
+	// As APIs externas não redirecionam, pelo que por omissão nenhum redirecionamento é seguido.
+	upstreamProxyURL := os.Getenv("UPSTREAM_PROXY_URL")
+	upstreamMaxRedirects := 0
+	if value := os.Getenv("UPSTREAM_MAX_REDIRECTS"); value != "" {
+		if upstreamMaxRedirects, err = strconv.Atoi(value); err != nil || upstreamMaxRedirects < 0 {
+			log.Fatalf("configuração inválida: UPSTREAM_MAX_REDIRECTS deve ser um inteiro não negativo: %q", value)
+		}
+	}
+	if upstreamClient, err = newUpstreamClient(upstreamProxyURL, upstreamMaxRedirects); err != nil {
+		log.Fatalf("configuração inválida: %v", err)
+	}
+
+	// Cliente da WeatherAPI. WEATHER_QUOTA_RESERVE define quantas chamadas manter de reserva
+	// quando a API indica a quota restante nos cabeçalhos da resposta.
+	quotaReserve := 0
+	if value := os.Getenv("WEATHER_QUOTA_RESERVE"); value != "" {
+		if quotaReserve, err = strconv.Atoi(value); err != nil || quotaReserve < 0 {
+			log.Fatalf("configuração inválida: WEATHER_QUOTA_RESERVE deve ser um inteiro não negativo: %q", value)
+		}
+	}
+	weatherAPI = newWeatherClient(upstreamClient, apiKey, quotaReserve)
+
+	// Circuit breakers independentes para o ViaCEP e a WeatherAPI: abrem após
+	// BREAKER_FAILURE_THRESHOLD falhas consecutivas (0 desativa) durante BREAKER_COOLDOWN.
+	breakerThreshold := defaultBreakerThreshold
+	if value := os.Getenv("BREAKER_FAILURE_THRESHOLD"); value != "" {
+		if breakerThreshold, err = strconv.Atoi(value); err != nil || breakerThreshold < 0 {
+			log.Fatalf("configuração inválida: BREAKER_FAILURE_THRESHOLD deve ser um inteiro não negativo: %q", value)
+		}
+	}
+	breakerCooldown, err := durationFromEnv("BREAKER_COOLDOWN", defaultBreakerCooldown)
+	if err != nil {
+		log.Fatalf("configuração inválida: %v", err)
+	}
+	viaCEPBreaker = newCircuitBreaker("viacep", breakerThreshold, breakerCooldown)
+	weatherBreaker = newCircuitBreaker("weatherapi", breakerThreshold, breakerCooldown)
+
+	// Com SERVICE_B_SHARED_SECRET, só aceitamos requisições assinadas pelo Serviço A.
+	sharedSecret = []byte(os.Getenv("SERVICE_B_SHARED_SECRET"))
+
+	// Com ENABLE_DEBUG_ENDPOINTS=true, `?debug=raw` inclui na resposta os corpos originais
+	// devolvidos pelo ViaCEP e pela WeatherAPI.
+	if value := os.Getenv("ENABLE_DEBUG_ENDPOINTS"); value != "" {
+		if debugEndpoints, err = strconv.ParseBool(value); err != nil {
+			log.Fatalf("configuração inválida: ENABLE_DEBUG_ENDPOINTS deve ser true ou false: %q", value)
+		}
+	}
+
+	// Formato pedido ao ViaCEP: json (padrão), xml ou piped.
+	if value := os.Getenv("VIACEP_FORMAT"); value != "" {
+		if _, ok := viaCEPParsers[value]; !ok {
+			log.Fatalf("configuração inválida: VIACEP_FORMAT deve ser json, xml ou piped: %q", value)
+		}
+		viaCEPFormat = value
+	}
+
+	// Tratamento de nomes de cidade com UTF-8 inválido: "replace" (padrão) ou "reject".
+	if value := os.Getenv("INVALID_UTF8_MODE"); value != "" {
+		if value != utf8ModeReplace && value != utf8ModeReject {
+			log.Fatalf("configuração inválida: INVALID_UTF8_MODE deve ser replace ou reject: %q", value)
+		}
+		invalidUTF8Mode = value
+	}
+
+	// Intervalo entre atualizações do stream SSE (GET /weather/{cep}/stream).
+	if streamInterval, err = durationFromEnv("STREAM_INTERVAL", defaultStreamInterval); err != nil {
+		log.Fatalf("configuração inválida: %v", err)
+	}
+
+	// Diferença entre o relógio do Serviço A e o local a partir da qual é reportada.
+	if clockSkewThreshold, err = durationFromEnv("CLOCK_SKEW_THRESHOLD", defaultClockSkewThreshold); err != nil {
+		log.Fatalf("configuração inválida: %v", err)
+	}
+
+	// Idade máxima do contexto de trace recebido do Serviço A, validada pelo carimbo que
+	// este coloca no `tracestate` (ver trc.TraceAgePropagators). Desativada por omissão.
+	if traceContextMaxAge, err = durationFromEnv("TRACE_CONTEXT_MAX_AGE", 0); err != nil {
+		log.Fatalf("configuração inválida: %v", err)
+	}
+
+	// Com VALIDATE_RESPONSE=true, uma resposta sem cidade ou com uma temperatura
+	// implausível é recusada com 502, em vez de devolver dados errados.
+	if value := os.Getenv("VALIDATE_RESPONSE"); value != "" {
+		if validateResponses, err = strconv.ParseBool(value); err != nil {
+			log.Fatalf("configuração inválida: VALIDATE_RESPONSE deve ser true ou false: %q", value)
+		}
+	}
+
+	// Com ENFORCE_CONTENT_LENGTH=false, as respostas deixam de levar o `Content-Length`.
+	if value := os.Getenv("ENFORCE_CONTENT_LENGTH"); value != "" {
+		if enforceContentLength, err = strconv.ParseBool(value); err != nil {
+			log.Fatalf("configuração inválida: ENFORCE_CONTENT_LENGTH deve ser true ou false: %q", value)
+		}
+	}
+
+	// CEP usado por GET /weather, sem CEP no caminho. Vazio por omissão.
+	defaultCEP = os.Getenv("DEFAULT_CEP")
+	if defaultCEP != "" && !isValidCEP(defaultCEP) {
+		log.Fatalf("configuração inválida: DEFAULT_CEP deve ter 8 dígitos: %q", defaultCEP)
+	}
+
+	// Com WARMUP_CONNECTIONS=true, abrimos em segundo plano ligações às APIs externas, para
+	// que a primeira requisição real não pague o handshake TLS. Falhas apenas são registadas.
+	warmup := false
+	if value := os.Getenv("WARMUP_CONNECTIONS"); value != "" {
+		if warmup, err = strconv.ParseBool(value); err != nil {
+			log.Fatalf("configuração inválida: WARMUP_CONNECTIONS deve ser true ou false: %q", value)
+		}
+	}
+	if warmup {
+		go warmupConnections(upstreamClient, viaCEPBaseURL, weatherAPIBaseURL)
+	}
+
+	// Com FALLBACK_ENABLED=true, quando as APIs externas falham, o Serviço B responde com
+	// o último valor bom conhecido do CEP (203 e `fallback=true`) em vez de um erro.
+	if value := os.Getenv("FALLBACK_ENABLED"); value != "" {
+		if fallbackEnabled, err = strconv.ParseBool(value); err != nil {
+			log.Fatalf("configuração inválida: FALLBACK_ENABLED deve ser true ou false: %q", value)
+		}
+	}
+
+	// Com GEOCODE_ENABLED=true, a WeatherAPI é consultada pelas coordenadas da cidade
+	// (obtidas pelo geocoder) em vez do nome, evitando confusões entre cidades homónimas.
+	geocodeEnabled := false
+	if value := os.Getenv("GEOCODE_ENABLED"); value != "" {
+		if geocodeEnabled, err = strconv.ParseBool(value); err != nil {
+			log.Fatalf("configuração inválida: GEOCODE_ENABLED deve ser true ou false: %q", value)
+		}
+	}
+	if geocodeEnabled {
+		geocoder = weatherAPIGeocoder{client: weatherAPI}
+	}
+
 	// Configuração do OpenTelemetry, idêntica à do Serviço A,
 	// mas identificando-se como "service-b".
 	collectorURL := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
 	if collectorURL == "" {
 		collectorURL = "localhost:4317"
 	}
+
+	// Porta de escuta: SERVICE_B_PORT ou PORT (por omissão, 8081).
+	port, err := portFromEnv("SERVICE_B_PORT", "PORT", "8081")
+	if err != nil {
+		log.Fatalf("configuração inválida: %v", err)
+	}
+
+	// Registo de acesso apenas das requisições lentas (SLOW_REQUEST_LOG_MS, desativado por omissão).
+	slowRequestThreshold, err := logging.SlowRequestThresholdFromEnv()
+	if err != nil {
+		log.Fatalf("configuração inválida: %v", err)
+	}
+	logging.SetSlowRequestThreshold(slowRequestThreshold)
+
+	// Registamos a configuração efetiva com que o serviço arrancou. A chave da API é
+	// ocultada automaticamente pelo pacote `logging`.
+	logging.LogEffectiveConfig("service-b", map[string]string{
+		"WEATHER_API_KEY":             apiKey,
+		"OTEL_EXPORTER_OTLP_ENDPOINT": collectorURL,
+		"DOWNSTREAM_TIMEOUT":          downstreamTimeout.String(),
+		"VIACEP_TIMEOUT":              viaCEPTimeout.String(),
+		"VIACEP_FORMAT":               viaCEPFormat,
+		"WEATHER_TIMEOUT":             weatherTimeout.String(),
+		"UPSTREAM_PROXY_URL":          redactedURL(upstreamProxyURL),
+		"UPSTREAM_MAX_REDIRECTS":      strconv.Itoa(upstreamMaxRedirects),
+		"TRACE_INCLUDE_BODY_ON_ERROR": strconv.FormatBool(includeBodyOnError),
+		"WEATHER_QUOTA_RESERVE":       strconv.Itoa(quotaReserve),
+		"WARMUP_CONNECTIONS":          strconv.FormatBool(warmup),
+		"GEOCODE_ENABLED":             strconv.FormatBool(geocodeEnabled),
+		"FALLBACK_ENABLED":            strconv.FormatBool(fallbackEnabled),
+		"DEFAULT_CEP":                 defaultCEP,
+		"PORT":                        port,
+		"SLOW_REQUEST_LOG_MS":         strconv.FormatInt(slowRequestThreshold.Milliseconds(), 10),
+		"SERVICE_B_SHARED_SECRET":     string(sharedSecret),
+		"STREAM_INTERVAL":             streamInterval.String(),
+		"CLOCK_SKEW_THRESHOLD":        clockSkewThreshold.String(),
+		"TRACE_CONTEXT_MAX_AGE":       traceContextMaxAge.String(),
+		"ENFORCE_CONTENT_LENGTH":      strconv.FormatBool(enforceContentLength),
+		"VALIDATE_RESPONSE":           strconv.FormatBool(validateResponses),
+		"INVALID_UTF8_MODE":           invalidUTF8Mode,
+		"ENABLE_DEBUG_ENDPOINTS":      strconv.FormatBool(debugEndpoints),
+		"BREAKER_FAILURE_THRESHOLD":   strconv.Itoa(breakerThreshold),
+		"BREAKER_COOLDOWN":            breakerCooldown.String(),
+	})
+
 	tp, err := trc.InitTracerProvider("service-b", collectorURL)
 	if err != nil {
 		log.Fatalf("falha ao inicializar tracer provider: %v", err)
 	}
 	defer func() {
-		if err := tp.Shutdown(context.Background()); err != nil {
-			log.Printf("erro ao desligar tracer provider: %v", err)
+		// Antes de desligar o tracer provider, executamos os hooks de encerramento
+		// registados pelos outros componentes, com um prazo partilhado.
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownHooksTimeout)
+		defer cancel()
+		if err := lifecycle.Shutdown(ctx); err != nil {
+			log.Printf("erro ao executar hooks de encerramento: %v", err)
 		}
+		// O prazo evita que um coletor que não responde bloqueie o fim do processo;
+		// o erro já é registado por ShutdownWithTimeout.
+		_ = trc.ShutdownWithTimeout(tp, trc.DefaultShutdownTimeout)
 	}()
 
+	// Métricas, enviadas ao mesmo coletor dos traces. O envio das métricas pendentes é
+	// feito como hook de encerramento, antes de o tracer provider ser desligado.
+	mp, err := trc.InitMeterProvider("service-b", collectorURL)
+	if err != nil {
+		log.Fatalf("falha ao inicializar meter provider: %v", err)
+	}
+	lifecycle.RegisterShutdownHook(mp.Shutdown)
+	// Métricas do runtime do Go (goroutines, memória, GC), lidas em cada exportação, a cada
+	// OTEL_METRIC_EXPORT_INTERVAL, para detetar fugas de goroutines ou de memória.
+	if err := runtime.Start(); err != nil {
+		log.Fatalf("falha ao iniciar as métricas do runtime: %v", err)
+	}
+
 	// Cria um router usando o Chi
 	r := chi.NewRouter()
-	r.Use(middleware.Logger) // Middleware para logar as requisições
-
-	// Define a rota e o handler correspondente
-	r.Get("/weather/{cep}", GetWeatherHandler)
+	r.Use(middleware.RequestID) // Reaproveita o request ID enviado pelo Serviço A
+	// Audita as respostas 4xx e 5xx de todas as rotas, incluindo os 404 e 405 do Chi.
+	r.Use(logging.AuditMiddleware)
+	// Com SLOW_REQUEST_LOG_MS, o log de acesso do Chi dá lugar ao de `logging.Middleware`,
+	// que só regista (em WARN) as requisições mais lentas do que o limiar.
+	if slowRequestThreshold == 0 {
+		r.Use(middleware.Logger) // Middleware para logar as requisições
+	}
 
-	// O middleware do OTEL irá extrair o contexto de trace dos cabeçalhos da requisição
-	// vinda do Serviço A e criar um span filho, continuando o trace distribuído.
-	otelHandler := otelhttp.NewHandler(http.HandlerFunc(GetWeatherHandler), "WeatherHandler")
-	r.Handle("/weather/{cep}", otelHandler)
+	registerRoutes(r)
 
-	fmt.Println("Serviço B está a correr na porta 8081...")
-	err = http.ListenAndServe(":8081", r)
+	ln, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		log.Fatalf("falha ao escutar na porta %s: %v", port, err)
+	}
+	fmt.Printf("Serviço B está a correr em %s...\n", ln.Addr())
+	// Em SIGINT/SIGTERM, o servidor termina as requisições em curso antes de retornar;
+	// só depois os `defer` acima enviam os spans pendentes.
+	err = lifecycle.Serve(ln, r, lifecycle.DefaultGracePeriod)
 	if err != nil {
-		fmt.Println("Erro ao iniciar o servidor:", err)
+		fmt.Println("Erro no servidor:", err)
 		return
 	}
 }
 
+// registerRoutes regista as rotas do serviço. Cada rota é registada uma única vez, já
+// instrumentada. O middleware do OTEL irá extrair o contexto de trace dos cabeçalhos da
+// requisição vinda do Serviço A e criar um span filho, continuando o trace distribuído.
+func registerRoutes(r chi.Router) {
+	r.Method(http.MethodGet, "/weather/{cep}", instrument(GetWeatherHandler, "WeatherHandler"))
+
+	// Atualizações contínuas do clima de um CEP, via Server-Sent Events.
+	r.Method(http.MethodGet, "/weather/{cep}/stream", instrument(StreamWeatherHandler, "StreamWeatherHandler"))
+
+	// GET /weather, sem CEP, usa o DEFAULT_CEP (ou responde 400 se não estiver definido).
+	r.Method(http.MethodGet, "/weather", instrument(DefaultWeatherHandler, "DefaultWeatherHandler"))
+
+	// Pesquisa por cidade (e país), fora do fluxo do CEP. Por ser uma rota estática,
+	// o Chi dá-lhe prioridade sobre o parâmetro `{cep}`.
+	r.Method(http.MethodGet, "/weather/search", instrument(SearchWeatherHandler, "SearchWeatherHandler"))
+
+	// Pedidos de favicon dos browsers: 204, sem instrumentação, para não gerar spans de ruído.
+	r.Get("/favicon.ico", faviconHandler)
+}
+
+// instrument envolve o handler com o middleware do OTEL, que cria o span do servidor com o
+// nome de operação indicado, com `logging.Middleware`, que coloca no contexto um logger
+// com os campos de correlação da requisição, com a deteção de diferenças de relógio
+// (`X-Sent-At`) e com a verificação da assinatura do Serviço A.
+// Com ENABLE_DEBUG_ENDPOINTS=true, a resposta indica ainda se o trace foi amostrado. A
+// duração de cada requisição é registada no histograma `http.server.duration` e, com
+// DEBUG_SAMPLING=true, a decisão de amostragem é registada com o logger da requisição.
+func instrument(h http.HandlerFunc, operation string) http.Handler {
+	verify := signing.Middleware(sharedSecret, signing.DefaultMaxSkew)
+	handler := logging.Middleware(trc.SamplingLogMiddleware(clockSkewMiddleware(verify(h))))
+	if debugEndpoints {
+		handler = trc.SampledHeaderMiddleware(handler)
+	}
+	otelHandler := otelhttp.NewHandler(trc.DurationMiddleware(handler), operation, serverTraceOptions()...)
+	return trc.SamplingDecisionMiddleware(otelHandler)
+}
+
+// serverTraceOptions devolve as opções do middleware do OTEL. Com TRACE_CONTEXT_MAX_AGE
+// definido, um contexto recebido com o carimbo `obsts` expirado é descartado e a
+// requisição inicia um trace novo.
+func serverTraceOptions() []otelhttp.Option {
+	if traceContextMaxAge <= 0 {
+		return nil
+	}
+	return []otelhttp.Option{otelhttp.WithPropagators(trc.TraceAgePropagators(traceContextMaxAge))}
+}
+
+// faviconHandler responde 204 (sem conteúdo) aos pedidos de favicon dos browsers.
+func faviconHandler(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // GetWeatherHandler é o handler principal que orquestra as chamadas
 func GetWeatherHandler(w http.ResponseWriter, r *http.Request) {
+	// Obtém o CEP do parâmetro da URL
+	cep := chi.URLParam(r, "cep")
+	trc.LogInfo(r.Context(), "consulta de clima recebida", "cep", cep)
+	serveWeather(w, r, cep)
+}
+
+// DefaultWeatherHandler responde a GET /weather (sem CEP) com o clima do DEFAULT_CEP,
+// útil para demonstrações e smoke tests. Sem DEFAULT_CEP, pede ao cliente um CEP.
+func DefaultWeatherHandler(w http.ResponseWriter, r *http.Request) {
+	if defaultCEP == "" {
+		writeError(w, r, http.StatusBadRequest, "zipcode required: use /weather/{cep}")
+		return
+	}
+	serveWeather(w, r, defaultCEP)
+}
+
+// serveWeather executa o fluxo completo (ViaCEP e WeatherAPI) para o CEP indicado.
+func serveWeather(w http.ResponseWriter, r *http.Request, cep string) {
 	ctx := r.Context()
 	// Obtemos uma instância do tracer para criar spans personalizados.
 	tracer := otel.Tracer("service-b-tracer")
 
-	// Obtém o CEP do parâmetro da URL
-	cep := chi.URLParam(r, "cep")
 	if !isValidCEP(cep) {
-		http.Error(w, "invalid zipcode", http.StatusUnprocessableEntity)
+		writeError(w, r, http.StatusUnprocessableEntity, "invalid zipcode")
 		return
 	}
 
 	// Obtemos o span atual a partir do contexto para adicionar atributos a ele.
 	span := trace.SpanFromContext(ctx)
 	span.SetAttributes(attribute.String("cep", cep))
+	annotateBaggage(ctx)
+	ctx = logging.With(ctx, "cep", cep)
 
 	// Busca a localização (cidade) usando o ViaCEP
 	location, err := fetchLocation(ctx, tracer, cep)
 	if err != nil {
-		if err.Error() == "can not find zipcode" {
-			http.Error(w, "can not find zipcode", http.StatusNotFound)
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+		writeFetchErrorOrFallback(w, r, cep, err)
 		return
 	}
 
-	// Busca a temperatura usando a WeatherAPI
-	weather, err := fetchWeather(ctx, tracer, location.Localidade)
+	// Busca a temperatura usando a WeatherAPI (pelas coordenadas, com GEOCODE_ENABLED)
+	weather, err := fetchWeather(ctx, tracer, weatherQuery(ctx, tracer, location))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeFetchErrorOrFallback(w, r, cep, err)
 		return
 	}
 
-	// Calcula as temperaturas em Fahrenheit e Kelvin
-	tempC := weather.Current.TempC
-	tempF := tempC*1.8 + 32
-	tempK := tempC + 273
+	// A WeatherAPI resolve a localidade de forma independente; se o nome divergir do
+	// devolvido pelo ViaCEP, registamos um evento no span para facilitar a análise.
+	reconcileLocation(ctx, location.Localidade, weather.Location)
 
-	// Monta a resposta final
-	response := FinalResponse{
-		City:  location.Localidade,
-		TempC: tempC,
-		TempF: tempF,
-		TempK: tempK,
+	// Monta a resposta final e envia-a ao cliente
+	response := newFinalResponse(location.Localidade, weather.Current.TempC)
+	if rejectInvalidResponse(w, r, response) {
+		return
+	}
+	if fallbackEnabled {
+		lastKnown.remember(cep, lastKnownWeather{
+			city:             location.Localidade,
+			tempC:            weather.Current.TempC,
+			lastUpdatedEpoch: weather.Current.LastUpdatedEpoch,
+			storedAt:         time.Now(),
+		})
+	}
+	response.DataAgeSeconds = dataAgeSeconds(weather.Current.LastUpdatedEpoch, time.Now())
+	if wantsLocalTime(r) {
+		response.LocalTime = localTimeRFC3339(weather.Location.Localtime, weather.Location.TzID)
+	}
+	if wantsVerbose(r) {
+		response.Location = &weather.Location
+	}
+	if wantsRawDebug(r) {
+		response.Debug = &debugPayload{ViaCEP: location.Raw, WeatherAPI: weather.Raw}
+	}
+	writeResponse(w, r, http.StatusOK, response)
+}
+
+// SearchWeatherHandler consulta a temperatura diretamente pelo nome da cidade
+// (e, opcionalmente, pelo código do país), sem passar pelo fluxo do CEP.
+// Ex: GET /weather/search?q=Paris&country=FR
+func SearchWeatherHandler(w http.ResponseWriter, r *http.Request) {
+	tracer := otel.Tracer("service-b-tracer")
+
+	annotateBaggage(r.Context())
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	country := strings.TrimSpace(r.URL.Query().Get("country"))
+	if query == "" || len(query) > maxSearchQueryLength {
+		writeError(w, r, http.StatusUnprocessableEntity, "invalid search query")
+		return
+	}
+	if country != "" && !isValidCountryCode(country) {
+		writeError(w, r, http.StatusUnprocessableEntity, "invalid country code")
+		return
+	}
+
+	// Criamos um span próprio para a pesquisa, onde ficará aninhada a chamada à WeatherAPI.
+	ctx, span := tracer.Start(r.Context(), "searchWeather")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("search.query", query),
+		attribute.String("search.country", country),
+	)
+
+	// A WeatherAPI aceita "cidade,país" no parâmetro `q`, o que desambigua cidades homónimas.
+	location := query
+	if country != "" {
+		location = query + "," + strings.ToUpper(country)
 	}
 
-	// Define o cabeçalho como JSON e envia a resposta
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	err = json.NewEncoder(w).Encode(response)
+	weather, err := fetchWeather(ctx, tracer, location)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		span.RecordError(err)
+		writeFetchError(w, r, err)
+		return
+	}
+
+	response := newFinalResponse(query, weather.Current.TempC)
+	if rejectInvalidResponse(w, r, response) {
+		return
+	}
+	response.DataAgeSeconds = dataAgeSeconds(weather.Current.LastUpdatedEpoch, time.Now())
+	if wantsLocalTime(r) {
+		response.LocalTime = localTimeRFC3339(weather.Location.Localtime, weather.Location.TzID)
+	}
+	if wantsVerbose(r) {
+		response.Location = &weather.Location
+	}
+	if wantsRawDebug(r) {
+		response.Debug = &debugPayload{WeatherAPI: weather.Raw}
+	}
+	writeResponse(w, r, http.StatusOK, response)
+}
+
+// annotateBaggage copia para o span atual o ID do incidente e o CEP recebidos via
+// baggage, permitindo filtrar no backend todos os traces relacionados com um incidente
+// e correlacionar os spans dos dois serviços pelo CEP, independentemente da URL.
+func annotateBaggage(ctx context.Context) {
+	bag := baggage.FromContext(ctx)
+	span := trace.SpanFromContext(ctx)
+	if incidentID := bag.Member(incidentKey).Value(); incidentID != "" {
+		span.SetAttributes(attribute.String(incidentKey, incidentID))
+	}
+	if cep := bag.Member(cepBaggageKey).Value(); cep != "" {
+		span.SetAttributes(attribute.String(cepBaggageAttr, cep))
+	}
+}
+
+// reconcileLocation compara a cidade do ViaCEP com a localidade resolvida pela WeatherAPI
+// e regista o evento `location.mismatch` no span atual quando os nomes divergem. A
+// comparação ignora maiúsculas e acentos ("São Paulo" e "Sao Paulo" são equivalentes).
+func reconcileLocation(ctx context.Context, viaCEPCity string, weatherLocation WeatherAPILocation) {
+	if weatherLocation.Name == "" {
 		return
 	}
+	if strings.EqualFold(foldAccents(viaCEPCity), foldAccents(weatherLocation.Name)) {
+		return
+	}
+	trace.SpanFromContext(ctx).AddEvent("location.mismatch", trace.WithAttributes(
+		attribute.String("viacep.city", viaCEPCity),
+		attribute.String("weatherapi.name", weatherLocation.Name),
+		attribute.String("weatherapi.region", weatherLocation.Region),
+		attribute.String("weatherapi.country", weatherLocation.Country),
+	))
+	logging.LoggerFromContext(ctx).Warn("localidade divergente entre ViaCEP e WeatherAPI",
+		"viacep_city", viaCEPCity, "weatherapi_name", weatherLocation.Name)
+}
+
+// accentReplacer remove os acentos mais comuns em nomes de cidades em português.
+var accentReplacer = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ã", "a", "ä", "a",
+	"é", "e", "ê", "e", "è", "e", "ë", "e",
+	"í", "i", "î", "i", "ì", "i", "ï", "i",
+	"ó", "o", "ô", "o", "õ", "o", "ò", "o", "ö", "o",
+	"ú", "u", "û", "u", "ù", "u", "ü", "u",
+	"ç", "c", "ñ", "n",
+	"Á", "A", "À", "A", "Â", "A", "Ã", "A", "Ä", "A",
+	"É", "E", "Ê", "E", "È", "E", "Ë", "E",
+	"Í", "I", "Î", "I", "Ì", "I", "Ï", "I",
+	"Ó", "O", "Ô", "O", "Õ", "O", "Ò", "O", "Ö", "O",
+	"Ú", "U", "Û", "U", "Ù", "U", "Ü", "U",
+	"Ç", "C", "Ñ", "N",
+)
+
+// foldAccents devolve o texto sem acentos e sem espaços nas extremidades.
+func foldAccents(s string) string {
+	return strings.TrimSpace(accentReplacer.Replace(s))
+}
+
+// newFinalResponse calcula as temperaturas em Fahrenheit e Kelvin e monta a resposta final.
+func newFinalResponse(city string, tempC float64) FinalResponse {
+	return FinalResponse{
+		City:  city,
+		TempC: tempC,
+		TempF: tempC*1.8 + 32,
+		TempK: tempC + 273,
+	}
 }
 
 // fetchLocation busca a cidade com base no CEP
-func fetchLocation(ctx context.Context, tr trace.Tracer, cep string) (*ViaCEPResponse, error) {
+func fetchLocation(ctx context.Context, tr trace.Tracer, cep string) (_ *ViaCEPResponse, err error) {
 	// Criamos um novo span filho chamado "fetchLocation-viacep".
 	// Este span aparecerá aninhado dentro do span "WeatherHandler" do Serviço B no Zipkin.
 	ctx, span := tr.Start(ctx, "fetchLocation-viacep")
 	defer span.End() // Garante que o span seja finalizado ao sair da função.
+	logger := logging.LoggerFromContext(ctx).With("provider", "viacep")
+
+	// Com o circuito aberto, nem chegamos a chamar o ViaCEP.
+	if err := viaCEPBreaker.allow(span); err != nil {
+		recordFailure(span, err)
+		logger.Warn("circuit breaker do ViaCEP aberto")
+		return nil, err
+	}
+	defer func() {
+		viaCEPBreaker.record(span, err)
+		recordDownstreamError(ctx, "viacep", err)
+	}()
+
+	// Limitamos o tempo da chamada ao ViaCEP. Como o novo contexto deriva do contexto
+	// da requisição, o prazo efetivo nunca ultrapassa o prazo geral da requisição.
+	ctx, cancel := context.WithTimeout(ctx, viaCEPTimeout)
+	defer cancel()
 
 	// Monta a URL da API ViaCEP
-	url := fmt.Sprintf("https://viacep.com.br/ws/%s/json/", cep)
+	url := fmt.Sprintf("%s/ws/%s/%s/", viaCEPBaseURL, cep, viaCEPFormat)
 
 	// Usamos `http.NewRequestWithContext` para garantir que o contexto do nosso trace
 	// (e qualquer prazo ou cancelamento) seja propagado para a chamada HTTP.
@@ -161,84 +679,172 @@ func fetchLocation(ctx context.Context, tr trace.Tracer, cep string) (*ViaCEPRes
 		return nil, err
 	}
 
-	// Executamos a requisição usando o cliente HTTP padrão.
-	resp, err := http.DefaultClient.Do(req)
+	// Executamos a requisição usando o cliente HTTP partilhado das chamadas externas.
+	resp, err := upstreamClient.Do(req)
 	if err != nil {
 		// Se houver um erro de rede ou na chamada, retornamos.
-		return nil, err
+		upErr := newUpstreamError("viacep", 0, err)
+		recordFailure(span, upErr)
+		logger.Error("erro ao consultar o ViaCEP", "error", upErr)
+		return nil, upErr
 	}
 	// `defer resp.Body.Close()` é uma prática padrão para garantir que a conexão seja fechada.
 	defer resp.Body.Close()
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
 
 	// Lemos todo o corpo da resposta.
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		upErr := newUpstreamError("viacep", resp.StatusCode, err)
+		recordFailure(span, upErr)
+		return nil, upErr
 	}
 
-	// Converte o JSON para a struct
-	var viaCEPResponse ViaCEPResponse
-	if err = json.Unmarshal(body, &viaCEPResponse); err != nil {
-		return nil, err
+	// Qualquer status fora da faixa 2xx é tratado como uma falha do ViaCEP.
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		upErr := newUpstreamError("viacep", resp.StatusCode, errors.New(http.StatusText(resp.StatusCode)))
+		recordFailure(span, upErr)
+		logger.Error("status inesperado do ViaCEP", "status", resp.StatusCode)
+		return nil, upErr
+	}
+
+	// Converte a resposta, no formato configurado, para a struct
+	viaCEPResponse, err := viaCEPParsers[viaCEPFormat](body)
+	if err != nil {
+		recordDecodeError(span, "viacep", err, body)
+		return nil, newUpstreamError("viacep", resp.StatusCode, err)
 	}
 
+	viaCEPResponse.Raw = rawViaCEPBody(body)
+
 	// Verifica se o ViaCEP retornou um erro (CEP não encontrado)
 	if viaCEPResponse.Erro == "true" {
-		return nil, fmt.Errorf("can not find zipcode")
+		logger.Info("CEP não encontrado no ViaCEP")
+		return nil, ErrZipcodeNotFound
 	}
 
+	// Um nome de cidade mal codificado é uma falha do ViaCEP (502) quando não é corrigido.
+	if viaCEPResponse.Localidade, err = sanitizeCity(span, viaCEPResponse.Localidade); err != nil {
+		upErr := newUpstreamError("viacep", resp.StatusCode, err)
+		recordFailure(span, upErr)
+		logger.Error("nome de cidade inválido devolvido pelo ViaCEP", "error", err)
+		return nil, upErr
+	}
+
+	logger.Info("localidade obtida do ViaCEP", "city", viaCEPResponse.Localidade)
 	return &viaCEPResponse, nil
 }
 
 // fetchWeather busca a temperatura com base na cidade
-func fetchWeather(ctx context.Context, tr trace.Tracer, city string) (*WeatherAPIResponse, error) {
+func fetchWeather(ctx context.Context, tr trace.Tracer, city string) (_ *WeatherAPIResponse, err error) {
 	// Criamos outro span filho, desta vez para a chamada à WeatherAPI.
 	// No Zipkin, ele aparecerá no mesmo nível que o span `fetchLocation-viacep`.
 	ctx, span := tr.Start(ctx, "fetchWeather-weatherapi")
 	defer span.End()
+	logger := logging.LoggerFromContext(ctx).With("provider", "weatherapi")
 
-	// Obtém a chave da API das variáveis de ambiente
-	apiKey := os.Getenv("WEATHER_API_KEY")
-	if apiKey == "" {
-		return nil, fmt.Errorf("WEATHER_API_KEY não definida")
+	// Validamos a cidade antes de a usar na query, para não enviar bytes inválidos.
+	if city, err = sanitizeCity(span, city); err != nil {
+		recordFailure(span, err)
+		return nil, err
 	}
 
-	// A função url.QueryEscape garante que caracteres especiais na cidade (como espaços ou acentos)
-	// sejam codificados corretamente para a URL. Ex: "São Paulo" -> "S%C3%A3o%20Paulo"
-	encodedCity := net_url.QueryEscape(city)
-
-	// Monta a URL da API WeatherAPI
-	url := fmt.Sprintf("http://api.weatherapi.com/v1/current.json?key=%s&q=%s&aqi=no", apiKey, encodedCity)
-
-	// Novamente, usamos `http.NewRequestWithContext` para propagar o trace.
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
+	if err := weatherBreaker.allow(span); err != nil {
+		recordFailure(span, err)
+		logger.Warn("circuit breaker da WeatherAPI aberto")
 		return nil, err
 	}
+	defer func() {
+		weatherBreaker.record(span, err)
+		recordDownstreamError(ctx, "weatherapi", err)
+	}()
 
-	resp, err := http.DefaultClient.Do(req)
+	// Tal como no ViaCEP, aplicamos um timeout próprio à chamada à WeatherAPI.
+	ctx, cancel := context.WithTimeout(ctx, weatherTimeout)
+	defer cancel()
+
+	// Todas as chamadas à WeatherAPI passam pelo `weatherAPI`, que acrescenta a chave da API
+	// e respeita a quota. Os valores da query string (como acentos e espaços na cidade) são
+	// codificados por ele. Ex: "São Paulo" -> "S%C3%A3o+Paulo"
+	resp, err := weatherAPI.get(ctx, "/v1/current.json", net_url.Values{
+		"q":   {city},
+		"aqi": {"no"},
+	})
 	if err != nil {
+		recordFailure(span, err)
+		logger.Error("erro ao consultar a WeatherAPI", "city", city, "error", err)
 		return nil, err
 	}
 	defer resp.Body.Close()
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
 
 	// Lê o corpo da resposta
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("erro ao ler resposta da WeatherAPI: %w", err)
+		upErr := newUpstreamError("weatherapi", resp.StatusCode, fmt.Errorf("erro ao ler resposta da WeatherAPI: %w", err))
+		recordFailure(span, upErr)
+		return nil, upErr
+	}
+
+	// Qualquer status fora da faixa 2xx é tratado como uma falha da WeatherAPI.
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		upErr := newUpstreamError("weatherapi", resp.StatusCode, errors.New(http.StatusText(resp.StatusCode)))
+		recordFailure(span, upErr)
+		logger.Error("status inesperado da WeatherAPI", "city", city, "status", resp.StatusCode)
+		return nil, upErr
 	}
 
 	// Converte o JSON para a struct
 	var weatherAPIResponse WeatherAPIResponse
 	if err = json.Unmarshal(body, &weatherAPIResponse); err != nil {
-		return nil, fmt.Errorf("erro ao decodificar JSON da WeatherAPI: %w", err)
+		recordDecodeError(span, "weatherapi", err, body)
+		return nil, newUpstreamError("weatherapi", resp.StatusCode, fmt.Errorf("erro ao decodificar JSON da WeatherAPI: %w", err))
 	}
 
+	weatherAPIResponse.Raw = body
+
+	logger.Info("temperatura obtida da WeatherAPI", "city", city, "temp_c", weatherAPIResponse.Current.TempC)
 	return &weatherAPIResponse, nil
 }
 
+// portFromEnv lê a porta de escuta da primeira variável de ambiente definida entre as
+// indicadas, devolvendo o valor padrão quando nenhuma está definida.
+func portFromEnv(key, fallbackKey, fallback string) (string, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		key, value = fallbackKey, os.Getenv(fallbackKey)
+	}
+	if value == "" {
+		return fallback, nil
+	}
+	if n, err := strconv.Atoi(value); err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("%s deve ser uma porta entre 1 e 65535: %q", key, value)
+	}
+	return value, nil
+}
+
 func isValidCEP(cep string) bool {
 	// A expressão regular ^[0-9]{8}$ verifica o formato completo.
 	match, _ := regexp.MatchString("^[0-9]{8}$", cep)
 	return match
 }
+
+// isValidCountryCode valida se o país é um código ISO 3166-1 alfa-2 (ex: "FR", "br").
+func isValidCountryCode(country string) bool {
+	match, _ := regexp.MatchString("^[A-Za-z]{2}$", country)
+	return match
+}
+
+// durationFromEnv lê uma duração (ex: "2s", "500ms") da variável de ambiente indicada,
+// devolvendo o valor padrão quando a variável não está definida.
+func durationFromEnv(key string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%s deve ser uma duração positiva (ex: 2s, 500ms): %q", key, value)
+	}
+	return d, nil
+}
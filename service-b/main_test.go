@@ -0,0 +1,404 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	net_url "net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// testTracer é o tracer passado às funções de busca quando os spans não interessam.
+var testTracer = noop.NewTracerProvider().Tracer("test")
+
+// stubUpstreams faz com que as chamadas ao ViaCEP e à WeatherAPI sejam atendidas pelos
+// handlers indicados, através de servidores locais, durante o teste. Os circuit breakers
+// são também substituídos, para que as falhas de um teste não afetem os seguintes.
+func stubUpstreams(t *testing.T, viaCEP, weather http.Handler) {
+	t.Helper()
+	hosts := map[string]string{}
+	for host, handler := range map[string]http.Handler{"viacep.com.br": viaCEP, "api.weatherapi.com": weather} {
+		if handler == nil {
+			continue
+		}
+		srv := httptest.NewServer(handler)
+		t.Cleanup(srv.Close)
+		u, _ := net_url.Parse(srv.URL)
+		hosts[host] = u.Host
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	t.Cleanup(transport.CloseIdleConnections)
+	client := &http.Client{Transport: rewriteHost{hosts: hosts, next: transport}}
+
+	oldClient, oldWeather := upstreamClient, weatherAPI
+	oldViaCEPBreaker, oldWeatherBreaker := viaCEPBreaker, weatherBreaker
+	t.Cleanup(func() {
+		upstreamClient, weatherAPI = oldClient, oldWeather
+		viaCEPBreaker, weatherBreaker = oldViaCEPBreaker, oldWeatherBreaker
+	})
+	upstreamClient = client
+	weatherAPI = newWeatherClient(client, "test-key", 0)
+	viaCEPBreaker = newCircuitBreaker("viacep", 0, time.Minute)
+	weatherBreaker = newCircuitBreaker("weatherapi", 0, time.Minute)
+}
+
+// rewriteHost encaminha as requisições para os servidores locais que substituem as APIs.
+type rewriteHost struct {
+	hosts map[string]string
+	next  http.RoundTripper
+}
+
+func (rt rewriteHost) RoundTrip(req *http.Request) (*http.Response, error) {
+	host, ok := rt.hosts[req.URL.Hostname()]
+	if !ok {
+		return nil, errors.New("API externa não substituída no teste: " + req.URL.Host)
+	}
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = "http", host
+	return rt.next.RoundTrip(req)
+}
+
+// jsonHandler responde 200 com o corpo JSON indicado.
+func jsonHandler(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}
+}
+
+// slowHandler responde com o corpo indicado depois de `delay`, ou desiste quando o
+// cliente cancela a chamada.
+func slowHandler(delay time.Duration, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(delay):
+			jsonHandler(body)(w, r)
+		case <-r.Context().Done():
+		}
+	}
+}
+
+const (
+	viaCEPSaoPaulo  = `{"localidade":"São Paulo","uf":"SP"}`
+	weatherSaoPaulo = `{"location":{"name":"Sao Paulo"},"current":{"temp_c":25}}`
+)
+
+// setUpstreamTimeouts define VIACEP_TIMEOUT e WEATHER_TIMEOUT durante o teste.
+func setUpstreamTimeouts(t *testing.T, viaCEP, weather time.Duration) {
+	t.Helper()
+	oldViaCEP, oldWeather := viaCEPTimeout, weatherTimeout
+	t.Cleanup(func() { viaCEPTimeout, weatherTimeout = oldViaCEP, oldWeather })
+	viaCEPTimeout, weatherTimeout = viaCEP, weather
+}
+
+// isTimeout indica se o erro é o timeout de uma API externa (504).
+func isTimeout(err error) bool {
+	var upstreamErr *UpstreamError
+	return errors.As(err, &upstreamErr) && upstreamErr.Timeout()
+}
+
+func TestFetchLocationUsesViaCEPTimeout(t *testing.T) {
+	stubUpstreams(t, slowHandler(time.Second, viaCEPSaoPaulo), nil)
+	setUpstreamTimeouts(t, 50*time.Millisecond, 5*time.Second)
+
+	start := time.Now()
+	_, err := fetchLocation(context.Background(), testTracer, "01001000")
+	if !isTimeout(err) {
+		t.Fatalf("erro = %v, esperado timeout do ViaCEP", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("a chamada demorou %v; VIACEP_TIMEOUT é 50ms", elapsed)
+	}
+}
+
+func TestFetchWeatherUsesWeatherTimeout(t *testing.T) {
+	stubUpstreams(t, nil, slowHandler(time.Second, weatherSaoPaulo))
+	setUpstreamTimeouts(t, 5*time.Second, 50*time.Millisecond)
+
+	start := time.Now()
+	_, err := fetchWeather(context.Background(), testTracer, "São Paulo")
+	if !isTimeout(err) {
+		t.Fatalf("erro = %v, esperado timeout da WeatherAPI", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("a chamada demorou %v; WEATHER_TIMEOUT é 50ms", elapsed)
+	}
+}
+
+func TestUpstreamTimeoutsAreIndependent(t *testing.T) {
+	// Um ViaCEP lento, mas dentro do seu prazo, não é afetado pelo prazo curto da WeatherAPI.
+	stubUpstreams(t, slowHandler(100*time.Millisecond, viaCEPSaoPaulo), jsonHandler(weatherSaoPaulo))
+	setUpstreamTimeouts(t, time.Second, 50*time.Millisecond)
+
+	location, err := fetchLocation(context.Background(), testTracer, "01001000")
+	if err != nil {
+		t.Fatalf("fetchLocation: %v", err)
+	}
+	if location.Localidade != "São Paulo" {
+		t.Errorf("cidade = %q, esperado São Paulo", location.Localidade)
+	}
+	weather, err := fetchWeather(context.Background(), testTracer, location.Localidade)
+	if err != nil {
+		t.Fatalf("fetchWeather: %v", err)
+	}
+	if weather.Current.TempC != 25 {
+		t.Errorf("temperatura = %v, esperado 25", weather.Current.TempC)
+	}
+}
+
+func TestUpstreamTimeoutNeverExceedsRequestDeadline(t *testing.T) {
+	stubUpstreams(t, slowHandler(time.Second, viaCEPSaoPaulo), slowHandler(time.Second, weatherSaoPaulo))
+	setUpstreamTimeouts(t, 5*time.Second, 5*time.Second)
+
+	for name, fetch := range map[string]func(context.Context) error{
+		"viacep": func(ctx context.Context) error {
+			_, err := fetchLocation(ctx, testTracer, "01001000")
+			return err
+		},
+		"weatherapi": func(ctx context.Context) error {
+			_, err := fetchWeather(ctx, testTracer, "São Paulo")
+			return err
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			start := time.Now()
+			if err := fetch(ctx); !isTimeout(err) {
+				t.Fatalf("erro = %v, esperado timeout", err)
+			}
+			if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+				t.Errorf("a chamada demorou %v, para lá do prazo da requisição (50ms)", elapsed)
+			}
+		})
+	}
+}
+
+func TestAnnotateBaggageCopiesIncidentID(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	bag, _ := baggage.Parse(incidentKey + "=INC-42," + cepBaggageKey + "=01001000")
+	ctx := baggage.ContextWithBaggage(context.Background(), bag)
+
+	ctx, span := tp.Tracer("test").Start(ctx, "WeatherHandler")
+	annotateBaggage(ctx)
+	span.End()
+
+	attrs := map[attribute.Key]string{}
+	for _, kv := range recorder.Ended()[0].Attributes() {
+		attrs[kv.Key] = kv.Value.AsString()
+	}
+	if attrs[incidentKey] != "INC-42" || attrs[cepBaggageAttr] != "01001000" {
+		t.Errorf("atributos = %v, esperado o incidente e o CEP do baggage", attrs)
+	}
+}
+
+// recordSpans regista como global, durante o teste, um provider que guarda os spans.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+// spanAttribute devolve o valor do atributo `key` do span, e se existe.
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+// serverSpans devolve os nomes dos spans do servidor terminados.
+func serverSpans(recorder *tracetest.SpanRecorder) []string {
+	var names []string
+	for _, span := range recorder.Ended() {
+		if span.SpanKind() == trace.SpanKindServer {
+			names = append(names, span.Name())
+		}
+	}
+	return names
+}
+
+func TestRoutesCreateServerSpan(t *testing.T) {
+	recorder := recordSpans(t)
+	stubUpstreams(t, jsonHandler(viaCEPSaoPaulo), jsonHandler(weatherSaoPaulo))
+	r := chi.NewRouter()
+	registerRoutes(r)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/weather/01001000", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, esperado 200: %s", rec.Code, rec.Body)
+	}
+	if got := serverSpans(recorder); len(got) != 1 || got[0] != "WeatherHandler" {
+		t.Errorf("spans do servidor = %v, esperado um único WeatherHandler", got)
+	}
+}
+
+func TestFaviconIsNotInstrumented(t *testing.T) {
+	recorder := recordSpans(t)
+	r := chi.NewRouter()
+	registerRoutes(r)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/favicon.ico", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("status = %d, esperado 204", rec.Code)
+	}
+	if spans := recorder.Ended(); len(spans) != 0 {
+		t.Errorf("o favicon não deveria gerar spans, obtido %d", len(spans))
+	}
+}
+
+// spanEvents devolve os eventos com o nome indicado registados nos spans terminados.
+func spanEvents(recorder *tracetest.SpanRecorder, name string) []sdktrace.Event {
+	var events []sdktrace.Event
+	for _, span := range recorder.Ended() {
+		for _, event := range span.Events() {
+			if event.Name == name {
+				events = append(events, event)
+			}
+		}
+	}
+	return events
+}
+
+func TestReconcileLocation(t *testing.T) {
+	tests := []struct {
+		name         string
+		viaCEPCity   string
+		location     WeatherAPILocation
+		wantMismatch bool
+	}{
+		{"nomes iguais", "Curitiba", WeatherAPILocation{Name: "Curitiba"}, false},
+		{"diferença de acentos e maiúsculas", "São Paulo", WeatherAPILocation{Name: "sao paulo"}, false},
+		{"nomes diferentes", "Embu das Artes", WeatherAPILocation{Name: "Embu", Region: "Sao Paulo", Country: "Brazil"}, true},
+		{"sem localidade da WeatherAPI", "Curitiba", WeatherAPILocation{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+			ctx, span := tp.Tracer("test").Start(context.Background(), "WeatherHandler")
+			reconcileLocation(ctx, tt.viaCEPCity, tt.location)
+			span.End()
+
+			events := spanEvents(recorder, "location.mismatch")
+			if got := len(events) == 1; got != tt.wantMismatch {
+				t.Fatalf("evento location.mismatch = %d, esperado divergência: %v", len(events), tt.wantMismatch)
+			}
+			if !tt.wantMismatch {
+				return
+			}
+			attrs := map[attribute.Key]string{}
+			for _, kv := range events[0].Attributes {
+				attrs[kv.Key] = kv.Value.AsString()
+			}
+			if attrs["viacep.city"] != tt.viaCEPCity || attrs["weatherapi.name"] != tt.location.Name {
+				t.Errorf("atributos do evento = %v", attrs)
+			}
+		})
+	}
+}
+
+func TestVerboseResponseIncludesWeatherAPILocation(t *testing.T) {
+	recorder := recordSpans(t)
+	stubUpstreams(t,
+		jsonHandler(`{"localidade":"Embu das Artes","uf":"SP"}`),
+		jsonHandler(`{"location":{"name":"Embu","country":"Brazil"},"current":{"temp_c":20}}`))
+	r := chi.NewRouter()
+	registerRoutes(r)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/weather/06800000?verbose=true", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		City     string                     `json:"city"`
+		Location map[string]json.RawMessage `json:"location"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("resposta inválida: %v", err)
+	}
+	if body.City != "Embu das Artes" {
+		t.Errorf("city = %q, esperado a cidade do ViaCEP", body.City)
+	}
+	if string(body.Location["name"]) != `"Embu"` || string(body.Location["country"]) != `"Brazil"` {
+		t.Errorf("location = %v, esperado a localidade da WeatherAPI", body.Location)
+	}
+	// Os campos que a WeatherAPI não devolve são omitidos.
+	if _, ok := body.Location["region"]; ok {
+		t.Errorf("location.region deveria ser omitido: %v", body.Location)
+	}
+	if len(spanEvents(recorder, "location.mismatch")) != 1 {
+		t.Error("esperado o evento location.mismatch no span do servidor")
+	}
+
+	// Sem verbose, a localidade da WeatherAPI não faz parte da resposta.
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/weather/06800000", nil))
+	if strings.Contains(rec.Body.String(), `"location"`) {
+		t.Errorf("a resposta sem verbose não deveria ter location: %s", rec.Body)
+	}
+}
+
+func TestDefaultWeatherUsesDefaultCEP(t *testing.T) {
+	previous := defaultCEP
+	defaultCEP = "01001000"
+	t.Cleanup(func() { defaultCEP = previous })
+	var path string
+	stubUpstreams(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Write([]byte(viaCEPSaoPaulo))
+	}), jsonHandler(weatherSaoPaulo))
+	r := chi.NewRouter()
+	registerRoutes(r)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/weather", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, esperado 200: %s", rec.Code, rec.Body)
+	}
+	if path != "/ws/01001000/json/" {
+		t.Errorf("caminho pedido ao ViaCEP = %q, esperado o DEFAULT_CEP", path)
+	}
+}
+
+func TestDefaultWeatherWithoutDefaultCEP(t *testing.T) {
+	previous := defaultCEP
+	defaultCEP = ""
+	t.Cleanup(func() { defaultCEP = previous })
+	var calls int
+	stubUpstreams(t, http.HandlerFunc(func(http.ResponseWriter, *http.Request) { calls++ }), nil)
+	r := chi.NewRouter()
+	registerRoutes(r)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/weather", nil))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "zipcode required") {
+		t.Errorf("resposta = %d %q, esperado 400 a pedir o CEP", rec.Code, rec.Body)
+	}
+	if calls != 0 {
+		t.Errorf("o ViaCEP não deveria ser chamado sem DEFAULT_CEP")
+	}
+}
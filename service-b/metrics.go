@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// downstreamErrors conta as falhas das chamadas às APIs externas, por API (`provider`) e
+// por categoria de erro (`error.category`), para que se possam criar alertas sobre picos
+// de erros. Usa o MeterProvider global, configurado em `main` por InitMeterProvider.
+var downstreamErrors = newDownstreamErrorsCounter()
+
+// breakerStateValues são os valores do gauge `circuit_breaker.state`, por ordem de gravidade.
+var breakerStateValues = map[string]int64{
+	breakerClosed:   0,
+	breakerHalfOpen: 1,
+	breakerOpen:     2,
+}
+
+// Regista o gauge com o estado dos circuit breakers. O callback lê os breakers no momento
+// de cada exportação, pelo que reflete também os que são recriados em `main`.
+var breakerStateGauge = registerBreakerStateGauge()
+
+// Regista o gauge com a quota restante da WeatherAPI, lida do cliente em cada exportação.
+var weatherQuotaGauge = registerWeatherQuotaGauge()
+
+func newDownstreamErrorsCounter() metric.Int64Counter {
+	counter, err := otel.Meter("service-b").Int64Counter(
+		"downstream.errors",
+		metric.WithDescription("Falhas das chamadas às APIs externas (ViaCEP e WeatherAPI)."),
+		metric.WithUnit("{error}"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+	return counter
+}
+
+// registerBreakerStateGauge cria o gauge `circuit_breaker.state`, com o estado de cada
+// circuit breaker (0 fechado, 1 half-open, 2 aberto) e o atributo `provider`.
+func registerBreakerStateGauge() metric.Registration {
+	meter := otel.Meter("service-b")
+	gauge, err := meter.Int64ObservableGauge(
+		"circuit_breaker.state",
+		metric.WithDescription("Estado do circuit breaker de cada API externa: 0 fechado, 1 half-open, 2 aberto."),
+	)
+	if err != nil {
+		otel.Handle(err)
+		return nil
+	}
+	reg, err := meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		for _, b := range []*circuitBreaker{viaCEPBreaker, weatherBreaker} {
+			o.ObserveInt64(gauge, breakerStateValues[b.currentState()], metric.WithAttributes(
+				attribute.String("provider", b.provider),
+			))
+		}
+		return nil
+	}, gauge)
+	if err != nil {
+		otel.Handle(err)
+	}
+	return reg
+}
+
+// registerWeatherQuotaGauge cria o gauge `weatherapi.quota.remaining`, com a quota restante
+// indicada pelos cabeçalhos da última resposta da WeatherAPI. Enquanto a quota for
+// desconhecida (a API não envia os cabeçalhos), o gauge não tem valores.
+func registerWeatherQuotaGauge() metric.Registration {
+	meter := otel.Meter("service-b")
+	gauge, err := meter.Int64ObservableGauge(
+		"weatherapi.quota.remaining",
+		metric.WithDescription("Chamadas restantes na quota da WeatherAPI, segundo a última resposta."),
+		metric.WithUnit("{call}"),
+	)
+	if err != nil {
+		otel.Handle(err)
+		return nil
+	}
+	reg, err := meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		if remaining, ok := weatherAPI.quotaRemaining(); ok {
+			o.ObserveInt64(gauge, int64(remaining))
+		}
+		return nil
+	}, gauge)
+	if err != nil {
+		otel.Handle(err)
+	}
+	return reg
+}
+
+// recordDownstreamError incrementa `downstream.errors` quando a chamada à API externa
+// falhou. Só contam as falhas da própria API (UpstreamError): um CEP desconhecido, a quota
+// esgotada ou o circuit breaker aberto não são erros da chamada.
+func recordDownstreamError(ctx context.Context, provider string, err error) {
+	var upstreamErr *UpstreamError
+	if !errors.As(err, &upstreamErr) {
+		return
+	}
+	downstreamErrors.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("provider", provider),
+		attribute.String("error.category", downstreamErrorCategory(upstreamErr)),
+	))
+}
+
+// downstreamErrorCategory classifica a falha: `timeout` quando o prazo se esgotou,
+// `network` quando não houve resposta, `non_2xx` para um status fora da faixa 2xx e
+// `decode` para uma resposta 2xx que não foi possível ler ou interpretar.
+func downstreamErrorCategory(err *UpstreamError) string {
+	switch {
+	case err.Timeout():
+		return "timeout"
+	case err.StatusCode == 0:
+		return "network"
+	case err.StatusCode < 200 || err.StatusCode > 299:
+		return "non_2xx"
+	default:
+		return "decode"
+	}
+}
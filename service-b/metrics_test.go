@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+var (
+	metricReaderOnce sync.Once
+	metricReader     *sdkmetric.ManualReader
+)
+
+// testMetricReader instala, uma única vez por processo, um MeterProvider global com um
+// leitor manual. Os instrumentos do pacote são criados antes, sobre o provider global por
+// omissão, e passam a usar este provider quando ele é instalado.
+func testMetricReader() *sdkmetric.ManualReader {
+	metricReaderOnce.Do(func() {
+		metricReader = sdkmetric.NewManualReader()
+		otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(metricReader)))
+	})
+	return metricReader
+}
+
+// collectMetric devolve os dados atuais da métrica indicada, ou nil se não existir.
+func collectMetric(t *testing.T, reader *sdkmetric.ManualReader, name string) metricdata.Aggregation {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == name {
+				return m.Data
+			}
+		}
+	}
+	t.Fatalf("métrica %q não encontrada", name)
+	return nil
+}
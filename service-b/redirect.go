@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrRedirectToPrivateAddress indica que uma API externa redirecionou a chamada para um
+// endereço privado, de loopback ou link-local, que não deve ser alcançável por esta via.
+var ErrRedirectToPrivateAddress = errors.New("redirect to private address blocked")
+
+// checkRedirect devolve a política de redirecionamentos do cliente das APIs externas.
+// Por omissão (`maxRedirects` 0) nenhum redirecionamento é seguido: a resposta 3xx é
+// devolvida tal como veio e tratada como uma falha da API. Os redirecionamentos para
+// endereços privados são sempre recusados, para que uma API comprometida não sirva de
+// ponte para serviços internos. Cada redirecionamento recusado gera o evento
+// `http.redirect_blocked` no span da chamada.
+func checkRedirect(maxRedirects int) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		span := trace.SpanFromContext(req.Context())
+		if len(via) > maxRedirects {
+			span.AddEvent("http.redirect_blocked", trace.WithAttributes(
+				attribute.String("reason", "limit"),
+				attribute.String("redirect.host", req.URL.Host),
+				attribute.Int("redirect.count", len(via)),
+			))
+			return http.ErrUseLastResponse
+		}
+		if err := checkRedirectTarget(req); err != nil {
+			span.AddEvent("http.redirect_blocked", trace.WithAttributes(
+				attribute.String("reason", "private_address"),
+				attribute.String("redirect.host", req.URL.Host),
+			))
+			return err
+		}
+		return nil
+	}
+}
+
+// checkRedirectTarget resolve o host de destino e recusa-o se algum dos seus endereços
+// for privado.
+func checkRedirectTarget(req *http.Request) error {
+	host := req.URL.Hostname()
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		addrs, err := net.DefaultResolver.LookupIPAddr(req.Context(), host)
+		if err != nil {
+			return fmt.Errorf("redirect para %q: %w", host, err)
+		}
+		ips = ips[:0]
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+	}
+	for _, ip := range ips {
+		if isPrivateIP(ip) {
+			return fmt.Errorf("%w: %s", ErrRedirectToPrivateAddress, host)
+		}
+	}
+	return nil
+}
+
+// isPrivateIP indica se o endereço pertence a uma rede privada, de loopback, link-local
+// ou não especificada.
+func isPrivateIP(ip net.IP) bool {
+	return ip.IsPrivate() ||
+		ip.IsLoopback() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified()
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// redirectTo é uma API externa simulada que redireciona sempre para `location`.
+func redirectTo(t *testing.T, location string) string {
+	t.Helper()
+	srv := httptest.NewServer(http.RedirectHandler(location, http.StatusFound))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// getWithRedirectPolicy faz um GET com o cliente das APIs externas, dentro de um span, e
+// devolve a resposta, os eventos `http.redirect_blocked` registados e o erro.
+func getWithRedirectPolicy(t *testing.T, maxRedirects int, url string) (*http.Response, []sdktrace.Event, error) {
+	t.Helper()
+	client, err := newUpstreamClient("", maxRedirects)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := tracetest.NewSpanRecorder()
+	ctx, span := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test").Start(context.Background(), "get-weather")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	resp, err := client.Do(req)
+	if resp != nil {
+		resp.Body.Close()
+	}
+	span.End()
+	return resp, spanEvents(recorder, "http.redirect_blocked"), err
+}
+
+// eventAttributes devolve os atributos do evento como texto.
+func eventAttributes(event sdktrace.Event) map[string]string {
+	attrs := map[string]string{}
+	for _, attr := range event.Attributes {
+		attrs[string(attr.Key)] = attr.Value.Emit()
+	}
+	return attrs
+}
+
+func TestRedirectLimitReturnsRedirectResponse(t *testing.T) {
+	url := redirectTo(t, "http://api.weatherapi.com/v1/current.json")
+
+	// Sem redirecionamentos permitidos (a omissão), a resposta 3xx é devolvida tal como veio.
+	resp, events, err := getWithRedirectPolicy(t, 0, url)
+	if err != nil {
+		t.Fatalf("erro = %v, esperada a resposta do redirecionamento", err)
+	}
+	if resp.StatusCode != http.StatusFound {
+		t.Errorf("status = %d, esperado %d", resp.StatusCode, http.StatusFound)
+	}
+	if len(events) != 1 {
+		t.Fatalf("esperado um evento http.redirect_blocked, obtidos %d", len(events))
+	}
+	if attrs := eventAttributes(events[0]); attrs["reason"] != "limit" || attrs["redirect.host"] != "api.weatherapi.com" || attrs["redirect.count"] != "1" {
+		t.Errorf("atributos do evento = %v", attrs)
+	}
+}
+
+func TestRedirectPolicyLimit(t *testing.T) {
+	policy := checkRedirect(2)
+	// Um endereço público literal, para a política não depender da resolução de nomes.
+	target := httptest.NewRequest(http.MethodGet, "http://93.184.216.34/v1/current.json", nil)
+	previous := httptest.NewRequest(http.MethodGet, "http://api.weatherapi.com/v1/current.json", nil)
+
+	if err := policy(target, []*http.Request{previous, previous}); err != nil {
+		t.Errorf("redirecionamento dentro do limite recusado: %v", err)
+	}
+	if err := policy(target, []*http.Request{previous, previous, previous}); !errors.Is(err, http.ErrUseLastResponse) {
+		t.Errorf("erro = %v, esperado http.ErrUseLastResponse acima do limite", err)
+	}
+}
+
+func TestRedirectToPrivateAddressIsBlocked(t *testing.T) {
+	for _, location := range []string{
+		"http://10.0.0.1/internal",
+		"http://127.0.0.1:8080/admin",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://[::1]/admin",
+	} {
+		t.Run(location, func(t *testing.T) {
+			_, events, err := getWithRedirectPolicy(t, 5, redirectTo(t, location))
+			if !errors.Is(err, ErrRedirectToPrivateAddress) {
+				t.Fatalf("erro = %v, esperado ErrRedirectToPrivateAddress", err)
+			}
+			if len(events) != 1 {
+				t.Fatalf("esperado um evento http.redirect_blocked, obtidos %d", len(events))
+			}
+			if attrs := eventAttributes(events[0]); attrs["reason"] != "private_address" {
+				t.Errorf("atributos do evento = %v", attrs)
+			}
+		})
+	}
+}
+
+func TestIsPrivateIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"192.168.1.1", true},
+		{"127.0.0.1", true},
+		{"169.254.169.254", true},
+		{"0.0.0.0", true},
+		{"::1", true},
+		{"fd00::1", true},
+		{"fe80::1", true},
+		{"93.184.216.34", false},
+		{"2606:2800:220:1::1", false},
+	}
+	for _, tt := range tests {
+		if got := isPrivateIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("isPrivateIP(%s) = %v, esperado %v", tt.ip, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"Observabilidade/logging"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tipos de conteúdo suportados nas respostas. JSON é o padrão; XML existe para clientes legados.
+const (
+	contentTypeJSON = "application/json"
+	contentTypeXML  = "application/xml"
+)
+
+// enforceContentLength é preenchido em `main` a partir de ENFORCE_CONTENT_LENGTH.
+var enforceContentLength = true
+
+// ErrorResponse é o corpo das respostas de erro em XML.
+type ErrorResponse struct {
+	XMLName xml.Name `xml:"error"`
+	Message string   `xml:"message"`
+}
+
+// writeResponse serializa `v` no formato negociado com o cliente (JSON ou XML, via
+// cabeçalho `Accept`) e envia-o com o status indicado. Por omissão a saída é compacta;
+// com `?pretty=true` é indentada com dois espaços, o que facilita a leitura durante a depuração.
+func writeResponse(w http.ResponseWriter, r *http.Request, status int, v any) {
+	// A serialização tem um span próprio, com o formato e o tamanho do corpo, o que
+	// completa o trace até à saída da resposta (relevante nas respostas detalhadas).
+	_, span := otel.Tracer("service-b-tracer").Start(r.Context(), "encode-response")
+	var buf bytes.Buffer
+	var err error
+	format := "json"
+	if wantsXML(r) {
+		format = "xml"
+		w.Header().Set("Content-Type", contentTypeXML+"; charset=utf-8")
+		enc := xml.NewEncoder(&buf)
+		if wantsPretty(r) {
+			enc.Indent("", "  ")
+		}
+		buf.WriteString(xml.Header)
+		err = enc.Encode(v)
+	} else {
+		enc := json.NewEncoder(&buf)
+		if wantsPretty(r) {
+			enc.SetIndent("", "  ")
+		}
+		w.Header().Set("Content-Type", contentTypeJSON)
+		err = enc.Encode(v)
+	}
+	if err != nil {
+		// Uma falha a serializar é um erro nosso: respondemos 500, em vez do status
+		// pretendido com um corpo incompleto.
+		recordFailure(span, err)
+		span.End()
+		logging.LoggerFromContext(r.Context()).Error("erro ao serializar a resposta", "format", format, "error", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	span.SetAttributes(
+		attribute.String("response.format", format),
+		attribute.Int("response.size_bytes", buf.Len()),
+	)
+	span.End()
+	writeBody(w, r, status, buf.Bytes())
+}
+
+// writeBody envia o corpo já serializado. Com ENFORCE_CONTENT_LENGTH (ativo por omissão),
+// a resposta leva o `Content-Length`, para que quem a recebe (ex: o Serviço A, antes de a
+// guardar para idempotência) detete um corpo truncado. Se o número de bytes escritos não
+// coincidir com o esperado (ex: erro de escrita a meio), fica registado no span o evento
+// `response.short_write`.
+func writeBody(w http.ResponseWriter, r *http.Request, status int, body []byte) {
+	if enforceContentLength {
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	w.WriteHeader(status)
+	n, err := w.Write(body)
+	if n == len(body) && err == nil {
+		return
+	}
+
+	attrs := []attribute.KeyValue{
+		attribute.Int("response.expected_bytes", len(body)),
+		attribute.Int("response.written_bytes", n),
+	}
+	if err != nil {
+		attrs = append(attrs, attribute.String("error", err.Error()))
+	}
+	trace.SpanFromContext(r.Context()).AddEvent("response.short_write", trace.WithAttributes(attrs...))
+	logging.LoggerFromContext(r.Context()).Warn("resposta escrita de forma incompleta",
+		"expected_bytes", len(body), "written_bytes", n, "error", err)
+}
+
+// writeError envia uma mensagem de erro. Para clientes XML o erro segue o formato
+// `<error><message>...</message></error>`; os restantes recebem texto simples, como até aqui.
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	if wantsXML(r) {
+		writeResponse(w, r, status, ErrorResponse{Message: message})
+		return
+	}
+	http.Error(w, message, status)
+}
+
+// wantsXML indica se o cliente prefere XML: o cabeçalho `Accept` pede application/xml
+// (ou text/xml) e não pede JSON antes dele.
+func wantsXML(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case contentTypeJSON:
+			return false
+		case contentTypeXML, "text/xml":
+			return true
+		}
+	}
+	return false
+}
+
+// wantsVerbose indica se o cliente pediu a resposta detalhada via `?verbose=true`.
+func wantsVerbose(r *http.Request) bool {
+	verbose, _ := strconv.ParseBool(r.URL.Query().Get("verbose"))
+	return verbose
+}
+
+// wantsLocalTime indica se o cliente pediu a hora local da cidade via `?localtime=true`.
+func wantsLocalTime(r *http.Request) bool {
+	localTime, _ := strconv.ParseBool(r.URL.Query().Get("localtime"))
+	return localTime
+}
+
+// wantsPretty indica se o cliente pediu uma resposta indentada via `?pretty=true`.
+func wantsPretty(r *http.Request) bool {
+	pretty, _ := strconv.ParseBool(r.URL.Query().Get("pretty"))
+	return pretty
+}
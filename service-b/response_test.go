@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestWriteResponseEncodingFailureIs500(t *testing.T) {
+	for _, accept := range []string{"", contentTypeXML} {
+		t.Run("accept="+accept, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/weather/01001000", nil)
+			req.Header.Set("Accept", accept)
+
+			// Um valor que nenhum dos codificadores consegue serializar.
+			writeResponse(rec, req, http.StatusOK, map[string]any{"temp_c": math.Inf(1), "ch": make(chan int)})
+
+			if rec.Code != http.StatusInternalServerError {
+				t.Fatalf("status = %d, esperado %d", rec.Code, http.StatusInternalServerError)
+			}
+			if body := strings.TrimSpace(rec.Body.String()); body != "internal server error" {
+				t.Fatalf("corpo = %q", body)
+			}
+		})
+	}
+}
+
+func TestWriteResponseJSON(t *testing.T) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/weather/01001000", nil)
+	writeResponse(rec, req, http.StatusOK, newFinalResponse("São Paulo", 25))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != contentTypeJSON {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	if cl := rec.Header().Get("Content-Length"); cl != "" && cl != strconv.Itoa(rec.Body.Len()) {
+		t.Fatalf("Content-Length = %s, corpo com %d bytes", cl, rec.Body.Len())
+	}
+	if !strings.Contains(rec.Body.String(), `"city":"São Paulo"`) {
+		t.Fatalf("corpo = %s", rec.Body.String())
+	}
+}
+
+func TestWriteResponsePrettyJSON(t *testing.T) {
+	recorder := recordSpans(t)
+	encode := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		writeResponse(rec, httptest.NewRequest(http.MethodGet, target, nil), http.StatusOK, newFinalResponse("São Paulo", 25))
+		return rec
+	}
+	compact := encode("/weather/01001000")
+	pretty := encode("/weather/01001000?pretty=true")
+
+	if strings.Contains(compact.Body.String(), "\n  ") {
+		t.Errorf("a resposta padrão deveria ser compacta: %s", compact.Body)
+	}
+	if !strings.Contains(pretty.Body.String(), "{\n  \"city\": \"São Paulo\",\n") {
+		t.Errorf("a resposta com pretty=true deveria ter indentação de dois espaços: %s", pretty.Body)
+	}
+
+	// As duas formas representam os mesmos dados.
+	var a, b FinalResponse
+	if err := json.Unmarshal(compact.Body.Bytes(), &a); err != nil {
+		t.Fatalf("resposta compacta inválida: %v", err)
+	}
+	if err := json.Unmarshal(pretty.Body.Bytes(), &b); err != nil {
+		t.Fatalf("resposta indentada inválida: %v", err)
+	}
+	if a != b {
+		t.Errorf("respostas diferentes: %+v e %+v", a, b)
+	}
+
+	// O Content-Length e o tamanho registado no span acompanham o corpo indentado.
+	if cl := pretty.Header().Get("Content-Length"); cl != strconv.Itoa(pretty.Body.Len()) {
+		t.Errorf("Content-Length = %s, corpo com %d bytes", cl, pretty.Body.Len())
+	}
+	var sizes []int64
+	for _, span := range recorder.Ended() {
+		if span.Name() != "encode-response" {
+			continue
+		}
+		for _, kv := range span.Attributes() {
+			if kv.Key == "response.size_bytes" {
+				sizes = append(sizes, kv.Value.AsInt64())
+			}
+		}
+	}
+	if len(sizes) != 2 || sizes[0] != int64(compact.Body.Len()) || sizes[1] != int64(pretty.Body.Len()) {
+		t.Errorf("response.size_bytes = %v, esperado [%d %d]", sizes, compact.Body.Len(), pretty.Body.Len())
+	}
+}
+
+func TestWriteResponsePrettyXML(t *testing.T) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/weather/01001000?pretty=true", nil)
+	req.Header.Set("Accept", contentTypeXML)
+	writeResponse(rec, req, http.StatusOK, newFinalResponse("São Paulo", 25))
+
+	if !strings.Contains(rec.Body.String(), "\n  <city>São Paulo</city>") {
+		t.Errorf("a resposta XML com pretty=true deveria ser indentada: %s", rec.Body)
+	}
+}
+
+func TestWriteResponseXML(t *testing.T) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/weather/01001000", nil)
+	req.Header.Set("Accept", contentTypeXML)
+	writeResponse(rec, req, http.StatusOK, newFinalResponse("São Paulo", 25))
+
+	if ct := rec.Header().Get("Content-Type"); ct != contentTypeXML+"; charset=utf-8" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	if !strings.HasPrefix(rec.Body.String(), xml.Header+"<weather>") {
+		t.Fatalf("corpo sem declaração XML ou elemento <weather>: %s", rec.Body)
+	}
+	var got FinalResponse
+	if err := xml.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("XML inválido: %v", err)
+	}
+	if got.City != "São Paulo" || got.TempC != 25 {
+		t.Errorf("resposta = %+v", got)
+	}
+}
+
+func TestWriteErrorXML(t *testing.T) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/weather/1", nil)
+	req.Header.Set("Accept", "text/xml")
+	writeError(rec, req, http.StatusUnprocessableEntity, "invalid zipcode")
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, esperado 422", rec.Code)
+	}
+	var got ErrorResponse
+	if err := xml.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("XML inválido: %v: %s", err, rec.Body)
+	}
+	if got.XMLName.Local != "error" || got.Message != "invalid zipcode" {
+		t.Errorf("erro = %+v, esperado <error><message>invalid zipcode</message></error>", got)
+	}
+}
+
+func TestWriteErrorPlainTextByDefault(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeError(rec, httptest.NewRequest(http.MethodGet, "/weather/1", nil), http.StatusUnprocessableEntity, "invalid zipcode")
+
+	if body := strings.TrimSpace(rec.Body.String()); body != "invalid zipcode" {
+		t.Errorf("corpo = %q, esperado texto simples", body)
+	}
+}
+
+func TestWantsXML(t *testing.T) {
+	for accept, want := range map[string]bool{
+		"":                                  false,
+		"*/*":                               false,
+		"application/xml":                   true,
+		"text/xml; charset=utf-8":           true,
+		"application/json, application/xml": false,
+		"text/html, application/xml;q=0.9":  true,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/weather/01001000", nil)
+		req.Header.Set("Accept", accept)
+		if got := wantsXML(req); got != want {
+			t.Errorf("wantsXML(%q) = %v, esperado %v", accept, got, want)
+		}
+	}
+}
+
+// shortWriter simula uma escrita interrompida a meio: só aceita metade do corpo.
+type shortWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (w shortWriter) Write(b []byte) (int, error) {
+	n, _ := w.ResponseRecorder.Write(b[:len(b)/2])
+	return n, io.ErrShortWrite
+}
+
+// setEnforceContentLength define `enforceContentLength` durante o teste.
+func setEnforceContentLength(t *testing.T, enabled bool) {
+	t.Helper()
+	previous := enforceContentLength
+	enforceContentLength = enabled
+	t.Cleanup(func() { enforceContentLength = previous })
+}
+
+func TestWriteResponseSetsContentLength(t *testing.T) {
+	setEnforceContentLength(t, true)
+	rec := httptest.NewRecorder()
+	writeResponse(rec, httptest.NewRequest(http.MethodGet, "/weather/01001000", nil), http.StatusOK, FinalResponse{City: "São Paulo"})
+
+	if got := rec.Header().Get("Content-Length"); got != strconv.Itoa(rec.Body.Len()) {
+		t.Errorf("Content-Length = %q, corpo com %d bytes", got, rec.Body.Len())
+	}
+}
+
+func TestWriteResponseWithoutContentLength(t *testing.T) {
+	setEnforceContentLength(t, false)
+	rec := httptest.NewRecorder()
+	writeResponse(rec, httptest.NewRequest(http.MethodGet, "/weather/01001000", nil), http.StatusOK, FinalResponse{City: "São Paulo"})
+
+	if got := rec.Header().Get("Content-Length"); got != "" {
+		t.Errorf("Content-Length = %q, deveria estar ausente com ENFORCE_CONTENT_LENGTH=false", got)
+	}
+}
+
+func TestWriteResponseShortWriteIsRecorded(t *testing.T) {
+	setEnforceContentLength(t, true)
+	recorder := tracetest.NewSpanRecorder()
+	ctx, span := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test").Start(context.Background(), "GET /weather/{cep}")
+	req := httptest.NewRequest(http.MethodGet, "/weather/01001000", nil).WithContext(ctx)
+	w := shortWriter{httptest.NewRecorder()}
+
+	writeResponse(w, req, http.StatusOK, FinalResponse{City: "São Paulo"})
+	span.End()
+
+	expected, _ := strconv.Atoi(w.Header().Get("Content-Length"))
+	if w.Body.Len() >= expected {
+		t.Fatalf("escritos %d bytes de %d, esperado um corpo truncado", w.Body.Len(), expected)
+	}
+	events := spanEvents(recorder, "response.short_write")
+	if len(events) != 1 {
+		t.Fatalf("esperado um evento response.short_write, obtidos %d", len(events))
+	}
+	attrs := map[string]int64{}
+	for _, attr := range events[0].Attributes {
+		attrs[string(attr.Key)] = attr.Value.AsInt64()
+	}
+	if attrs["response.expected_bytes"] != int64(expected) || attrs["response.written_bytes"] != int64(w.Body.Len()) {
+		t.Errorf("atributos do evento = %v, esperado %d bytes esperados e %d escritos", attrs, expected, w.Body.Len())
+	}
+}
+
+// encodeSpan devolve o span encode-response registado, verificando que é único.
+func encodeSpan(t *testing.T, recorder *tracetest.SpanRecorder) sdktrace.ReadOnlySpan {
+	t.Helper()
+	var found []sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.Name() == "encode-response" {
+			found = append(found, span)
+		}
+	}
+	if len(found) != 1 {
+		t.Fatalf("esperado um span encode-response, obtidos %d", len(found))
+	}
+	return found[0]
+}
+
+func TestWriteResponseEncodeSpan(t *testing.T) {
+	for _, format := range []string{"json", "xml"} {
+		t.Run(format, func(t *testing.T) {
+			recorder := recordSpans(t)
+			ctx, parent := otel.Tracer("test").Start(context.Background(), "GET /weather/{cep}")
+			req := httptest.NewRequest(http.MethodGet, "/weather/01001000?verbose=true", nil).WithContext(ctx)
+			if format == "xml" {
+				req.Header.Set("Accept", contentTypeXML)
+			}
+			rec := httptest.NewRecorder()
+
+			writeResponse(rec, req, http.StatusOK, FinalResponse{City: "São Paulo", TempC: 25, TempF: 77, TempK: 298})
+			parent.End()
+
+			span := encodeSpan(t, recorder)
+			if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+				t.Error("encode-response deveria ser filho do span da requisição")
+			}
+			if value, ok := spanAttribute(span, "response.format"); !ok || value.AsString() != format {
+				t.Errorf("response.format = %q, esperado %q", value.AsString(), format)
+			}
+			if value, ok := spanAttribute(span, "response.size_bytes"); !ok || value.AsInt64() != int64(rec.Body.Len()) {
+				t.Errorf("response.size_bytes = %d, corpo com %d bytes", value.AsInt64(), rec.Body.Len())
+			}
+		})
+	}
+}
+
+func TestWriteResponseEncodeSpanRecordsFailure(t *testing.T) {
+	recorder := recordSpans(t)
+	req := httptest.NewRequest(http.MethodGet, "/weather/01001000", nil)
+
+	writeResponse(httptest.NewRecorder(), req, http.StatusOK, map[string]any{"temp_c": math.Inf(1)})
+
+	span := encodeSpan(t, recorder)
+	if span.Status().Code != codes.Error {
+		t.Errorf("status do span = %v, esperado erro", span.Status())
+	}
+	if _, ok := spanAttribute(span, "response.size_bytes"); ok {
+		t.Error("response.size_bytes não deveria estar definido quando a serialização falha")
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Modos de tratamento de nomes de cidade com UTF-8 inválido (INVALID_UTF8_MODE).
+const (
+	utf8ModeReplace = "replace" // remove os caracteres inválidos e continua
+	utf8ModeReject  = "reject"  // recusa o nome da cidade
+)
+
+// invalidUTF8Mode é o modo em uso. É preenchido em `main` a partir de INVALID_UTF8_MODE.
+var invalidUTF8Mode = utf8ModeReplace
+
+// ErrInvalidCityName indica um nome de cidade com codificação inválida que não pôde
+// (ou não deve, no modo "reject") ser corrigido.
+var ErrInvalidCityName = errors.New("invalid city name encoding")
+
+// sanitizeCity garante que o nome da cidade é UTF-8 válido antes de ser usado na query
+// da WeatherAPI ou na resposta JSON. O ViaCEP devolve por vezes nomes mal codificados,
+// que o decoder de JSON converte em U+FFFD; tratamos ambos os casos da mesma forma.
+// Quando há correção, fica registado o evento "city.sanitized" no span.
+func sanitizeCity(span trace.Span, city string) (string, error) {
+	if utf8.ValidString(city) && !strings.ContainsRune(city, utf8.RuneError) {
+		return city, nil
+	}
+
+	sanitized := strings.ToValidUTF8(city, "")
+	sanitized = strings.TrimSpace(strings.ReplaceAll(sanitized, string(utf8.RuneError), ""))
+	span.AddEvent("city.sanitized", trace.WithAttributes(
+		attribute.String("city.sanitized", sanitized),
+		attribute.String("city.invalid_utf8_mode", invalidUTF8Mode),
+	))
+
+	if invalidUTF8Mode == utf8ModeReject || sanitized == "" {
+		return "", ErrInvalidCityName
+	}
+	return sanitized, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// setInvalidUTF8Mode define `invalidUTF8Mode` durante o teste.
+func setInvalidUTF8Mode(t *testing.T, mode string) {
+	t.Helper()
+	previous := invalidUTF8Mode
+	invalidUTF8Mode = mode
+	t.Cleanup(func() { invalidUTF8Mode = previous })
+}
+
+func TestSanitizeCity(t *testing.T) {
+	tests := []struct {
+		name, mode, city, want string
+		wantErr                bool
+	}{
+		{"nome válido", utf8ModeReplace, "São Paulo", "São Paulo", false},
+		{"byte inválido", utf8ModeReplace, "S\xe3o Paulo", "So Paulo", false},
+		{"caractere de substituição", utf8ModeReplace, "S�o Paulo", "So Paulo", false},
+		{"apenas bytes inválidos", utf8ModeReplace, "\xff\xfe", "", true},
+		{"modo reject", utf8ModeReject, "S\xe3o Paulo", "", true},
+		{"nome válido no modo reject", utf8ModeReject, "Curitiba", "Curitiba", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setInvalidUTF8Mode(t, tt.mode)
+			got, err := sanitizeCity(noSpan, tt.city)
+			if got != tt.want || errors.Is(err, ErrInvalidCityName) != tt.wantErr {
+				t.Errorf("sanitizeCity(%q) = %q, %v, esperado %q (erro: %v)", tt.city, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFetchLocationSanitizesInvalidCity(t *testing.T) {
+	// O ViaCEP devolve a cidade em Latin-1 em vez de UTF-8.
+	malformed := jsonHandler("{\"localidade\":\"S\xe3o Paulo\",\"uf\":\"SP\"}")
+	for _, mode := range []string{utf8ModeReplace, utf8ModeReject} {
+		t.Run(mode, func(t *testing.T) {
+			setInvalidUTF8Mode(t, mode)
+			recorder := tracetest.NewSpanRecorder()
+			tr := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+			stubUpstreams(t, malformed, nil)
+
+			location, err := fetchLocation(context.Background(), tr, "01001000")
+			if len(spanEvents(recorder, "city.sanitized")) != 1 {
+				t.Error("esperado o evento city.sanitized")
+			}
+			if mode == utf8ModeReject {
+				if status, _ := fetchErrorStatus(err); status != http.StatusBadGateway {
+					t.Errorf("status = %d (erro %v), esperado 502", status, err)
+				}
+				return
+			}
+			if err != nil || location.Localidade != "So Paulo" {
+				t.Errorf("fetchLocation = %+v, %v, esperado a cidade corrigida", location, err)
+			}
+		})
+	}
+}
+
+func TestFetchWeatherRejectsInvalidCity(t *testing.T) {
+	setInvalidUTF8Mode(t, utf8ModeReject)
+	var calls int
+	stubUpstreams(t, nil, http.HandlerFunc(func(http.ResponseWriter, *http.Request) { calls++ }))
+
+	_, err := fetchWeather(context.Background(), testTracer, "S\xe3o Paulo")
+	if status, _ := fetchErrorStatus(err); status != http.StatusUnprocessableEntity {
+		t.Errorf("status = %d (erro %v), esperado 422", status, err)
+	}
+	if calls != 0 {
+		t.Error("a WeatherAPI não deveria ser chamada com um nome inválido")
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"Observabilidade/logging"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// defaultStreamInterval é o intervalo padrão entre atualizações do stream SSE.
+const defaultStreamInterval = 30 * time.Second
+
+// streamInterval é o intervalo entre atualizações do stream. É preenchido em `main`
+// a partir de STREAM_INTERVAL.
+var streamInterval = defaultStreamInterval
+
+// StreamWeatherHandler envia o clima do CEP como Server-Sent Events: uma atualização
+// imediata e depois uma a cada `streamInterval`, até o cliente se desligar. O span do
+// servidor dura todo o stream e cada atualização gera um span filho "stream.push".
+// Ex: GET /weather/01001000/stream
+func StreamWeatherHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	tracer := otel.Tracer("service-b-tracer")
+
+	cep := chi.URLParam(r, "cep")
+	if !isValidCEP(cep) {
+		writeError(w, r, http.StatusUnprocessableEntity, "invalid zipcode")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, r, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.String("cep", cep))
+	annotateBaggage(ctx)
+	ctx = logging.With(ctx, "cep", cep)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	ticker := time.NewTicker(streamInterval)
+	defer ticker.Stop()
+
+	for seq := 1; ; seq++ {
+		more := pushWeather(ctx, tracer, w, cep, seq)
+		flusher.Flush()
+		if !more {
+			span.SetAttributes(attribute.Int("stream.pushes", seq))
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			// O cliente desligou-se (ou o serviço está a encerrar): terminamos o stream e,
+			// com ele, o span do servidor.
+			span.AddEvent("stream.client_disconnected")
+			span.SetAttributes(attribute.Int("stream.pushes", seq))
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pushWeather consulta o clima e envia-o como um evento `weather` (ou `error`), dentro de
+// um span filho. Devolve false quando não vale a pena continuar (CEP inexistente ou
+// cliente desligado).
+func pushWeather(ctx context.Context, tr trace.Tracer, w http.ResponseWriter, cep string, seq int) bool {
+	ctx, span := tr.Start(ctx, "stream.push", trace.WithAttributes(attribute.Int("stream.seq", seq)))
+	defer span.End()
+
+	location, err := fetchLocation(ctx, tr, cep)
+	var weather *WeatherAPIResponse
+	if err == nil {
+		weather, err = fetchWeather(ctx, tr, weatherQuery(ctx, tr, location))
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return false
+		}
+		_, message := fetchErrorStatus(err)
+		fmt.Fprintf(w, "event: error\nid: %d\ndata: %s\n\n", seq, message)
+		return !errors.Is(err, ErrZipcodeNotFound)
+	}
+
+	response := newFinalResponse(location.Localidade, weather.Current.TempC)
+	response.DataAgeSeconds = dataAgeSeconds(weather.Current.LastUpdatedEpoch, time.Now())
+	if invalidResponse(ctx, response) != nil {
+		fmt.Fprintf(w, "event: error\nid: %d\ndata: %s\n\n", seq, invalidResponseMessage)
+		return true
+	}
+	data, err := json.Marshal(response)
+	if err != nil {
+		recordFailure(span, err)
+		return false
+	}
+	if _, err := fmt.Fprintf(w, "event: weather\nid: %d\ndata: %s\n\n", seq, data); err != nil {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// sseEvent é um evento recebido do stream SSE.
+type sseEvent struct {
+	name, id, data string
+}
+
+// openStream abre o stream do CEP indicado num servidor real e devolve um canal com os
+// eventos recebidos. Cancelar o contexto desliga o cliente.
+func openStream(t *testing.T, ctx context.Context, cep string) <-chan sseEvent {
+	t.Helper()
+	r := chi.NewRouter()
+	registerRoutes(r)
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/weather/"+cep+"/stream", nil)
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q, esperado text/event-stream", ct)
+	}
+
+	events := make(chan sseEvent)
+	go func() {
+		defer close(events)
+		defer resp.Body.Close()
+		var event sseEvent
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				events <- event
+				event = sseEvent{}
+			case strings.HasPrefix(line, "event: "):
+				event.name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "id: "):
+				event.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "data: "):
+				event.data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+	return events
+}
+
+// setStreamInterval define `streamInterval` durante o teste.
+func setStreamInterval(t *testing.T, interval time.Duration) {
+	t.Helper()
+	previous := streamInterval
+	streamInterval = interval
+	t.Cleanup(func() { streamInterval = previous })
+}
+
+// waitForSpan espera que o span com o nome indicado termine.
+func waitForSpan(t *testing.T, recorder *tracetest.SpanRecorder, name string) sdktrace.ReadOnlySpan {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, span := range recorder.Ended() {
+			if span.Name() == name {
+				return span
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("o span %q não terminou", name)
+	return nil
+}
+
+func TestStreamPushesUpdatesUntilDisconnect(t *testing.T) {
+	recorder := recordSpans(t)
+	setStreamInterval(t, 20*time.Millisecond)
+	stubUpstreams(t, jsonHandler(viaCEPSaoPaulo), jsonHandler(weatherSaoPaulo))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := openStream(t, ctx, "01001000")
+	for want := 1; want <= 3; want++ {
+		select {
+		case event := <-events:
+			if event.name != "weather" || event.id != strconv.Itoa(want) || !strings.Contains(event.data, `"city":"São Paulo"`) {
+				t.Fatalf("evento %d = %+v", want, event)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("o evento %d não chegou", want)
+		}
+	}
+	cancel()
+
+	// O span do servidor dura todo o stream e termina quando o cliente se desliga.
+	root := waitForSpan(t, recorder, "StreamWeatherHandler")
+	var disconnected bool
+	for _, event := range root.Events() {
+		disconnected = disconnected || event.Name == "stream.client_disconnected"
+	}
+	if !disconnected {
+		t.Error("esperado o evento stream.client_disconnected no span do servidor")
+	}
+	var pushes int
+	for _, span := range recorder.Ended() {
+		if span.Name() != "stream.push" {
+			continue
+		}
+		pushes++
+		if span.Parent().SpanID() != root.SpanContext().SpanID() {
+			t.Errorf("stream.push com pai %s, esperado o span do servidor %s", span.Parent().SpanID(), root.SpanContext().SpanID())
+		}
+	}
+	if pushes < 3 {
+		t.Errorf("spans stream.push = %d, esperado pelo menos 3", pushes)
+	}
+}
+
+func TestStreamEndsOnUnknownZipcode(t *testing.T) {
+	setStreamInterval(t, 20*time.Millisecond)
+	stubUpstreams(t, jsonHandler(`{"erro":"true"}`), jsonHandler(weatherSaoPaulo))
+
+	events := openStream(t, context.Background(), "99999999")
+	var got []sseEvent
+	timeout := time.After(2 * time.Second)
+	for done := false; !done; {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				done = true
+				break
+			}
+			got = append(got, event)
+		case <-timeout:
+			t.Fatal("o stream não terminou após o CEP inexistente")
+		}
+	}
+	if len(got) != 1 || got[0].name != "error" || got[0].data != "can not find zipcode" {
+		t.Errorf("eventos = %+v, esperado um único erro can not find zipcode", got)
+	}
+}
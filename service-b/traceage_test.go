@@ -0,0 +1,62 @@
+package main
+
+import (
+	trc "Observabilidade/tracer"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const incomingTraceID = "0102030405060708090a0b0c0d0e0f10"
+
+// receivedTraceID devolve o trace em que o handler instrumentado atende uma requisição
+// com o carimbo `obsts` indicado.
+func receivedTraceID(t *testing.T, stamp time.Time) string {
+	t.Helper()
+	var got trace.TraceID
+	handler := instrument(func(w http.ResponseWriter, r *http.Request) {
+		got = trace.SpanContextFromContext(r.Context()).TraceID()
+	}, "test")
+
+	req := httptest.NewRequest(http.MethodGet, "/weather/01001000", nil)
+	req.Header.Set("traceparent", "00-"+incomingTraceID+"-0102030405060708-01")
+	req.Header.Set("tracestate", trc.TraceAgeKey+"="+strconv.FormatInt(stamp.Unix(), 10))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	return got.String()
+}
+
+func setTraceContextMaxAge(t *testing.T, maxAge time.Duration) {
+	t.Helper()
+	previous := traceContextMaxAge
+	traceContextMaxAge = maxAge
+	t.Cleanup(func() { traceContextMaxAge = previous })
+}
+
+func TestInstrumentRejectsStaleTraceContext(t *testing.T) {
+	setTraceContextMaxAge(t, 5*time.Minute)
+
+	if got := receivedTraceID(t, time.Now()); got != incomingTraceID {
+		t.Errorf("um contexto recente deveria ser aceite: trace %s", got)
+	}
+	if got := receivedTraceID(t, time.Now().Add(-time.Hour)); got == incomingTraceID {
+		t.Error("um contexto com o carimbo expirado deveria iniciar um trace novo")
+	}
+}
+
+func TestInstrumentIgnoresStampWhenDisabled(t *testing.T) {
+	setTraceContextMaxAge(t, 0)
+	// Sem a verificação, vale o propagador global, registado em `main` por InitTracerProvider.
+	previous := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(previous) })
+
+	if got := receivedTraceID(t, time.Now().Add(-time.Hour)); got != incomingTraceID {
+		t.Errorf("sem TRACE_CONTEXT_MAX_AGE o carimbo não deveria ser verificado: trace %s", got)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"Observabilidade/logging"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	net_url "net/url"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// viaCEPBaseURL é o endereço base da API ViaCEP.
+const viaCEPBaseURL = "https://viacep.com.br"
+
+// maxIdleConnsPerHost é o número de ligações keep-alive mantidas por API externa. O valor
+// padrão do Go (2) obriga a novos handshakes TLS sempre que há mais requisições em paralelo.
+const maxIdleConnsPerHost = 16
+
+// warmupTimeout é o prazo de cada chamada de aquecimento das ligações.
+const warmupTimeout = 5 * time.Second
+
+// maxBodySnippetLength é o número máximo de bytes do corpo incluídos no evento de erro.
+const maxBodySnippetLength = 256
+
+// includeBodyOnError indica se os eventos de erro de decodificação incluem um excerto
+// do corpo da resposta. É definido em `main` a partir de TRACE_INCLUDE_BODY_ON_ERROR.
+var includeBodyOnError = false
+
+// upstreamClient é o cliente HTTP partilhado pelas chamadas às APIs externas (ViaCEP e
+// WeatherAPI). É configurado em `main` através de `newUpstreamClient`.
+var upstreamClient = http.DefaultClient
+
+// newUpstreamClient cria o cliente HTTP das chamadas às APIs externas. Por omissão respeita
+// as variáveis HTTP_PROXY/HTTPS_PROXY/NO_PROXY; quando `proxyURL` é indicado (via
+// UPSTREAM_PROXY_URL), esse proxy é usado para todas as chamadas externas. O tráfego para
+// o OTEL Collector usa gRPC e não passa por este cliente. `maxRedirects` (via
+// UPSTREAM_MAX_REDIRECTS) limita os redirecionamentos seguidos; ver checkRedirect.
+func newUpstreamClient(proxyURL string, maxRedirects int) (*http.Client, error) {
+	proxy := http.ProxyFromEnvironment
+	if proxyURL != "" {
+		u, err := net_url.Parse(proxyURL)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("UPSTREAM_PROXY_URL inválida: %q", proxyURL)
+		}
+		proxy = http.ProxyURL(u)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = tracedProxy(proxy)
+	transport.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	return &http.Client{Transport: transport, CheckRedirect: checkRedirect(maxRedirects)}, nil
+}
+
+// warmupConnections faz um HEAD a cada endereço base, deixando no pool do cliente uma
+// ligação keep-alive já estabelecida (DNS, TCP e TLS). É chamada em segundo plano no
+// arranque; as falhas não são fatais e apenas ficam registadas nos logs.
+func warmupConnections(client *http.Client, baseURLs ...string) {
+	logger := logging.Default()
+	for _, baseURL := range baseURLs {
+		ctx, cancel := context.WithTimeout(context.Background(), warmupTimeout)
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, baseURL+"/", nil)
+		if err == nil {
+			var resp *http.Response
+			if resp, err = client.Do(req); err == nil {
+				// Ler o corpo até ao fim devolve a ligação ao pool de ligações inativas.
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}
+		}
+		cancel()
+
+		if err != nil {
+			logger.Warn("falha ao aquecer ligação", "url", baseURL, "error", err)
+			continue
+		}
+		logger.Info("ligação aquecida", "url", baseURL)
+	}
+}
+
+// tracedProxy envolve a função de seleção de proxy e regista no span da chamada o proxy
+// usado. Guardamos apenas o host, para que eventuais credenciais da URL não sejam exportadas.
+func tracedProxy(proxy func(*http.Request) (*net_url.URL, error)) func(*http.Request) (*net_url.URL, error) {
+	return func(req *http.Request) (*net_url.URL, error) {
+		u, err := proxy(req)
+		if u != nil {
+			trace.SpanFromContext(req.Context()).SetAttributes(attribute.String("http.proxy", u.Host))
+		}
+		return u, err
+	}
+}
+
+// redactedURL oculta a palavra-passe de uma URL (ex: de um proxy com credenciais),
+// para que possa ser registada nos logs.
+func redactedURL(raw string) string {
+	u, err := net_url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	return u.Redacted()
+}
+
+// recordFailure marca o span da chamada externa como falhado, registando o erro.
+func recordFailure(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// recordDecodeError regista no span o evento `response.decode_error` quando a resposta de
+// uma API externa não é o JSON esperado. Com `includeBodyOnError`, o evento inclui os
+// primeiros bytes do corpo, o que acelera o diagnóstico de mudanças de formato. As
+// respostas das APIs externas não contêm a nossa chave, por isso o excerto é seguro.
+func recordDecodeError(span trace.Span, provider string, err error, body []byte) {
+	recordFailure(span, err)
+
+	attrs := []attribute.KeyValue{
+		attribute.String("provider", provider),
+		attribute.String("error", err.Error()),
+		attribute.Int("body.size", len(body)),
+	}
+	if includeBodyOnError {
+		attrs = append(attrs, attribute.String("body.snippet", bodySnippet(body)))
+	}
+	span.AddEvent("response.decode_error", trace.WithAttributes(attrs...))
+}
+
+// bodySnippet devolve os primeiros bytes do corpo como texto UTF-8 válido, substituindo
+// os caracteres de controlo (ex: quebras de linha) por espaços.
+func bodySnippet(body []byte) string {
+	truncated := len(body) > maxBodySnippetLength
+	if truncated {
+		body = body[:maxBodySnippetLength]
+	}
+	snippet := strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, strings.ToValidUTF8(string(body), "\uFFFD"))
+	if truncated {
+		snippet += "…"
+	}
+	return snippet
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"Observabilidade/logging"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Limites plausíveis da temperatura (°C), um pouco além dos recordes registados na Terra.
+const (
+	minPlausibleTempC = -90
+	maxPlausibleTempC = 60
+)
+
+// invalidResponseMessage é a mensagem enviada ao cliente quando a resposta é recusada.
+const invalidResponseMessage = "invalid upstream data"
+
+// validateResponses ativa a verificação das respostas antes de serem enviadas. É
+// preenchido em `main` a partir de VALIDATE_RESPONSE e fica desativado por omissão.
+var validateResponses bool
+
+// checkFinalResponse verifica que a resposta tem uma cidade e uma temperatura plausível.
+func checkFinalResponse(response FinalResponse) error {
+	var errs []error
+	if strings.TrimSpace(response.City) == "" {
+		errs = append(errs, errors.New("cidade vazia"))
+	}
+	if response.TempC < minPlausibleTempC || response.TempC > maxPlausibleTempC {
+		errs = append(errs, fmt.Errorf("temperatura fora do intervalo plausível (%d a %d °C): %v",
+			minPlausibleTempC, maxPlausibleTempC, response.TempC))
+	}
+	return errors.Join(errs...)
+}
+
+// invalidResponse devolve o erro de checkFinalResponse quando VALIDATE_RESPONSE=true,
+// registando-o no span (evento `response.invalid`) e nos logs. Uma resposta inválida
+// indica dados incoerentes das APIs externas.
+func invalidResponse(ctx context.Context, response FinalResponse) error {
+	if !validateResponses {
+		return nil
+	}
+	err := checkFinalResponse(response)
+	if err == nil {
+		return nil
+	}
+	trace.SpanFromContext(ctx).AddEvent("response.invalid", trace.WithAttributes(
+		attribute.String("error", err.Error()),
+	))
+	logging.LoggerFromContext(ctx).Error("resposta inválida montada a partir das APIs externas", "error", err)
+	return err
+}
+
+// rejectInvalidResponse responde 502 quando a resposta montada é inválida (ver
+// invalidResponse), em vez de devolver dados errados. Devolve true quando a recusou.
+func rejectInvalidResponse(w http.ResponseWriter, r *http.Request, response FinalResponse) bool {
+	if invalidResponse(r.Context(), response) == nil {
+		return false
+	}
+	writeError(w, r, http.StatusBadGateway, invalidResponseMessage)
+	return true
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// setValidateResponses define `validateResponses` durante o teste.
+func setValidateResponses(t *testing.T, enabled bool) {
+	t.Helper()
+	previous := validateResponses
+	validateResponses = enabled
+	t.Cleanup(func() { validateResponses = previous })
+}
+
+func TestCheckFinalResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		response FinalResponse
+		wantErr  bool
+	}{
+		{"válida", FinalResponse{City: "São Paulo", TempC: 25}, false},
+		{"limite inferior", FinalResponse{City: "Vostok", TempC: -90}, false},
+		{"limite superior", FinalResponse{City: "Death Valley", TempC: 60}, false},
+		{"temperatura acima do intervalo", FinalResponse{City: "São Paulo", TempC: 75}, true},
+		{"temperatura abaixo do intervalo", FinalResponse{City: "São Paulo", TempC: -120}, true},
+		{"cidade vazia", FinalResponse{TempC: 25}, true},
+		{"cidade só com espaços", FinalResponse{City: "  ", TempC: 25}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkFinalResponse(tt.response); (err != nil) != tt.wantErr {
+				t.Errorf("checkFinalResponse(%+v) = %v, esperado erro: %v", tt.response, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInvalidResponseIsRejected(t *testing.T) {
+	tests := []struct {
+		name, viaCEP, weather string
+	}{
+		{"temperatura fora do intervalo", viaCEPSaoPaulo, `{"current":{"temp_c":75}}`},
+		{"cidade vazia", `{"localidade":" ","uf":"SP"}`, weatherSaoPaulo},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := recordSpans(t)
+			setValidateResponses(t, true)
+			stubUpstreams(t, jsonHandler(tt.viaCEP), jsonHandler(tt.weather))
+			r := chi.NewRouter()
+			registerRoutes(r)
+
+			rec := getWeatherResponse(r, "01001000")
+			if rec.Code != http.StatusBadGateway {
+				t.Fatalf("status = %d, esperado 502: %s", rec.Code, rec.Body)
+			}
+			if body := strings.TrimSpace(rec.Body.String()); body != invalidResponseMessage {
+				t.Errorf("corpo = %q, esperado %q", body, invalidResponseMessage)
+			}
+			if len(spanEvents(recorder, "response.invalid")) != 1 {
+				t.Error("esperado o evento response.invalid no span")
+			}
+		})
+	}
+}
+
+func TestInvalidResponseAllowedByDefault(t *testing.T) {
+	setValidateResponses(t, false)
+	stubUpstreams(t, jsonHandler(viaCEPSaoPaulo), jsonHandler(`{"current":{"temp_c":75}}`))
+	r := chi.NewRouter()
+	registerRoutes(r)
+
+	if rec := getWeatherResponse(r, "01001000"); rec.Code != http.StatusOK {
+		t.Errorf("status = %d, esperado 200 sem VALIDATE_RESPONSE", rec.Code)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// viaCEPParser converte o corpo da resposta do ViaCEP num ViaCEPResponse.
+type viaCEPParser func(body []byte) (ViaCEPResponse, error)
+
+// viaCEPParsers associa cada formato suportado pelo ViaCEP (o segmento do caminho em
+// /ws/{cep}/{formato}/) ao respetivo parser.
+var viaCEPParsers = map[string]viaCEPParser{
+	"json":  parseViaCEPJSON,
+	"xml":   parseViaCEPXML,
+	"piped": parseViaCEPPiped,
+}
+
+// viaCEPFormat é o formato pedido ao ViaCEP. É preenchido em `main` a partir de
+// VIACEP_FORMAT; o JSON é o formato recomendado, os restantes servem testes de interoperabilidade.
+var viaCEPFormat = "json"
+
+func parseViaCEPJSON(body []byte) (ViaCEPResponse, error) {
+	var r ViaCEPResponse
+	err := json.Unmarshal(body, &r)
+	return r, err
+}
+
+func parseViaCEPXML(body []byte) (ViaCEPResponse, error) {
+	var r ViaCEPResponse
+	err := xml.Unmarshal(body, &r)
+	return r, err
+}
+
+// parseViaCEPPiped interpreta o formato "piped": pares `chave:valor` separados por `|`.
+// Ex: "cep:01001-000|logradouro:Praça da Sé|localidade:São Paulo|uf:SP" ou "erro:true".
+func parseViaCEPPiped(body []byte) (ViaCEPResponse, error) {
+	var r ViaCEPResponse
+	found := false
+	for _, field := range strings.Split(strings.TrimSpace(string(body)), "|") {
+		key, value, ok := strings.Cut(field, ":")
+		if !ok {
+			return r, fmt.Errorf("campo inválido no formato piped: %q", field)
+		}
+		switch key {
+		case "localidade":
+			r.Localidade, found = value, true
+		case "uf":
+			r.UF = value
+		case "erro":
+			r.Erro, found = value, true
+		}
+	}
+	if !found {
+		return r, fmt.Errorf("resposta piped sem localidade")
+	}
+	return r, nil
+}
+
+// rawViaCEPBody devolve o corpo original como JSON para `?debug=raw`: tal como veio, no
+// formato JSON, ou como string JSON nos restantes formatos.
+func rawViaCEPBody(body []byte) json.RawMessage {
+	if viaCEPFormat == "json" {
+		return body
+	}
+	quoted, _ := json.Marshal(string(body))
+	return quoted
+}
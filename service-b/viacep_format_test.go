@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+// setViaCEPFormat define `viaCEPFormat` durante o teste.
+func setViaCEPFormat(t *testing.T, format string) {
+	t.Helper()
+	previous := viaCEPFormat
+	viaCEPFormat = format
+	t.Cleanup(func() { viaCEPFormat = previous })
+}
+
+func TestParseViaCEPPiped(t *testing.T) {
+	tests := []struct {
+		name, body string
+		want       ViaCEPResponse
+		wantErr    bool
+	}{
+		{"completo", "cep:01001-000|logradouro:Praça da Sé|localidade:São Paulo|uf:SP\n", ViaCEPResponse{Localidade: "São Paulo", UF: "SP"}, false},
+		{"valor com dois pontos", "localidade:Cidade: Centro|uf:XX", ViaCEPResponse{Localidade: "Cidade: Centro", UF: "XX"}, false},
+		{"CEP inexistente", "erro:true", ViaCEPResponse{Erro: "true"}, false},
+		{"campo sem separador", "localidade São Paulo", ViaCEPResponse{}, true},
+		{"sem localidade", "cep:01001-000|uf:SP", ViaCEPResponse{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseViaCEPPiped([]byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("erro = %v, esperado erro: %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (got.Localidade != tt.want.Localidade || got.UF != tt.want.UF || got.Erro != tt.want.Erro) {
+				t.Errorf("parseViaCEPPiped = %+v, esperado %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchLocationFormats(t *testing.T) {
+	tests := []struct {
+		format, body string
+	}{
+		{"json", viaCEPSaoPaulo},
+		{"xml", `<?xml version="1.0" encoding="UTF-8"?><xmlcep><cep>01001-000</cep><localidade>São Paulo</localidade><uf>SP</uf></xmlcep>`},
+		{"piped", "cep:01001-000|localidade:São Paulo|uf:SP"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			setViaCEPFormat(t, tt.format)
+			var path string
+			stubUpstreams(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				path = r.URL.Path
+				w.Write([]byte(tt.body))
+			}), nil)
+
+			location, err := fetchLocation(context.Background(), testTracer, "01001000")
+			if err != nil {
+				t.Fatalf("fetchLocation: %v", err)
+			}
+			if want := "/ws/01001000/" + tt.format + "/"; path != want {
+				t.Errorf("caminho pedido = %q, esperado %q", path, want)
+			}
+			if location.Localidade != "São Paulo" {
+				t.Errorf("localidade = %q, esperado São Paulo", location.Localidade)
+			}
+		})
+	}
+}
+
+func TestFetchLocationPipedNotFound(t *testing.T) {
+	setViaCEPFormat(t, "piped")
+	stubUpstreams(t, jsonHandler("erro:true"), nil)
+
+	if _, err := fetchLocation(context.Background(), testTracer, "99999999"); !errors.Is(err, ErrZipcodeNotFound) {
+		t.Errorf("erro = %v, esperado ErrZipcodeNotFound", err)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	net_url "net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// weatherAPIBaseURL é o endereço base da WeatherAPI.
+const weatherAPIBaseURL = "http://api.weatherapi.com"
+
+// Cabeçalhos de quota, quando a WeatherAPI (ou um gateway à sua frente) os envia.
+const (
+	rateLimitRemainingHeader = "X-RateLimit-Remaining"
+	rateLimitResetHeader     = "X-RateLimit-Reset"
+	retryAfterHeader         = "Retry-After"
+)
+
+// defaultQuotaCooldown é o tempo de espera após esgotar a quota quando a resposta não
+// indica quando esta será reposta.
+const defaultQuotaCooldown = time.Minute
+
+// ErrWeatherQuotaExhausted indica que a chamada foi recusada localmente porque a quota
+// da WeatherAPI está esgotada (ou abaixo da reserva configurada).
+var ErrWeatherQuotaExhausted = errors.New("weatherapi quota exhausted")
+
+// weatherAPI é o cliente usado por `fetchWeather`. É configurado em `main`.
+var weatherAPI = newWeatherClient(http.DefaultClient, "", 0)
+
+// weatherClient concentra todas as chamadas à WeatherAPI. Acompanha a quota restante a
+// partir dos cabeçalhos de rate limit das respostas e recusa novas chamadas quando a quota
+// fica abaixo da reserva, até ao momento da reposição. Sem esses cabeçalhos, comporta-se
+// como um cliente normal.
+type weatherClient struct {
+	httpClient *http.Client
+	baseURL    string
+	apiKey     string
+	reserve    int
+
+	mu        sync.Mutex
+	remaining int // -1 enquanto a quota é desconhecida
+	resetAt   time.Time
+}
+
+// newWeatherClient cria o cliente da WeatherAPI. `reserve` é o número de chamadas a
+// manter de reserva: quando a quota restante chega a esse valor, as chamadas são recusadas.
+func newWeatherClient(httpClient *http.Client, apiKey string, reserve int) *weatherClient {
+	return &weatherClient{
+		httpClient: httpClient,
+		baseURL:    weatherAPIBaseURL,
+		apiKey:     apiKey,
+		reserve:    reserve,
+		remaining:  -1,
+	}
+}
+
+// get executa um GET ao endpoint indicado, acrescentando a chave da API à query string.
+// A quota restante conhecida é registada no span do contexto. Falhas da chamada são
+// devolvidas como *UpstreamError.
+func (c *weatherClient) get(ctx context.Context, path string, query net_url.Values) (*http.Response, error) {
+	if c.apiKey == "" {
+		return nil, errors.New("WEATHER_API_KEY não definida")
+	}
+	span := trace.SpanFromContext(ctx)
+	if err := c.allow(span); err != nil {
+		return nil, err
+	}
+
+	q := net_url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	q.Set("key", c.apiKey)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		// `newUpstreamError` descarta a URL do erro, que contém a chave da API.
+		return nil, newUpstreamError("weatherapi", 0, err)
+	}
+	c.observe(span, resp)
+	return resp, nil
+}
+
+// allow recusa a chamada enquanto a quota estiver abaixo da reserva e o prazo de
+// reposição não tiver passado.
+func (c *weatherClient) allow(span trace.Span) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.remaining < 0 {
+		return nil
+	}
+	span.SetAttributes(attribute.Int("weatherapi.quota.remaining", c.remaining))
+	if c.remaining > c.reserve {
+		return nil
+	}
+	if time.Now().After(c.resetAt) {
+		// O prazo passou: voltamos a considerar a quota desconhecida até à próxima resposta.
+		c.remaining = -1
+		return nil
+	}
+	span.AddEvent("weatherapi.quota.rejected", trace.WithAttributes(
+		attribute.Int("weatherapi.quota.remaining", c.remaining),
+		attribute.String("weatherapi.quota.reset_at", c.resetAt.Format(time.RFC3339)),
+	))
+	return ErrWeatherQuotaExhausted
+}
+
+// observe atualiza a quota a partir dos cabeçalhos da resposta. Um 429 conta como quota
+// esgotada, com a reposição indicada por `Retry-After` quando presente.
+func (c *weatherClient) observe(span trace.Span, resp *http.Response) {
+	remaining, hasRemaining := headerInt(resp.Header, rateLimitRemainingHeader)
+	if resp.StatusCode == http.StatusTooManyRequests {
+		remaining, hasRemaining = 0, true
+	}
+	if !hasRemaining {
+		return
+	}
+
+	resetIn := defaultQuotaCooldown
+	if seconds, ok := headerInt(resp.Header, rateLimitResetHeader); ok {
+		resetIn = time.Duration(seconds) * time.Second
+	} else if seconds, ok := headerInt(resp.Header, retryAfterHeader); ok {
+		resetIn = time.Duration(seconds) * time.Second
+	}
+
+	c.mu.Lock()
+	c.remaining = remaining
+	c.resetAt = time.Now().Add(resetIn)
+	c.mu.Unlock()
+
+	span.SetAttributes(attribute.Int("weatherapi.quota.remaining", remaining))
+}
+
+// quotaRemaining devolve a quota restante conhecida, ou false enquanto for desconhecida.
+func (c *weatherClient) quotaRemaining() (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.remaining, c.remaining >= 0
+}
+
+// headerInt lê um cabeçalho numérico não negativo.
+func headerInt(h http.Header, key string) (int, bool) {
+	n, err := strconv.Atoi(h.Get(key))
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
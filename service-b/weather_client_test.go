@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// quotaServer simula a WeatherAPI: cada resposta indica a quota restante devolvida por
+// `remaining` (nenhum cabeçalho quando é negativa) e o prazo de reposição em segundos.
+func quotaServer(t *testing.T, remaining func(call int32) int, reset string) (*weatherClient, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := calls.Add(1)
+		if r.URL.Query().Get("key") != "test-key" {
+			t.Errorf("chave da API não enviada: %q", r.URL.RawQuery)
+		}
+		if n := remaining(call); n >= 0 {
+			w.Header().Set(rateLimitRemainingHeader, strconv.Itoa(n))
+			w.Header().Set(rateLimitResetHeader, reset)
+		}
+		w.Write([]byte(weatherSaoPaulo))
+	}))
+	t.Cleanup(srv.Close)
+	client := newWeatherClient(srv.Client(), "test-key", 2)
+	client.baseURL = srv.URL
+	return client, &calls
+}
+
+// getWeather faz uma chamada ao cliente e fecha o corpo da resposta.
+func getWeather(c *weatherClient) error {
+	resp, err := c.get(context.Background(), "/v1/current.json", nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func TestWeatherClientRejectsAtReserve(t *testing.T) {
+	client, calls := quotaServer(t, func(call int32) int { return 4 - int(call) }, "60")
+
+	// A quota desce de 3 para 2; com a reserva de 2, a terceira chamada é recusada localmente.
+	for i := 0; i < 2; i++ {
+		if err := getWeather(client); err != nil {
+			t.Fatalf("chamada %d: %v", i+1, err)
+		}
+	}
+	if err := getWeather(client); !errors.Is(err, ErrWeatherQuotaExhausted) {
+		t.Fatalf("erro = %v, esperado ErrWeatherQuotaExhausted", err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("chamadas à WeatherAPI = %d, esperado 2", got)
+	}
+	if remaining, ok := client.quotaRemaining(); !ok || remaining != 2 {
+		t.Errorf("quotaRemaining = %d, %v, esperado 2", remaining, ok)
+	}
+}
+
+func TestWeatherClientResumesAfterReset(t *testing.T) {
+	client, calls := quotaServer(t, func(int32) int { return 0 }, "0")
+
+	// Com a reposição imediata, a quota volta a ser desconhecida e a chamada segue.
+	for i := 0; i < 2; i++ {
+		if err := getWeather(client); err != nil {
+			t.Fatalf("chamada %d: %v", i+1, err)
+		}
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("chamadas à WeatherAPI = %d, esperado 2", got)
+	}
+}
+
+func TestWeatherClientTooManyRequests(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set(retryAfterHeader, "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	t.Cleanup(srv.Close)
+	client := newWeatherClient(srv.Client(), "test-key", 0)
+	client.baseURL = srv.URL
+
+	getWeather(client)
+	if err := getWeather(client); !errors.Is(err, ErrWeatherQuotaExhausted) {
+		t.Fatalf("erro = %v, esperado ErrWeatherQuotaExhausted após um 429", err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("chamadas à WeatherAPI = %d, esperado 1", got)
+	}
+}
+
+func TestWeatherClientWithoutQuotaHeaders(t *testing.T) {
+	client, calls := quotaServer(t, func(int32) int { return -1 }, "")
+
+	for i := 0; i < 5; i++ {
+		if err := getWeather(client); err != nil {
+			t.Fatalf("chamada %d: %v", i+1, err)
+		}
+	}
+	if got := calls.Load(); got != 5 {
+		t.Errorf("chamadas à WeatherAPI = %d, esperado 5", got)
+	}
+	if _, ok := client.quotaRemaining(); ok {
+		t.Error("sem cabeçalhos, a quota deveria continuar desconhecida")
+	}
+}
+
+func TestWeatherQuotaGauge(t *testing.T) {
+	reader := testMetricReader()
+	client, _ := quotaServer(t, func(int32) int { return 42 }, "60")
+	previous := weatherAPI
+	weatherAPI = client
+	t.Cleanup(func() { weatherAPI = previous })
+
+	if err := getWeather(client); err != nil {
+		t.Fatal(err)
+	}
+	points := collectMetric(t, reader, "weatherapi.quota.remaining").(metricdata.Gauge[int64]).DataPoints
+	if len(points) != 1 || points[0].Value != 42 {
+		t.Fatalf("weatherapi.quota.remaining = %v, esperado 42", points)
+	}
+}
@@ -0,0 +1,91 @@
+package signing
+
+import (
+	"Observabilidade/logging"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Cabeçalhos com a assinatura HMAC e o instante (segundos Unix) em que foi calculada.
+const (
+	SignatureHeader = "X-Signature"
+	TimestampHeader = "X-Timestamp"
+)
+
+// DefaultMaxSkew é a idade máxima (em qualquer sentido) aceite para uma assinatura.
+const DefaultMaxSkew = 5 * time.Minute
+
+// Erros devolvidos por Verify.
+var (
+	ErrMissingSignature = errors.New("assinatura em falta")
+	ErrInvalidSignature = errors.New("assinatura inválida")
+	ErrExpiredSignature = errors.New("assinatura expirada")
+)
+
+// Sign assina a requisição com um HMAC-SHA256 sobre o método, o caminho e o instante
+// atual, usando o segredo partilhado entre os serviços.
+func Sign(req *http.Request, secret []byte) {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(TimestampHeader, ts)
+	req.Header.Set(SignatureHeader, signature(secret, req.Method, req.URL.EscapedPath(), ts))
+}
+
+// Verify confirma que a assinatura da requisição foi calculada com o segredo partilhado
+// e que o seu instante não difere do atual mais do que `maxSkew`, limitando a repetição
+// de requisições intercetadas.
+func Verify(r *http.Request, secret []byte, maxSkew time.Duration) error {
+	ts := r.Header.Get(TimestampHeader)
+	sig := r.Header.Get(SignatureHeader)
+	if ts == "" || sig == "" {
+		return ErrMissingSignature
+	}
+	expected := signature(secret, r.Method, r.URL.EscapedPath(), ts)
+	if !hmac.Equal([]byte(sig), []byte(expected)) {
+		return ErrInvalidSignature
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if age := time.Since(time.Unix(unix, 0)); age > maxSkew || age < -maxSkew {
+		return ErrExpiredSignature
+	}
+	return nil
+}
+
+// Middleware rejeita com 401 as requisições sem uma assinatura válida. Sem segredo, não
+// faz nada, para que a verificação seja opcional. Deve envolver o handler dentro do
+// middleware do OTEL e de `logging.Middleware`, para que a rejeição fique no span e no log.
+func Middleware(secret []byte, maxSkew time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(secret) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := Verify(r, secret, maxSkew); err != nil {
+				trace.SpanFromContext(r.Context()).AddEvent("signature.rejected", trace.WithAttributes(
+					attribute.String("error", err.Error()),
+				))
+				logging.LoggerFromContext(r.Context()).Warn("requisição com assinatura rejeitada", "error", err)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// signature calcula o HMAC-SHA256, em hexadecimal, de "método\ncaminho\ninstante".
+func signature(secret []byte, method, path, ts string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(method + "\n" + path + "\n" + ts))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,110 @@
+package signing
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var secret = []byte("segredo-partilhado")
+
+// signedRequest devolve um GET assinado para o caminho indicado.
+func signedRequest(path string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	Sign(req, secret)
+	return req
+}
+
+// signAt assina a requisição como se o instante atual fosse `at`.
+func signAt(req *http.Request, at time.Time) {
+	ts := strconv.FormatInt(at.Unix(), 10)
+	req.Header.Set(TimestampHeader, ts)
+	req.Header.Set(SignatureHeader, signature(secret, req.Method, req.URL.EscapedPath(), ts))
+}
+
+func TestVerifyValidSignature(t *testing.T) {
+	if err := Verify(signedRequest("/weather/01001000"), secret, DefaultMaxSkew); err != nil {
+		t.Fatalf("Verify = %v, esperado uma assinatura válida", err)
+	}
+}
+
+func TestVerifyTamperedSignature(t *testing.T) {
+	tests := map[string]func(*http.Request){
+		"caminho alterado": func(r *http.Request) { r.URL.Path = "/weather/99999999" },
+		"método alterado":  func(r *http.Request) { r.Method = http.MethodPost },
+		"instante alterado": func(r *http.Request) {
+			r.Header.Set(TimestampHeader, strconv.FormatInt(time.Now().Unix()+1, 10))
+		},
+		"assinatura alterada": func(r *http.Request) {
+			r.Header.Set(SignatureHeader, signature([]byte("outro"), r.Method, r.URL.EscapedPath(), r.Header.Get(TimestampHeader)))
+		},
+		"instante inválido": func(r *http.Request) { r.Header.Set(TimestampHeader, "ontem") },
+	}
+	for name, tamper := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := signedRequest("/weather/01001000")
+			tamper(req)
+			if err := Verify(req, secret, DefaultMaxSkew); !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("Verify = %v, esperado ErrInvalidSignature", err)
+			}
+		})
+	}
+}
+
+func TestVerifyWrongSecret(t *testing.T) {
+	req := signedRequest("/weather/01001000")
+	if err := Verify(req, []byte("outro-segredo"), DefaultMaxSkew); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify = %v, esperado ErrInvalidSignature", err)
+	}
+}
+
+func TestVerifyExpiredSignature(t *testing.T) {
+	for name, at := range map[string]time.Time{
+		"antiga":    time.Now().Add(-DefaultMaxSkew - time.Minute),
+		"no futuro": time.Now().Add(DefaultMaxSkew + time.Minute),
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/weather/01001000", nil)
+			signAt(req, at)
+			if err := Verify(req, secret, DefaultMaxSkew); !errors.Is(err, ErrExpiredSignature) {
+				t.Errorf("Verify = %v, esperado ErrExpiredSignature", err)
+			}
+		})
+	}
+}
+
+func TestVerifyMissingSignature(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/weather/01001000", nil)
+	if err := Verify(req, secret, DefaultMaxSkew); !errors.Is(err, ErrMissingSignature) {
+		t.Errorf("Verify = %v, esperado ErrMissingSignature", err)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	expired := httptest.NewRequest(http.MethodGet, "/weather/01001000", nil)
+	signAt(expired, time.Now().Add(-time.Hour))
+	tests := []struct {
+		name   string
+		secret []byte
+		req    *http.Request
+		want   int
+	}{
+		{"assinatura válida", secret, signedRequest("/weather/01001000"), http.StatusOK},
+		{"sem assinatura", secret, httptest.NewRequest(http.MethodGet, "/weather/01001000", nil), http.StatusUnauthorized},
+		{"assinatura expirada", secret, expired, http.StatusUnauthorized},
+		{"sem segredo configurado", nil, httptest.NewRequest(http.MethodGet, "/weather/01001000", nil), http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := Middleware(tt.secret, DefaultMaxSkew)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, tt.req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, esperado %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
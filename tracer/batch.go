@@ -0,0 +1,61 @@
+package tracer
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// estimatedSpanSize é o tamanho médio estimado (em bytes) de um span serializado em OTLP,
+// com os atributos e eventos que os nossos serviços costumam registar.
+const estimatedSpanSize = 1024
+
+// batchOptions converte a configuração do processamento em lotes nas opções do SDK:
+// MaxQueueSize (spans em fila), MaxExportBatchSize (spans por lote) e ScheduleDelay
+// (intervalo entre envios). Os valores a zero mantêm o padrão do SDK. Com
+// MaxPayloadBytes, o tamanho dos lotes é ainda limitado para que cada exportação fique
+// abaixo desse tamanho em redes limitadas.
+func batchOptions(cfg Config) []sdktrace.BatchSpanProcessorOption {
+	var opts []sdktrace.BatchSpanProcessorOption
+	if cfg.MaxQueueSize > 0 {
+		opts = append(opts, sdktrace.WithMaxQueueSize(cfg.MaxQueueSize))
+	}
+	if cfg.ScheduleDelay > 0 {
+		opts = append(opts, sdktrace.WithBatchTimeout(cfg.ScheduleDelay))
+	}
+
+	batchSize := cfg.MaxExportBatchSize
+	if cfg.MaxPayloadBytes > 0 {
+		if batchSize == 0 {
+			batchSize = sdktrace.DefaultMaxExportBatchSize
+		}
+		batchSize = batchSizeForPayload(cfg.MaxPayloadBytes, batchSize)
+	}
+	if batchSize > 0 {
+		opts = append(opts, sdktrace.WithMaxExportBatchSize(batchSize))
+	}
+	return opts
+}
+
+// batchSizeForPayload devolve quantos spans cabem no payload indicado, entre 1 (um lote
+// nunca fica vazio, mesmo com um limite inferior ao tamanho de um span) e `limit`, o
+// tamanho de lote configurado, que o limite de payload nunca aumenta.
+func batchSizeForPayload(maxBytes, limit int) int {
+	return min(max(maxBytes/estimatedSpanSize, 1), limit)
+}
+
+// positiveIntFromEnv lê um inteiro positivo da variável indicada. Devolve zero quando a
+// variável não está definida.
+func positiveIntFromEnv(key string) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%s deve ser um inteiro positivo: %q", key, value)
+	}
+	return n, nil
+}
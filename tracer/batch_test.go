@@ -0,0 +1,51 @@
+package tracer
+
+import (
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// effectiveBatchOptions aplica as opções de batchOptions e devolve o resultado.
+func effectiveBatchOptions(cfg Config) sdktrace.BatchSpanProcessorOptions {
+	var o sdktrace.BatchSpanProcessorOptions
+	for _, opt := range batchOptions(cfg) {
+		opt(&o)
+	}
+	return o
+}
+
+func TestBatchSizeRespectsPayloadCap(t *testing.T) {
+	tests := []struct {
+		name                 string
+		maxBatch, maxPayload int
+		want                 int
+	}{
+		{"sem limites", 0, 0, 0},
+		{"apenas o tamanho do lote", 256, 0, 256},
+		{"limite abaixo do padrão do SDK", 0, 64 * estimatedSpanSize, 64},
+		{"limite acima do padrão do SDK", 0, 4096 * estimatedSpanSize, sdktrace.DefaultMaxExportBatchSize},
+		{"limite abaixo do lote configurado", 256, 100 * estimatedSpanSize, 100},
+		{"limite acima do lote configurado", 256, 1000 * estimatedSpanSize, 256},
+		{"limite inferior a um span", 0, estimatedSpanSize / 2, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig("service-a", "otel-collector:4317")
+			cfg.MaxExportBatchSize, cfg.MaxPayloadBytes = tt.maxBatch, tt.maxPayload
+			if got := effectiveBatchOptions(cfg).MaxExportBatchSize; got != tt.want {
+				t.Errorf("MaxExportBatchSize = %d, esperado %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBatchOptionsQueueAndDelay(t *testing.T) {
+	cfg := DefaultConfig("service-a", "otel-collector:4317")
+	cfg.MaxQueueSize, cfg.ScheduleDelay = 4096, 1500*time.Millisecond
+	o := effectiveBatchOptions(cfg)
+	if o.MaxQueueSize != 4096 || o.BatchTimeout != cfg.ScheduleDelay {
+		t.Errorf("opções = %+v, esperado MaxQueueSize 4096 e BatchTimeout %v", o, cfg.ScheduleDelay)
+	}
+}
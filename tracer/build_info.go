@@ -0,0 +1,47 @@
+package tracer
+
+import (
+	"context"
+	"runtime"
+	"runtime/debug"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// registerBuildInfo regista o gauge `build_info`, sempre com o valor 1, cujos atributos
+// identificam o binário: `version` (a versão do serviço, ver serviceVersion, ou a do
+// módulo), `commit` (a revisão do controlo de versões) e `go_version`. Segue a convenção do
+// Prometheus, para que os dashboards relacionem o comportamento com as versões em execução.
+func registerBuildInfo(meter metric.Meter, cfg Config) error {
+	attrs := metric.WithAttributes(buildInfoAttributes(cfg)...)
+	_, err := meter.Int64ObservableGauge("build_info",
+		metric.WithDescription("Informação de compilação do serviço; o valor é sempre 1"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(1, attrs)
+			return nil
+		}),
+	)
+	return err
+}
+
+// buildInfoAttributes devolve os atributos do gauge `build_info`, com "unknown" nos
+// valores que o binário não regista.
+func buildInfoAttributes(cfg Config) []attribute.KeyValue {
+	version := serviceVersion(cfg)
+	if info, ok := debug.ReadBuildInfo(); ok && version == "" && info.Main.Version != "(devel)" {
+		version = info.Main.Version
+	}
+	return []attribute.KeyValue{
+		attribute.String("version", orUnknown(version)),
+		attribute.String("commit", orUnknown(buildSetting("vcs.revision"))),
+		attribute.String("go_version", runtime.Version()),
+	}
+}
+
+func orUnknown(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	return value
+}
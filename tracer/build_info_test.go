@@ -0,0 +1,48 @@
+package tracer
+
+import (
+	"context"
+	"runtime"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestRegisterBuildInfo(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	defer mp.Shutdown(context.Background())
+
+	cfg := DefaultConfig("service-a", "otel-collector:4317")
+	cfg.ServiceVersion = "1.2.3"
+	if err := registerBuildInfo(mp.Meter("test"), cfg); err != nil {
+		t.Fatalf("registerBuildInfo: %v", err)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	if len(rm.ScopeMetrics) != 1 || len(rm.ScopeMetrics[0].Metrics) != 1 {
+		t.Fatalf("esperada uma métrica, obtido %+v", rm.ScopeMetrics)
+	}
+	m := rm.ScopeMetrics[0].Metrics[0]
+	gauge, ok := m.Data.(metricdata.Gauge[int64])
+	if m.Name != "build_info" || !ok || len(gauge.DataPoints) != 1 {
+		t.Fatalf("esperado o gauge build_info com um ponto, obtido %s %T", m.Name, m.Data)
+	}
+	point := gauge.DataPoints[0]
+	if point.Value != 1 {
+		t.Errorf("valor = %d, esperado 1", point.Value)
+	}
+	for key, want := range map[string]string{"version": "1.2.3", "go_version": runtime.Version()} {
+		if got, ok := point.Attributes.Value(attribute.Key(key)); !ok || got.AsString() != want {
+			t.Errorf("%s = %q, esperado %q", key, got.AsString(), want)
+		}
+	}
+	if _, ok := point.Attributes.Value("commit"); !ok {
+		t.Error("falta o atributo commit")
+	}
+}
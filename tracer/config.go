@@ -0,0 +1,321 @@
+package tracer
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Config reúne toda a configuração de InitTracerProviderWithConfig e InitMeterProvider.
+// Pode ser criada com DefaultConfig ou como literal: os campos a zero (Exporter,
+// ZipkinEndpoint, Protocol, Sampler, Propagators e MetricExportInterval) usam o seu
+// padrão. A exceção é Insecure, cujo zero (false) ativa o TLS na ligação ao coletor.
+type Config struct {
+	// ServiceName identifica o serviço (atributo `service.name`). Obrigatório.
+	ServiceName string
+	// ServiceVersion é o atributo `service.version`. Vazio usa a revisão do controlo de
+	// versões registada pelo Go no binário, quando conhecida.
+	ServiceVersion string
+	// DeploymentEnvironment é o atributo `deployment.environment` (ex: "production"). Vazio omite-o.
+	DeploymentEnvironment string
+
+	// Exporter escolhe o destino dos spans: "otlp" (padrão), "console" (stdout, formatado)
+	// ou "zipkin" (envio direto ao Zipkin, em ZipkinEndpoint).
+	Exporter string
+	// ZipkinEndpoint é o endereço da API do Zipkin, usado com Exporter "zipkin".
+	ZipkinEndpoint string
+	// ConsoleMaxSpansPerSecond limita os spans escritos por segundo pelo exportador
+	// "console"; os restantes são descartados. Zero não impõe limite.
+	ConsoleMaxSpansPerSecond int
+
+	// CollectorURL é o endereço do OTEL Collector (`host:porta` ou `http(s)://host:porta`). Obrigatório.
+	CollectorURL string
+	// Protocol é o transporte OTLP: "grpc" (padrão) ou "http/protobuf".
+	Protocol string
+	// Insecure desativa o TLS na ligação ao coletor (true em DefaultConfig, para o
+	// docker-compose local; false numa Config literal).
+	Insecure bool
+	// CACertFile é o ficheiro PEM com a CA do coletor. Vazio usa as CAs do sistema.
+	CACertFile string
+	// ClientCertFile e ClientKeyFile são o par certificado/chave apresentado ao coletor
+	// (mTLS). Devem ser indicados em conjunto e exigem Insecure a false.
+	ClientCertFile string
+	ClientKeyFile  string
+	// ExportTimeout limita cada envio de um lote ao coletor. Zero usa o padrão do exportador (10s).
+	ExportTimeout time.Duration
+	// Headers são enviados ao coletor em cada exportação (ex: `Authorization` de um
+	// endpoint OTLP gerido). Vazio não envia cabeçalhos adicionais.
+	Headers map[string]string
+	// Compression é a compressão dos envios ao coletor: "" ou "none" (padrão, sem
+	// compressão) ou "gzip", que reduz o tráfego à custa de algum CPU.
+	Compression string
+	// DebugCollectorConn regista nos logs todos os estados da ligação gRPC ao coletor.
+	DebugCollectorConn bool
+
+	// Sampler é o amostrador: "always_on" (padrão), "always_off", "traceidratio" ou uma
+	// das variantes "parentbased_*"; ver newSampler.
+	Sampler string
+	// SampleRatio é a fração (0 a 1) de traces amostrados pelos amostradores
+	// "traceidratio" e "parentbased_traceidratio" (1 em DefaultConfig). É ignorada pelo
+	// amostrador padrão, pelo que o seu zero só descarta traces se for pedido um destes.
+	SampleRatio float64
+	// RouteSampleRatios dá a certas rotas (padrões do Chi) a sua própria fração de amostragem.
+	RouteSampleRatios map[string]float64
+	// DebugSampling regista nos logs, de forma limitada no tempo, a decisão de amostragem
+	// de cada span raiz.
+	DebugSampling bool
+	// Propagators são os propagadores do contexto: "tracecontext", "baggage", "b3" e
+	// "b3multi" (padrão: tracecontext e baggage).
+	Propagators []string
+
+	// MaxQueueSize, MaxExportBatchSize e ScheduleDelay ajustam o processamento em lotes;
+	// zero mantém o padrão do SDK.
+	MaxQueueSize       int
+	MaxExportBatchSize int
+	ScheduleDelay      time.Duration
+	// MaxPayloadBytes limita o tamanho estimado de cada exportação, reduzindo o tamanho
+	// dos lotes. Zero não impõe limite.
+	MaxPayloadBytes int
+	// SpanLimits limita os atributos, eventos e links de cada span (padrão: os do SDK).
+	SpanLimits sdktrace.SpanLimits
+	// SlowTraceThreshold marca com `trace.slow` os spans raiz mais lentos. Zero desativa.
+	SlowTraceThreshold time.Duration
+
+	// MetricExportInterval é o intervalo entre exportações de métricas (padrão: 60s).
+	MetricExportInterval time.Duration
+}
+
+// Valores padrão de DefaultConfig.
+const (
+	defaultExporter = "otlp"
+	defaultProtocol = "grpc"
+)
+
+// DefaultConfig devolve a configuração padrão para o serviço e o coletor indicados:
+// exportação OTLP/gRPC sem TLS, todos os traces amostrados e os propagadores W3C.
+func DefaultConfig(serviceName, collectorURL string) Config {
+	return Config{
+		ServiceName:          serviceName,
+		CollectorURL:         collectorURL,
+		Exporter:             defaultExporter,
+		ZipkinEndpoint:       defaultZipkinEndpoint,
+		Protocol:             defaultProtocol,
+		Insecure:             true,
+		Sampler:              defaultSampler,
+		SampleRatio:          1,
+		Propagators:          strings.Split(defaultPropagators, ","),
+		SpanLimits:           sdktrace.NewSpanLimits(),
+		MetricExportInterval: defaultMetricExportInterval,
+	}
+}
+
+// withDefaults devolve a Config com os campos a zero substituídos pelo seu padrão.
+// Os limites dos spans a zero já são substituídos pelos do SDK em sdktrace.WithSpanLimits.
+func (c Config) withDefaults() Config {
+	if c.Exporter == "" {
+		c.Exporter = defaultExporter
+	}
+	if c.ZipkinEndpoint == "" {
+		c.ZipkinEndpoint = defaultZipkinEndpoint
+	}
+	if c.Protocol == "" {
+		c.Protocol = defaultProtocol
+	}
+	if c.Sampler == "" {
+		c.Sampler = defaultSampler
+	}
+	if c.Propagators == nil {
+		c.Propagators = strings.Split(defaultPropagators, ",")
+	}
+	if c.MetricExportInterval == 0 {
+		c.MetricExportInterval = defaultMetricExportInterval
+	}
+	return c
+}
+
+// Validate verifica os campos obrigatórios e os limites dos restantes, depois de
+// substituir os campos a zero pelo seu padrão.
+func (c Config) Validate() error {
+	c = c.withDefaults()
+	var errs []error
+	if c.ServiceName == "" {
+		errs = append(errs, errors.New("ServiceName é obrigatório"))
+	}
+	if c.CollectorURL == "" {
+		errs = append(errs, errors.New("CollectorURL é obrigatório"))
+	}
+	switch c.Exporter {
+	case "otlp", "console", "zipkin":
+	default:
+		errs = append(errs, fmt.Errorf("Exporter deve ser otlp, console ou zipkin: %q", c.Exporter))
+	}
+	switch c.Protocol {
+	case "grpc", "http/protobuf":
+	default:
+		errs = append(errs, fmt.Errorf("Protocol deve ser grpc ou http/protobuf: %q", c.Protocol))
+	}
+	switch {
+	case c.ClientCertFile != "" && c.ClientKeyFile == "":
+		errs = append(errs, errors.New("falta a chave do certificado de cliente do coletor (ClientKeyFile, OTEL_EXPORTER_OTLP_CLIENT_KEY)"))
+	case c.ClientKeyFile != "" && c.ClientCertFile == "":
+		errs = append(errs, errors.New("falta o certificado de cliente do coletor (ClientCertFile, OTEL_EXPORTER_OTLP_CLIENT_CERTIFICATE)"))
+	}
+	if c.ClientCertFile != "" && c.Insecure {
+		errs = append(errs, errors.New("o certificado de cliente do coletor exige Insecure a false"))
+	}
+	if !isValidSampler(c.Sampler) {
+		errs = append(errs, fmt.Errorf("Sampler deve ser always_on, always_off, traceidratio ou parentbased_*: %q", c.Sampler))
+	}
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		errs = append(errs, fmt.Errorf("SampleRatio deve estar entre 0 e 1: %v", c.SampleRatio))
+	}
+	for route, ratio := range c.RouteSampleRatios {
+		if route == "" || ratio < 0 || ratio > 1 {
+			errs = append(errs, fmt.Errorf("RouteSampleRatios deve ter rotas com uma fração entre 0 e 1: %q=%v", route, ratio))
+		}
+	}
+	if _, err := newPropagator(c.Propagators); err != nil {
+		errs = append(errs, err)
+	}
+	if c.ExportTimeout < 0 {
+		errs = append(errs, fmt.Errorf("ExportTimeout não pode ser negativo: %v", c.ExportTimeout))
+	}
+	switch c.Compression {
+	case "", "none", "gzip":
+	default:
+		errs = append(errs, fmt.Errorf("Compression deve ser none ou gzip: %q", c.Compression))
+	}
+	if c.ConsoleMaxSpansPerSecond < 0 {
+		errs = append(errs, fmt.Errorf("ConsoleMaxSpansPerSecond não pode ser negativo: %d", c.ConsoleMaxSpansPerSecond))
+	}
+	if c.MaxQueueSize < 0 || c.MaxExportBatchSize < 0 || c.ScheduleDelay < 0 || c.MaxPayloadBytes < 0 {
+		errs = append(errs, errors.New("MaxQueueSize, MaxExportBatchSize, ScheduleDelay e MaxPayloadBytes não podem ser negativos"))
+	}
+	if c.SlowTraceThreshold < 0 {
+		errs = append(errs, fmt.Errorf("SlowTraceThreshold não pode ser negativo: %v", c.SlowTraceThreshold))
+	}
+	if c.MetricExportInterval < 0 {
+		errs = append(errs, fmt.Errorf("MetricExportInterval não pode ser negativo: %v", c.MetricExportInterval))
+	}
+	return errors.Join(errs...)
+}
+
+// configFromEnv monta a configuração usada por InitTracerProvider e InitMeterProvider:
+// parte de DefaultConfig e lê das variáveis de ambiente (OTEL_* e as do projeto) tudo o
+// que não é passado como argumento.
+func configFromEnv(serviceName, collectorURL string) (Config, error) {
+	cfg := DefaultConfig(serviceName, collectorURL)
+	cfg.ServiceVersion = os.Getenv("SERVICE_VERSION")
+	cfg.DeploymentEnvironment = os.Getenv("DEPLOYMENT_ENVIRONMENT")
+	if value := os.Getenv("OTEL_TRACES_EXPORTER"); value != "" {
+		cfg.Exporter = value
+	}
+	if value := os.Getenv("OTEL_EXPORTER_ZIPKIN_ENDPOINT"); value != "" {
+		cfg.ZipkinEndpoint = value
+	}
+	if value := os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL"); value != "" {
+		cfg.Protocol = value
+	}
+
+	var err error
+	if cfg.ConsoleMaxSpansPerSecond, err = positiveIntFromEnv("CONSOLE_MAX_SPANS_PER_SECOND"); err != nil {
+		return cfg, err
+	}
+	if value := os.Getenv("OTEL_EXPORTER_OTLP_INSECURE"); value != "" {
+		if cfg.Insecure, err = strconv.ParseBool(value); err != nil {
+			return cfg, fmt.Errorf("OTEL_EXPORTER_OTLP_INSECURE deve ser true ou false: %q", value)
+		}
+	}
+	cfg.CACertFile = os.Getenv("OTEL_EXPORTER_OTLP_CERTIFICATE")
+	cfg.ClientCertFile = os.Getenv("OTEL_EXPORTER_OTLP_CLIENT_CERTIFICATE")
+	cfg.ClientKeyFile = os.Getenv("OTEL_EXPORTER_OTLP_CLIENT_KEY")
+	if cfg.Headers, err = headersFromEnv(); err != nil {
+		return cfg, err
+	}
+	cfg.Compression = os.Getenv("OTEL_EXPORTER_OTLP_COMPRESSION")
+	if cfg.ExportTimeout, err = millisecondsFromEnv("OTEL_EXPORTER_OTLP_TIMEOUT"); err != nil {
+		return cfg, err
+	}
+	cfg.DebugCollectorConn = debugCollectorConnFromEnv()
+
+	if cfg.Sampler, cfg.SampleRatio, err = samplerFromEnv(); err != nil {
+		return cfg, err
+	}
+	if cfg.RouteSampleRatios, err = routeSampleRatiosFromEnv(); err != nil {
+		return cfg, err
+	}
+	cfg.DebugSampling = debugSamplingFromEnv()
+	if value := os.Getenv("OTEL_PROPAGATORS"); value != "" {
+		cfg.Propagators = strings.Split(value, ",")
+	}
+
+	if cfg.MaxQueueSize, err = positiveIntFromEnv("OTEL_BSP_MAX_QUEUE_SIZE"); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxExportBatchSize, err = positiveIntFromEnv("OTEL_BSP_MAX_EXPORT_BATCH_SIZE"); err != nil {
+		return cfg, err
+	}
+	if cfg.ScheduleDelay, err = millisecondsFromEnv("OTEL_BSP_SCHEDULE_DELAY"); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxPayloadBytes, err = positiveIntFromEnv("TRACE_EXPORT_MAX_PAYLOAD_BYTES"); err != nil {
+		return cfg, err
+	}
+	if cfg.SpanLimits, err = spanLimitsFromEnv(); err != nil {
+		return cfg, err
+	}
+	if cfg.SlowTraceThreshold, err = millisecondsFromEnv("SLOW_TRACE_MS"); err != nil {
+		return cfg, err
+	}
+
+	interval, err := millisecondsFromEnv("OTEL_METRIC_EXPORT_INTERVAL")
+	if err != nil {
+		return cfg, err
+	}
+	if interval > 0 {
+		cfg.MetricExportInterval = interval
+	}
+	return cfg, nil
+}
+
+// headersFromEnv lê de OTEL_EXPORTER_OTLP_HEADERS os cabeçalhos a enviar ao coletor, no
+// formato da especificação do OTEL: pares `chave=valor` separados por vírgulas, com os
+// valores codificados como numa URL (ex: "Authorization=Bearer%20abc"). Chaves e valores
+// são aparados. Devolve nil quando a variável não está definida.
+func headersFromEnv() (map[string]string, error) {
+	value := os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")
+	if value == "" {
+		return nil, nil
+	}
+	headers := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		key, rawValue, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, errors.New("OTEL_EXPORTER_OTLP_HEADERS deve ter o formato chave=valor,chave=valor")
+		}
+		// O valor não é incluído na mensagem de erro, por poder conter credenciais.
+		unescaped, err := url.PathUnescape(strings.TrimSpace(rawValue))
+		if err != nil {
+			return nil, fmt.Errorf("OTEL_EXPORTER_OTLP_HEADERS tem um valor mal codificado para %q", key)
+		}
+		headers[key] = unescaped
+	}
+	return headers, nil
+}
+
+// millisecondsFromEnv lê uma duração em milissegundos (inteiro positivo) da variável
+// indicada. Devolve zero quando a variável não está definida.
+func millisecondsFromEnv(key string) (time.Duration, error) {
+	ms, err := positiveIntFromEnv(key)
+	if err != nil {
+		return 0, fmt.Errorf("%s deve ser um inteiro positivo (ms): %q", key, os.Getenv(key))
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
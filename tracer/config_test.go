@@ -0,0 +1,185 @@
+package tracer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestDefaultConfigIsValid(t *testing.T) {
+	cfg := DefaultConfig("service-a", "otel-collector:4317")
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("DefaultConfig deveria ser válida: %v", err)
+	}
+	if cfg.Exporter != "otlp" || cfg.Protocol != "grpc" || !cfg.Insecure || cfg.Sampler != "always_on" || cfg.SampleRatio != 1 {
+		t.Errorf("padrões inesperados: %+v", cfg)
+	}
+	if cfg.MetricExportInterval != defaultMetricExportInterval {
+		t.Errorf("MetricExportInterval = %v, esperado %v", cfg.MetricExportInterval, defaultMetricExportInterval)
+	}
+	if strings.Join(cfg.Propagators, ",") != defaultPropagators {
+		t.Errorf("Propagators = %v, esperado %q", cfg.Propagators, defaultPropagators)
+	}
+}
+
+func TestConfigLiteralUsesDefaults(t *testing.T) {
+	cfg := Config{ServiceName: "service-a", CollectorURL: "otel-collector:4317"}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("uma Config literal com os campos obrigatórios deveria ser válida: %v", err)
+	}
+
+	got := cfg.withDefaults()
+	want := DefaultConfig("service-a", "otel-collector:4317")
+	want.Insecure, want.SampleRatio, want.SpanLimits = false, 0, sdktrace.SpanLimits{}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("padrões resolvidos = %+v, esperado %+v", got, want)
+	}
+}
+
+func TestValidateRejectsInvalidFields(t *testing.T) {
+	tests := map[string]func(*Config){
+		"sem nome do serviço":            func(c *Config) { c.ServiceName = "" },
+		"sem coletor":                    func(c *Config) { c.CollectorURL = "" },
+		"exportador desconhecido":        func(c *Config) { c.Exporter = "jaeger" },
+		"protocolo desconhecido":         func(c *Config) { c.Protocol = "http/json" },
+		"certificado sem chave":          func(c *Config) { c.Insecure, c.ClientCertFile = false, "client.crt" },
+		"certificado sem TLS":            func(c *Config) { c.ClientCertFile, c.ClientKeyFile = "client.crt", "client.key" },
+		"amostrador desconhecido":        func(c *Config) { c.Sampler = "sometimes" },
+		"fração acima de 1":              func(c *Config) { c.SampleRatio = 1.5 },
+		"fração de rota negativa":        func(c *Config) { c.RouteSampleRatios = map[string]float64{"/health": -1} },
+		"propagador desconhecido":        func(c *Config) { c.Propagators = []string{"xray"} },
+		"compressão desconhecida":        func(c *Config) { c.Compression = "zstd" },
+		"timeout negativo":               func(c *Config) { c.ExportTimeout = -time.Second },
+		"fila negativa":                  func(c *Config) { c.MaxQueueSize = -1 },
+		"limiar lento negativo":          func(c *Config) { c.SlowTraceThreshold = -time.Second },
+		"intervalo de métricas negativo": func(c *Config) { c.MetricExportInterval = -time.Second },
+	}
+	for name, mutate := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := DefaultConfig("service-a", "otel-collector:4317")
+			mutate(&cfg)
+			if err := cfg.Validate(); err == nil {
+				t.Fatal("esperado erro de validação")
+			}
+		})
+	}
+}
+
+func TestValidateNamesMissingClientCertificateVariable(t *testing.T) {
+	tests := []struct {
+		name, cert, key  string
+		missing, present string
+	}{
+		{"sem chave", "client.crt", "", "OTEL_EXPORTER_OTLP_CLIENT_KEY", "OTEL_EXPORTER_OTLP_CLIENT_CERTIFICATE"},
+		{"sem certificado", "", "client.key", "OTEL_EXPORTER_OTLP_CLIENT_CERTIFICATE", "OTEL_EXPORTER_OTLP_CLIENT_KEY"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OTEL_EXPORTER_OTLP_INSECURE", "false")
+			t.Setenv("OTEL_EXPORTER_OTLP_CLIENT_CERTIFICATE", tt.cert)
+			t.Setenv("OTEL_EXPORTER_OTLP_CLIENT_KEY", tt.key)
+			cfg, err := configFromEnv("service-a", "otel-collector:4317")
+			if err != nil {
+				t.Fatalf("configFromEnv: %v", err)
+			}
+			err = cfg.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.missing) {
+				t.Fatalf("erro = %v, esperado a indicação de %s", err, tt.missing)
+			}
+			if strings.Contains(err.Error(), tt.present) {
+				t.Errorf("erro = %v, não deveria indicar %s, que está definida", err, tt.present)
+			}
+		})
+	}
+}
+
+func TestConfigFromEnvDefaults(t *testing.T) {
+	cfg, err := configFromEnv("service-a", "otel-collector:4317")
+	if err != nil {
+		t.Fatalf("configFromEnv: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("a configuração sem variáveis deveria ser válida: %v", err)
+	}
+	if cfg.Exporter != "otlp" || cfg.Protocol != "grpc" || !cfg.Insecure {
+		t.Errorf("padrões inesperados: %+v", cfg)
+	}
+}
+
+func TestConfigFromEnvReadsVariables(t *testing.T) {
+	t.Setenv("SERVICE_VERSION", "1.2.3")
+	t.Setenv("DEPLOYMENT_ENVIRONMENT", "staging")
+	t.Setenv("OTEL_TRACES_EXPORTER", "zipkin")
+	t.Setenv("OTEL_EXPORTER_ZIPKIN_ENDPOINT", "http://zipkin:9411/api/v2/spans")
+	t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "http/protobuf")
+	t.Setenv("CONSOLE_MAX_SPANS_PER_SECOND", "20")
+	t.Setenv("OTEL_EXPORTER_OTLP_INSECURE", "false")
+	t.Setenv("OTEL_EXPORTER_OTLP_CERTIFICATE", "/certs/ca.pem")
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "Authorization=Bearer%20abc")
+	t.Setenv("OTEL_EXPORTER_OTLP_COMPRESSION", "gzip")
+	t.Setenv("OTEL_EXPORTER_OTLP_TIMEOUT", "2500")
+	t.Setenv("OTEL_PROPAGATORS", "tracecontext")
+	t.Setenv("OTEL_BSP_MAX_QUEUE_SIZE", "4096")
+	t.Setenv("OTEL_BSP_MAX_EXPORT_BATCH_SIZE", "256")
+	t.Setenv("OTEL_BSP_SCHEDULE_DELAY", "1000")
+	t.Setenv("TRACE_EXPORT_MAX_PAYLOAD_BYTES", "65536")
+	t.Setenv("SLOW_TRACE_MS", "750")
+	t.Setenv("OTEL_METRIC_EXPORT_INTERVAL", "30000")
+
+	cfg, err := configFromEnv("service-a", "otel-collector:4317")
+	if err != nil {
+		t.Fatalf("configFromEnv: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	checks := []struct {
+		name      string
+		got, want any
+	}{
+		{"ServiceVersion", cfg.ServiceVersion, "1.2.3"},
+		{"DeploymentEnvironment", cfg.DeploymentEnvironment, "staging"},
+		{"Exporter", cfg.Exporter, "zipkin"},
+		{"ZipkinEndpoint", cfg.ZipkinEndpoint, "http://zipkin:9411/api/v2/spans"},
+		{"Protocol", cfg.Protocol, "http/protobuf"},
+		{"ConsoleMaxSpansPerSecond", cfg.ConsoleMaxSpansPerSecond, 20},
+		{"Insecure", cfg.Insecure, false},
+		{"CACertFile", cfg.CACertFile, "/certs/ca.pem"},
+		{"Authorization", cfg.Headers["Authorization"], "Bearer abc"},
+		{"Compression", cfg.Compression, "gzip"},
+		{"ExportTimeout", cfg.ExportTimeout, 2500 * time.Millisecond},
+		{"Propagators", strings.Join(cfg.Propagators, ","), "tracecontext"},
+		{"MaxQueueSize", cfg.MaxQueueSize, 4096},
+		{"MaxExportBatchSize", cfg.MaxExportBatchSize, 256},
+		{"ScheduleDelay", cfg.ScheduleDelay, time.Second},
+		{"MaxPayloadBytes", cfg.MaxPayloadBytes, 65536},
+		{"SlowTraceThreshold", cfg.SlowTraceThreshold, 750 * time.Millisecond},
+		{"MetricExportInterval", cfg.MetricExportInterval, 30 * time.Second},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s = %v, esperado %v", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestConfigFromEnvRejectsInvalidValues(t *testing.T) {
+	for key, value := range map[string]string{
+		"OTEL_EXPORTER_OTLP_INSECURE": "talvez",
+		"OTEL_EXPORTER_OTLP_TIMEOUT":  "-1",
+		"OTEL_BSP_MAX_QUEUE_SIZE":     "muitos",
+		"SLOW_TRACE_MS":               "1s",
+		"OTEL_EXPORTER_OTLP_HEADERS":  "sem-igual",
+	} {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, value)
+			if _, err := configFromEnv("service-a", "otel-collector:4317"); err == nil {
+				t.Fatalf("esperado erro para %s=%q", key, value)
+			}
+		})
+	}
+}
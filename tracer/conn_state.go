@@ -0,0 +1,68 @@
+package tracer
+
+import (
+	"Observabilidade/logging"
+	"context"
+	"log/slog"
+	"os"
+	"strconv"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+// debugCollectorConnFromEnv indica se DEBUG_COLLECTOR_CONN=true está definido.
+func debugCollectorConnFromEnv() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("DEBUG_COLLECTOR_CONN"))
+	return enabled
+}
+
+// watchConnState regista nos logs as mudanças de estado da ligação gRPC ao coletor. Como
+// `grpc.NewClient` não bloqueia, um coletor em baixo passaria despercebido: por isso as
+// passagens a TRANSIENT_FAILURE (em WARN) e a READY são sempre registadas. Com `verbose`
+// (DEBUG_COLLECTOR_CONN=true), também o estado inicial e os estados intermédios (ex: IDLE,
+// CONNECTING). Termina quando a ligação é fechada ou o contexto é cancelado. Usa o logger
+// do contexto (ver logging.LoggerFromContext), que fora de uma requisição é o partilhado.
+func watchConnState(ctx context.Context, conn *grpc.ClientConn, verbose bool) {
+	logger := logging.LoggerFromContext(ctx).With("target", conn.Target())
+	state := conn.GetState()
+	if verbose {
+		logger.Info("estado da ligação ao coletor", "state", state.String())
+	}
+	for state != connectivity.Shutdown {
+		if !conn.WaitForStateChange(ctx, state) {
+			return
+		}
+		previous := state
+		state = conn.GetState()
+
+		level := slog.LevelInfo
+		switch {
+		case state == connectivity.TransientFailure:
+			level = slog.LevelWarn
+		case state != connectivity.Ready && !verbose:
+			continue
+		}
+		logger.Log(ctx, level, "estado da ligação ao coletor alterado",
+			"from", previous.String(), "state", state.String())
+	}
+}
+
+// connExporter envolve o exportador que usa a ligação gRPC ao coletor. No Shutdown,
+// depois de o exportador terminar, pára a monitorização do estado e fecha a ligação, que
+// o exportador não fecha por ter sido criada por nós.
+type connExporter struct {
+	sdktrace.SpanExporter
+	conn      *grpc.ClientConn
+	stopWatch context.CancelFunc
+}
+
+func (e connExporter) Shutdown(ctx context.Context) error {
+	err := e.SpanExporter.Shutdown(ctx)
+	e.stopWatch()
+	if closeErr := e.conn.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
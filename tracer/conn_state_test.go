@@ -0,0 +1,153 @@
+package tracer
+
+import (
+	"Observabilidade/logging"
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// syncBuffer é um bytes.Buffer seguro para a goroutine de watchConnState e o teste.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// states devolve os estados registados, pela ordem, com o nível de cada entrada.
+func (b *syncBuffer) states(t *testing.T) []string {
+	t.Helper()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var states []string
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("log inválido %q: %v", line, err)
+		}
+		states = append(states, entry["level"].(string)+" "+entry["state"].(string))
+	}
+	return states
+}
+
+// startCollector arranca um servidor gRPC vazio no endereço indicado ("" para um
+// endereço livre) e devolve o endereço e a função que o para.
+func startCollector(t *testing.T, addr string) (string, func()) {
+	t.Helper()
+	if addr == "" {
+		addr = "127.0.0.1:0"
+	}
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return lis.Addr().String(), srv.Stop
+}
+
+// waitForState espera que o estado indicado seja registado nos logs depois das `after`
+// entradas já existentes. Enquanto espera, pede à ligação que volte a ligar-se, já que
+// uma ligação em IDLE só tenta de novo quando é usada.
+func waitForState(t *testing.T, conn *grpc.ClientConn, logs *syncBuffer, after int, want string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if states := logs.states(t); len(states) > after && slices.Contains(states[after:], want) {
+			return
+		}
+		conn.Connect()
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("estado %q não registado; registados: %v", want, logs.states(t))
+}
+
+// collectorUpAndDown monitoriza, com watchConnState, uma ligação a um coletor que
+// arranca, vai abaixo e volta, e devolve os estados registados nos logs.
+func collectorUpAndDown(t *testing.T, verbose bool) []string {
+	t.Helper()
+	addr, stop := startCollector(t, "")
+	conn, err := grpc.NewClient(addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		// Repetições rápidas, para o teste não esperar pelo backoff por omissão (1s a 2min).
+		grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff:           backoff.Config{BaseDelay: 10 * time.Millisecond, Multiplier: 1.6, MaxDelay: 50 * time.Millisecond},
+			MinConnectTimeout: time.Second,
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs := &syncBuffer{}
+	ctx, cancel := context.WithCancel(logging.WithLogger(context.Background(), slog.New(slog.NewJSONHandler(logs, nil))))
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		watchConnState(ctx, conn, verbose)
+		close(done)
+	}()
+
+	waitForState(t, conn, logs, 0, "INFO READY")
+
+	// Com o coletor em baixo, as novas tentativas de ligação falham e são registadas em WARN.
+	stop()
+	waitForState(t, conn, logs, 0, "WARN TRANSIENT_FAILURE")
+
+	// Quando o coletor volta, a ligação recupera.
+	startCollector(t, addr)
+	waitForState(t, conn, logs, len(logs.states(t)), "INFO READY")
+
+	// Fechar a ligação termina a monitorização.
+	conn.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("watchConnState não terminou depois de a ligação ser fechada")
+	}
+	return logs.states(t)
+}
+
+func TestWatchConnStateVerbose(t *testing.T) {
+	states := collectorUpAndDown(t, true)
+	// Com DEBUG_COLLECTOR_CONN=true, os estados intermédios também são registados.
+	if !slices.Contains(states, "INFO CONNECTING") {
+		t.Errorf("esperado o estado CONNECTING; registados: %v", states)
+	}
+}
+
+func TestWatchConnStateOnlyFailuresAndRecovery(t *testing.T) {
+	for _, state := range collectorUpAndDown(t, false) {
+		if state != "INFO READY" && state != "WARN TRANSIENT_FAILURE" {
+			t.Errorf("sem DEBUG_COLLECTOR_CONN só READY e TRANSIENT_FAILURE deveriam ser registados, obtido %q", state)
+		}
+	}
+}
+
+func TestDebugCollectorConnFromEnv(t *testing.T) {
+	for value, want := range map[string]bool{"true": true, "1": true, "false": false, "": false, "sim": false} {
+		t.Setenv("DEBUG_COLLECTOR_CONN", value)
+		if got := debugCollectorConnFromEnv(); got != want {
+			t.Errorf("DEBUG_COLLECTOR_CONN=%q: debugCollectorConnFromEnv = %v, esperado %v", value, got, want)
+		}
+	}
+}
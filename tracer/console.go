@@ -0,0 +1,104 @@
+package tracer
+
+import (
+	"Observabilidade/logging"
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// consoleDropSummaryInterval é o intervalo entre os resumos dos spans descartados pelo
+// limite do exportador `console`.
+const consoleDropSummaryInterval = 10 * time.Second
+
+// rateLimitedExporter envolve o exportador `console` e escreve no máximo `limit` spans por
+// segundo, para que o terminal continue legível quando o serviço está sob carga. Os spans
+// acima do limite são descartados e contados; a cada consoleDropSummaryInterval (e no
+// Shutdown) regista-se nos logs quantos foram descartados.
+type rateLimitedExporter struct {
+	sdktrace.SpanExporter
+	limit  int
+	logger *slog.Logger
+	now    func() time.Time
+
+	mu       sync.Mutex
+	window   time.Time
+	exported int
+	dropped  int
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// newRateLimitedExporter envolve `exp` com o limite de `limit` spans por segundo e
+// arranca o resumo periódico dos spans descartados.
+func newRateLimitedExporter(exp sdktrace.SpanExporter, limit int) *rateLimitedExporter {
+	e := &rateLimitedExporter{
+		SpanExporter: exp,
+		limit:        limit,
+		logger:       logging.Default(),
+		now:          time.Now,
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	go e.summarize()
+	return e
+}
+
+// ExportSpans escreve os spans que ainda cabem no limite do segundo atual e descarta os restantes.
+func (e *rateLimitedExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.mu.Lock()
+	if second := e.now().Truncate(time.Second); !second.Equal(e.window) {
+		e.window, e.exported = second, 0
+	}
+	allowed := min(len(spans), e.limit-e.exported)
+	e.exported += allowed
+	e.dropped += len(spans) - allowed
+	e.mu.Unlock()
+
+	if allowed == 0 {
+		return nil
+	}
+	return e.SpanExporter.ExportSpans(ctx, spans[:allowed])
+}
+
+// Shutdown pára o resumo periódico, regista os spans descartados ainda por reportar e
+// termina o exportador envolvido.
+func (e *rateLimitedExporter) Shutdown(ctx context.Context) error {
+	e.stopOnce.Do(func() {
+		close(e.stop)
+		<-e.done
+	})
+	e.logDropped()
+	return e.SpanExporter.Shutdown(ctx)
+}
+
+func (e *rateLimitedExporter) summarize() {
+	defer close(e.done)
+	ticker := time.NewTicker(consoleDropSummaryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			e.logDropped()
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+// logDropped regista quantos spans foram descartados desde o último resumo, se algum.
+func (e *rateLimitedExporter) logDropped() {
+	e.mu.Lock()
+	dropped := e.dropped
+	e.dropped = 0
+	e.mu.Unlock()
+	if dropped > 0 {
+		e.logger.Warn("spans descartados pelo limite do exportador console",
+			"dropped", dropped, "max_spans_per_second", e.limit)
+	}
+}
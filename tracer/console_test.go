@@ -0,0 +1,106 @@
+package tracer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// testSpans devolve n spans vazios, prontos a exportar.
+func testSpans(n int) []sdktrace.ReadOnlySpan {
+	spans := make([]sdktrace.ReadOnlySpan, n)
+	for i := range spans {
+		spans[i] = tracetest.SpanStub{Name: "span"}.Snapshot()
+	}
+	return spans
+}
+
+// rateLimitedTestExporter devolve um rateLimitedExporter sobre um fakeExporter, com o
+// relógio em `clock` e os logs no buffer devolvido.
+func rateLimitedTestExporter(t *testing.T, limit int, clock *time.Time) (*rateLimitedExporter, *fakeExporter, *bytes.Buffer) {
+	t.Helper()
+	inner := &fakeExporter{}
+	exp := newRateLimitedExporter(inner, limit)
+	logs := &bytes.Buffer{}
+	exp.logger = slog.New(slog.NewJSONHandler(logs, nil))
+	exp.now = func() time.Time { return *clock }
+	t.Cleanup(func() { exp.Shutdown(context.Background()) })
+	return exp, inner, logs
+}
+
+func TestRateLimitedExporterDropsOverLimit(t *testing.T) {
+	clock := time.Unix(1_700_000_000, 0)
+	exp, inner, _ := rateLimitedTestExporter(t, 5, &clock)
+
+	exp.ExportSpans(context.Background(), testSpans(3))
+	exp.ExportSpans(context.Background(), testSpans(4))
+	exp.ExportSpans(context.Background(), testSpans(2))
+	if len(inner.spans) != 5 {
+		t.Fatalf("exportados %d spans no mesmo segundo, esperado o limite de 5", len(inner.spans))
+	}
+	if exp.dropped != 4 {
+		t.Errorf("descartados %d spans, esperado 4", exp.dropped)
+	}
+
+	// No segundo seguinte o limite recomeça.
+	clock = clock.Add(time.Second)
+	exp.ExportSpans(context.Background(), testSpans(2))
+	if len(inner.spans) != 7 {
+		t.Errorf("exportados %d spans, esperado 7 depois de mudar de segundo", len(inner.spans))
+	}
+}
+
+func TestRateLimitedExporterLogsDroppedSummary(t *testing.T) {
+	clock := time.Unix(1_700_000_000, 0)
+	exp, inner, logs := rateLimitedTestExporter(t, 2, &clock)
+
+	exp.logDropped()
+	if logs.Len() != 0 {
+		t.Fatalf("sem spans descartados não deveria haver resumo: %s", logs)
+	}
+
+	exp.ExportSpans(context.Background(), testSpans(5))
+	exp.logDropped()
+	var entry map[string]any
+	if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+		t.Fatalf("resumo inválido %q: %v", logs, err)
+	}
+	if entry["level"] != "WARN" || entry["dropped"] != float64(3) || entry["max_spans_per_second"] != float64(2) {
+		t.Errorf("resumo = %v, esperado dropped=3", entry)
+	}
+
+	// O contador recomeça depois de cada resumo; o Shutdown reporta o que falta.
+	logs.Reset()
+	exp.ExportSpans(context.Background(), testSpans(1))
+	if err := exp.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if !strings.Contains(logs.String(), `"dropped":1`) {
+		t.Errorf("esperado o resumo final com dropped=1, obtido %q", logs)
+	}
+	if inner.shutdowns != 1 {
+		t.Errorf("Shutdown do exportador envolvido chamado %d vezes, esperado 1", inner.shutdowns)
+	}
+}
+
+func TestConsoleExporterRateLimitFromConfig(t *testing.T) {
+	cfg := DefaultConfig("service-a", "otel-collector:4317")
+	cfg.Exporter = "console"
+	cfg.ConsoleMaxSpansPerSecond = 10
+
+	exp, err := newSpanExporter(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("newSpanExporter: %v", err)
+	}
+	defer exp.Shutdown(context.Background())
+	if limited, ok := exp.(*rateLimitedExporter); !ok || limited.limit != 10 {
+		t.Errorf("exportador = %T, esperado o console com o limite de 10 spans por segundo", exp)
+	}
+}
@@ -0,0 +1,106 @@
+package tracer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// useMeterReader instala, durante o teste, um MeterProvider global com um leitor manual.
+func useMeterReader(t *testing.T) *sdkmetric.ManualReader {
+	t.Helper()
+	reader := sdkmetric.NewManualReader()
+	previous := otel.GetMeterProvider()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	t.Cleanup(func() { otel.SetMeterProvider(previous) })
+	return reader
+}
+
+// collectMetric devolve os dados da métrica indicada.
+func collectMetric(t *testing.T, reader *sdkmetric.ManualReader, name string) metricdata.Aggregation {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == name {
+				return m.Data
+			}
+		}
+	}
+	t.Fatalf("métrica %s não encontrada", name)
+	return nil
+}
+
+// seriesKey identifica uma série pelo método, rota e status.
+func seriesKey(set attribute.Set) string {
+	method, _ := set.Value("http.request.method")
+	route, _ := set.Value("http.route")
+	status, _ := set.Value("http.status_code")
+	return method.Emit() + " " + route.Emit() + " " + status.Emit()
+}
+
+func TestDurationMiddlewareRecordsMethodAndRoute(t *testing.T) {
+	reader := useMeterReader(t)
+	ok := func(w http.ResponseWriter, _ *http.Request) {}
+	r := chi.NewRouter()
+	r.Method(http.MethodGet, "/weather/{cep}", DurationMiddleware(http.HandlerFunc(ok)))
+	r.Method(http.MethodPost, "/weather/batch", DurationMiddleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})))
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/weather/01001000", nil),
+		httptest.NewRequest(http.MethodGet, "/weather/20040020", nil),
+		httptest.NewRequest(http.MethodPost, "/weather/batch", nil),
+	} {
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	want := map[string]int64{
+		"GET /weather/{cep} 200":  2,
+		"POST /weather/batch 202": 1,
+	}
+	requests := map[string]int64{}
+	for _, dp := range collectMetric(t, reader, "http.server.requests").(metricdata.Sum[int64]).DataPoints {
+		requests[seriesKey(dp.Attributes)] = dp.Value
+	}
+	durations := map[string]int64{}
+	for _, dp := range collectMetric(t, reader, "http.server.duration").(metricdata.Histogram[float64]).DataPoints {
+		durations[seriesKey(dp.Attributes)] = int64(dp.Count)
+	}
+	for key, count := range want {
+		if requests[key] != count {
+			t.Errorf("http.server.requests{%s} = %d, esperado %d", key, requests[key], count)
+		}
+		if durations[key] != count {
+			t.Errorf("http.server.duration{%s} com %d medições, esperado %d", key, durations[key], count)
+		}
+	}
+	if len(requests) != len(want) || len(durations) != len(want) {
+		t.Errorf("séries inesperadas: requests=%v duration=%v", requests, durations)
+	}
+}
+
+func TestRequestMethod(t *testing.T) {
+	for method, want := range map[string]string{
+		http.MethodGet:     "GET",
+		http.MethodPost:    "POST",
+		http.MethodOptions: "OPTIONS",
+		"BREW":             "_OTHER",
+		"get":              "_OTHER",
+	} {
+		if got := requestMethod(method); got != want {
+			t.Errorf("requestMethod(%q) = %q, esperado %q", method, got, want)
+		}
+	}
+}
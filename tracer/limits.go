@@ -0,0 +1,28 @@
+package tracer
+
+import (
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// spanLimitsFromEnv lê os limites de cada span: OTEL_SPAN_ATTRIBUTE_COUNT_LIMIT (atributos),
+// OTEL_SPAN_EVENT_COUNT_LIMIT (eventos) e OTEL_SPAN_LINK_COUNT_LIMIT (links), com os
+// padrões do SDK (128) quando não estão definidas. Um span que exceda um limite não é
+// descartado: os atributos, eventos ou links a mais é que são ignorados, o que protege o
+// exportador de instrumentação descontrolada.
+func spanLimitsFromEnv() (sdktrace.SpanLimits, error) {
+	limits := sdktrace.NewSpanLimits()
+	for key, limit := range map[string]*int{
+		"OTEL_SPAN_ATTRIBUTE_COUNT_LIMIT": &limits.AttributeCountLimit,
+		"OTEL_SPAN_EVENT_COUNT_LIMIT":     &limits.EventCountLimit,
+		"OTEL_SPAN_LINK_COUNT_LIMIT":      &limits.LinkCountLimit,
+	} {
+		n, err := positiveIntFromEnv(key)
+		if err != nil {
+			return limits, err
+		}
+		if n > 0 {
+			*limit = n
+		}
+	}
+	return limits, nil
+}
@@ -0,0 +1,36 @@
+package tracer
+
+import (
+	"Observabilidade/logging"
+	"context"
+	"log/slog"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// LogInfo regista uma mensagem em JSON (INFO) com o `trace_id` e o `span_id` do span
+// atual do contexto, para que a linha de log possa ser encontrada a partir do trace no
+// Zipkin (e vice-versa). Os campos são pares chave/valor, como em `slog`.
+//
+// Ao contrário do logger de `logging.LoggerFromContext`, que guarda o span do servidor e
+// os campos da requisição, estas funções usam o span atual (ex: um span filho criado no
+// handler), e funcionam também fora do middleware de logging.
+func LogInfo(ctx context.Context, msg string, fields ...any) {
+	logWithTrace(ctx, slog.LevelInfo, msg, fields...)
+}
+
+// LogError regista uma mensagem em JSON (ERROR) com o erro e o contexto de trace, tal como LogInfo.
+func LogError(ctx context.Context, msg string, err error, fields ...any) {
+	logWithTrace(ctx, slog.LevelError, msg, append([]any{"error", err}, fields...)...)
+}
+
+func logWithTrace(ctx context.Context, level slog.Level, msg string, fields ...any) {
+	logger := logging.Default()
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		logger = logger.With(
+			slog.String("trace_id", sc.TraceID().String()),
+			slog.String("span_id", sc.SpanID().String()),
+		)
+	}
+	logger.Log(ctx, level, msg, fields...)
+}
@@ -0,0 +1,95 @@
+package tracer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"google.golang.org/grpc"
+)
+
+// defaultMetricExportInterval é o intervalo padrão entre exportações de métricas.
+const defaultMetricExportInterval = time.Minute
+
+// InitMeterProvider inicializa o provedor de métricas do OpenTelemetry, que envia as
+// métricas ao OTEL Collector via OTLP/gRPC com os mesmos atributos de recurso dos traces.
+// As métricas são exportadas periodicamente, a cada OTEL_METRIC_EXPORT_INTERVAL
+// milissegundos (padrão: 60000). O provider fica registado como global, para que
+// `otel.Meter()` o use em qualquer parte da aplicação. Regista ainda o gauge `build_info`
+// (ver registerBuildInfo).
+func InitMeterProvider(serviceName, collectorURL string) (*sdkmetric.MeterProvider, error) {
+	cfg, err := configFromEnv(serviceName, collectorURL)
+	if err != nil {
+		return nil, err
+	}
+	return InitMeterProviderWithConfig(context.Background(), cfg)
+}
+
+// InitMeterProviderWithConfig inicializa o provedor de métricas a partir de uma Config
+// explícita; os campos a zero usam o seu padrão.
+func InitMeterProviderWithConfig(ctx context.Context, cfg Config) (*sdkmetric.MeterProvider, error) {
+	cfg = cfg.withDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("configuração do meter inválida: %w", err)
+	}
+
+	res, err := newResource(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tal como nos traces, a ligação gRPC é não-bloqueante e usa as mesmas credenciais.
+	creds, err := transportCredentials(cfg)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := grpc.NewClient(stripScheme(cfg.CollectorURL), grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("falha ao criar cliente gRPC para o coletor: %w", err)
+	}
+	exporterOpts := []otlpmetricgrpc.Option{otlpmetricgrpc.WithGRPCConn(conn)}
+	if len(cfg.Headers) > 0 {
+		exporterOpts = append(exporterOpts, otlpmetricgrpc.WithHeaders(cfg.Headers))
+	}
+	if cfg.Compression == "gzip" {
+		exporterOpts = append(exporterOpts, otlpmetricgrpc.WithCompressor("gzip"))
+	}
+	if cfg.ExportTimeout > 0 {
+		exporterOpts = append(exporterOpts, otlpmetricgrpc.WithTimeout(cfg.ExportTimeout))
+	}
+	exporter, err := otlpmetricgrpc.New(ctx, exporterOpts...)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("falha ao criar exportador de métricas: %w", err)
+	}
+	metricExporter := connMetricExporter{Exporter: exporter, conn: conn}
+
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithResource(res),
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter, sdkmetric.WithInterval(cfg.MetricExportInterval))),
+	)
+	if err := registerBuildInfo(mp.Meter("Observabilidade/tracer"), cfg); err != nil {
+		return nil, fmt.Errorf("falha ao registar o gauge build_info: %w", err)
+	}
+	otel.SetMeterProvider(mp)
+	return mp, nil
+}
+
+// connMetricExporter envolve o exportador de métricas que usa a ligação gRPC ao coletor.
+// Tal como connExporter nos traces, fecha no Shutdown a ligação que o exportador não fecha
+// por ter sido criada por nós.
+type connMetricExporter struct {
+	sdkmetric.Exporter
+	conn *grpc.ClientConn
+}
+
+func (e connMetricExporter) Shutdown(ctx context.Context) error {
+	err := e.Exporter.Shutdown(ctx)
+	if closeErr := e.conn.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,35 @@
+package tracer
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestConnMetricExporterShutdownClosesConn(t *testing.T) {
+	conn, err := grpc.NewClient("localhost:4317", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("grpc.NewClient: %v", err)
+	}
+	exporter, err := otlpmetricgrpc.New(context.Background(), otlpmetricgrpc.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatalf("otlpmetricgrpc.New: %v", err)
+	}
+
+	if err := (connMetricExporter{Exporter: exporter, conn: conn}).Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if state := conn.GetState(); state != connectivity.Shutdown {
+		t.Errorf("a ligação deveria estar fechada após o Shutdown, estado %v", state)
+	}
+}
+
+func TestInitMeterProviderWithConfigRejectsMissingServiceName(t *testing.T) {
+	if _, err := InitMeterProviderWithConfig(context.Background(), Config{CollectorURL: "otel-collector:4317"}); err == nil {
+		t.Fatal("esperado erro para uma Config sem ServiceName")
+	}
+}
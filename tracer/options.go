@@ -0,0 +1,25 @@
+package tracer
+
+import (
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Option personaliza a inicialização feita por InitTracerProvider e InitTracerProviderWithConfig.
+type Option func(*options)
+
+// options reúne as personalizações aplicadas pelas Option.
+type options struct {
+	exporter sdktrace.SpanExporter
+}
+
+// WithExporter usa o exportador indicado em vez do exportador OTLP/gRPC padrão, o que
+// permite enviar os spans para qualquer backend (ex: um backend proprietário). O recurso,
+// o amostrador e o processamento em lotes continuam a ser configurados por
+// InitTracerProvider, e `tp.Shutdown` continua a chamar o Shutdown do exportador. As
+// ligações que o exportador use internamente (ex: uma ligação gRPC criada pelo chamador)
+// são da responsabilidade de quem o criou e devem ser fechadas por ele.
+func WithExporter(exp sdktrace.SpanExporter) Option {
+	return func(o *options) {
+		o.exporter = exp
+	}
+}
@@ -0,0 +1,89 @@
+package tracer
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+// fakeExporter guarda os spans exportados e conta as chamadas a Shutdown.
+type fakeExporter struct {
+	mu        sync.Mutex
+	spans     []sdktrace.ReadOnlySpan
+	shutdowns int
+}
+
+func (e *fakeExporter) ExportSpans(_ context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *fakeExporter) Shutdown(context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.shutdowns++
+	return nil
+}
+
+// keepGlobals repõe, no fim do teste, o TracerProvider e o propagador globais.
+func keepGlobals(t *testing.T) {
+	t.Helper()
+	tp, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(tp)
+		otel.SetTextMapPropagator(propagator)
+	})
+}
+
+func TestWithExporterReplacesBuiltInExporter(t *testing.T) {
+	keepGlobals(t)
+	exp := &fakeExporter{}
+	// O coletor não existe: com WithExporter, nenhuma ligação lhe é feita.
+	cfg := DefaultConfig("service-test", "coletor-inexistente:4317")
+	tp, err := InitTracerProviderWithConfig(t.Context(), cfg, WithExporter(exp))
+	if err != nil {
+		t.Fatalf("InitTracerProviderWithConfig: %v", err)
+	}
+
+	_, span := otel.Tracer("test").Start(context.Background(), "operacao")
+	span.End()
+	if err := tp.Shutdown(t.Context()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	if len(exp.spans) != 1 || exp.spans[0].Name() != "operacao" {
+		t.Fatalf("spans exportados = %v, esperado o span operacao", exp.spans)
+	}
+	// O recurso configurado por InitTracerProviderWithConfig é aplicado aos spans.
+	name, ok := exp.spans[0].Resource().Set().Value(semconv.ServiceNameKey)
+	if !ok || name.AsString() != "service-test" {
+		t.Errorf("service.name = %q, esperado service-test", name.AsString())
+	}
+	if exp.shutdowns != 1 {
+		t.Errorf("Shutdown do exportador chamado %d vezes, esperado 1", exp.shutdowns)
+	}
+}
+
+func TestWithExporterKeepsSampler(t *testing.T) {
+	keepGlobals(t)
+	exp := &fakeExporter{}
+	cfg := DefaultConfig("service-test", "coletor-inexistente:4317")
+	cfg.Sampler = "always_off"
+	tp, err := InitTracerProviderWithConfig(t.Context(), cfg, WithExporter(exp))
+	if err != nil {
+		t.Fatalf("InitTracerProviderWithConfig: %v", err)
+	}
+
+	_, span := otel.Tracer("test").Start(context.Background(), "operacao")
+	span.End()
+	tp.Shutdown(t.Context())
+	if len(exp.spans) != 0 {
+		t.Errorf("com o amostrador always_off nenhum span deveria ser exportado, obtido %d", len(exp.spans))
+	}
+}
@@ -0,0 +1,60 @@
+package tracer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// newOTLPHTTPExporter cria o exportador que envia os spans ao coletor via OTLP sobre HTTP
+// (protobuf), normalmente na porta 4318. O endereço pode ser `host:porta` ou uma URL
+// completa (`http(s)://host:porta`); neste caso, o esquema decide se há TLS.
+func newOTLPHTTPExporter(ctx context.Context, cfg Config) (sdktrace.SpanExporter, error) {
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []otlptracehttp.Option
+	if hasScheme(cfg.CollectorURL) {
+		opts = append(opts, otlptracehttp.WithEndpointURL(cfg.CollectorURL))
+	} else {
+		opts = append(opts, otlptracehttp.WithEndpoint(cfg.CollectorURL))
+		if tlsConfig == nil {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+	}
+	if tlsConfig != nil {
+		opts = append(opts, otlptracehttp.WithTLSClientConfig(tlsConfig))
+	}
+	if cfg.ExportTimeout > 0 {
+		opts = append(opts, otlptracehttp.WithTimeout(cfg.ExportTimeout))
+	}
+	if len(cfg.Headers) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(cfg.Headers))
+	}
+	if cfg.Compression == "gzip" {
+		opts = append(opts, otlptracehttp.WithCompression(otlptracehttp.GzipCompression))
+	}
+
+	traceExporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("falha ao criar exportador de trace OTLP/HTTP: %w", err)
+	}
+	return traceExporter, nil
+}
+
+// hasScheme indica se o endereço do coletor é uma URL com esquema http ou https.
+func hasScheme(collectorURL string) bool {
+	return strings.HasPrefix(collectorURL, "http://") || strings.HasPrefix(collectorURL, "https://")
+}
+
+// stripScheme remove o esquema http(s) do endereço, já que o cliente gRPC espera `host:porta`.
+func stripScheme(collectorURL string) string {
+	collectorURL = strings.TrimPrefix(collectorURL, "http://")
+	collectorURL = strings.TrimPrefix(collectorURL, "https://")
+	return strings.TrimRight(collectorURL, "/")
+}
@@ -0,0 +1,36 @@
+package tracer
+
+import (
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// defaultPropagators são os propagadores de DefaultConfig, usados quando OTEL_PROPAGATORS
+// não está definida.
+const defaultPropagators = "tracecontext,baggage"
+
+// newPropagator constrói o propagador global a partir dos nomes indicados (vindos de
+// OTEL_PROPAGATORS): `tracecontext`, `baggage`, `b3` (cabeçalho único `b3`) e `b3multi`
+// (cabeçalhos `X-B3-*`). O B3 permite ligar os traces a serviços legados baseados no
+// Zipkin. Na extração, vale o primeiro propagador que encontrar um contexto.
+func newPropagator(names []string) (propagation.TextMapPropagator, error) {
+	var propagators []propagation.TextMapPropagator
+	for _, name := range names {
+		switch name = strings.TrimSpace(name); name {
+		case "tracecontext":
+			propagators = append(propagators, propagation.TraceContext{})
+		case "baggage":
+			propagators = append(propagators, propagation.Baggage{})
+		case "b3":
+			propagators = append(propagators, b3.New(b3.WithInjectEncoding(b3.B3SingleHeader)))
+		case "b3multi":
+			propagators = append(propagators, b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)))
+		default:
+			return nil, fmt.Errorf("OTEL_PROPAGATORS contém um propagador desconhecido (tracecontext, baggage, b3 ou b3multi): %q", name)
+		}
+	}
+	return propagation.NewCompositeTextMapPropagator(propagators...), nil
+}
@@ -0,0 +1,71 @@
+package tracer
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// routeSampleRatiosFromEnv lê de ROUTE_SAMPLE_RATIOS as frações de amostragem por rota,
+// no formato `padrão=fração` separado por vírgulas (ex: "/weather/{cep}=1,/weather/batch=0.1").
+// Os padrões são os do Chi. Devolve nil quando a variável não está definida.
+func routeSampleRatiosFromEnv() (map[string]float64, error) {
+	value := os.Getenv("ROUTE_SAMPLE_RATIOS")
+	if value == "" {
+		return nil, nil
+	}
+	ratios := map[string]float64{}
+	for _, entry := range strings.Split(value, ",") {
+		route, rawRatio, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		ratio, err := strconv.ParseFloat(rawRatio, 64)
+		if !ok || route == "" || err != nil || ratio < 0 || ratio > 1 {
+			return nil, fmt.Errorf("ROUTE_SAMPLE_RATIOS deve ter o formato rota=fração (entre 0 e 1): %q", entry)
+		}
+		ratios[route] = ratio
+	}
+	return ratios, nil
+}
+
+// routeSampler aplica uma fração de amostragem diferente a cada rota.
+//
+// A decisão "head" do span do servidor é tomada quando o span é criado, e os atributos
+// desse span (como `http.route`) ainda não incluem a rota. Nos nossos serviços, porém, o
+// middleware do OTEL envolve cada rota depois de o Chi fazer o roteamento, por isso o
+// contexto passado ao sampler já contém o RouteContext do Chi com o padrão resolvido. O
+// sampler lê-o daí; sem RouteContext (ou para rotas sem fração configurada), vale o
+// amostrador global.
+//
+// Cada fração é envolvida em ParentBased: os spans filhos seguem a decisão do pai, e um
+// span com pai remoto (ex: o do Serviço B, chamado pelo Serviço A) segue a decisão do
+// serviço anterior. A fração por rota decide, por isso, apenas os traces que começam
+// nessa rota.
+type routeSampler struct {
+	routes   map[string]sdktrace.Sampler
+	fallback sdktrace.Sampler
+}
+
+// newRouteSampler cria o sampler com as frações por rota e o amostrador das restantes.
+func newRouteSampler(ratios map[string]float64, fallback sdktrace.Sampler) routeSampler {
+	routes := make(map[string]sdktrace.Sampler, len(ratios))
+	for route, ratio := range ratios {
+		routes[route] = sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))
+	}
+	return routeSampler{routes: routes, fallback: fallback}
+}
+
+func (s routeSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if rctx := chi.RouteContext(p.ParentContext); rctx != nil {
+		if sampler, ok := s.routes[rctx.RoutePattern()]; ok {
+			return sampler.ShouldSample(p)
+		}
+	}
+	return s.fallback.ShouldSample(p)
+}
+
+func (s routeSampler) Description() string {
+	return fmt.Sprintf("RouteSampler{routes:%d,fallback:%s}", len(s.routes), s.fallback.Description())
+}
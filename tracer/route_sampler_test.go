@@ -0,0 +1,70 @@
+package tracer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestRouteSamplerAppliesRouteRatios(t *testing.T) {
+	sampler := newRouteSampler(map[string]float64{
+		"/weather/{cep}": 1,
+		"/weather/batch": 0,
+	}, sdktrace.NeverSample())
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSampler(sampler))
+	t.Cleanup(func() { tp.Shutdown(t.Context()) })
+
+	// Como nos serviços, o middleware do OTEL envolve cada rota depois do roteamento.
+	sampled := map[string]bool{}
+	route := func(name string) http.Handler {
+		return otelhttp.NewHandler(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			sampled[name] = trace.SpanContextFromContext(r.Context()).IsSampled()
+		}), name, otelhttp.WithTracerProvider(tp))
+	}
+	r := chi.NewRouter()
+	r.Method(http.MethodGet, "/weather/{cep}", route("cep"))
+	r.Method(http.MethodPost, "/weather/batch", route("batch"))
+	r.Method(http.MethodGet, "/weather/search", route("search"))
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/weather/01001000", nil),
+		httptest.NewRequest(http.MethodPost, "/weather/batch", nil),
+		httptest.NewRequest(http.MethodGet, "/weather/search", nil),
+	} {
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	want := map[string]bool{
+		"cep":    true,
+		"batch":  false,
+		"search": false, // sem fração própria, vale o amostrador global
+	}
+	for name, wantSampled := range want {
+		if got, ok := sampled[name]; !ok || got != wantSampled {
+			t.Errorf("rota %s amostrada = %v, esperado %v", name, got, wantSampled)
+		}
+	}
+}
+
+func TestRouteSampleRatiosFromEnv(t *testing.T) {
+	t.Setenv("ROUTE_SAMPLE_RATIOS", " /weather/{cep}=1 , /weather/batch=0.1")
+	ratios, err := routeSampleRatiosFromEnv()
+	if err != nil {
+		t.Fatalf("routeSampleRatiosFromEnv: %v", err)
+	}
+	if len(ratios) != 2 || ratios["/weather/{cep}"] != 1 || ratios["/weather/batch"] != 0.1 {
+		t.Errorf("frações = %v", ratios)
+	}
+
+	for _, value := range []string{"/weather/batch", "/weather/batch=2", "=0.5", "/weather/batch=metade"} {
+		t.Setenv("ROUTE_SAMPLE_RATIOS", value)
+		if _, err := routeSampleRatiosFromEnv(); err == nil {
+			t.Errorf("esperado erro para ROUTE_SAMPLE_RATIOS=%q", value)
+		}
+	}
+}
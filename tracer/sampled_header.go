@@ -0,0 +1,23 @@
+package tracer
+
+import (
+	"net/http"
+	"strconv"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SampledHeader é o cabeçalho de resposta que indica se o trace da requisição foi amostrado.
+const SampledHeader = "X-Trace-Sampled"
+
+// SampledHeaderMiddleware acrescenta à resposta o cabeçalho `X-Trace-Sampled` com a decisão
+// de amostragem do span atual, para que quem faz a requisição perceba porque é que o trace
+// não aparece no backend. Deve envolver o handler dentro do middleware do OTEL, para que o
+// span do servidor já exista.
+func SampledHeaderMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sampled := trace.SpanContextFromContext(r.Context()).IsSampled()
+		w.Header().Set(SampledHeader, strconv.FormatBool(sampled))
+		next.ServeHTTP(w, r)
+	})
+}
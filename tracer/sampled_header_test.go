@@ -0,0 +1,41 @@
+package tracer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestSampledHeaderMiddleware(t *testing.T) {
+	for _, ratio := range []float64{1, 0} {
+		t.Run(strconv.FormatFloat(ratio, 'g', -1, 64), func(t *testing.T) {
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSampler(newSampler("traceidratio", ratio)))
+			t.Cleanup(func() { tp.Shutdown(t.Context()) })
+			handler := otelhttp.NewHandler(
+				SampledHeaderMiddleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})),
+				"WeatherHandler",
+				otelhttp.WithTracerProvider(tp),
+			)
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/weather/01001000", nil))
+			want := strconv.FormatBool(ratio == 1)
+			if got := rec.Header().Get(SampledHeader); got != want {
+				t.Errorf("%s = %q, esperado %q", SampledHeader, got, want)
+			}
+		})
+	}
+}
+
+func TestSampledHeaderWithoutSpan(t *testing.T) {
+	rec := httptest.NewRecorder()
+	SampledHeaderMiddleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})).
+		ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/weather/01001000", nil))
+	if got := rec.Header().Get(SampledHeader); got != "false" {
+		t.Errorf("%s = %q, esperado false sem span", SampledHeader, got)
+	}
+}
@@ -0,0 +1,65 @@
+package tracer
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// defaultSampler é o amostrador usado quando OTEL_TRACES_SAMPLER não está definido.
+const defaultSampler = "always_on"
+
+// samplerFromEnv lê o amostrador de OTEL_TRACES_SAMPLER e a fração de
+// OTEL_TRACES_SAMPLER_ARG. Valores aceites: `always_on` (padrão), `always_off`,
+// `traceidratio` e as variantes `parentbased_*` da especificação do OTEL. A fração (padrão 1)
+// só é usada pelos amostradores `traceidratio` e `parentbased_traceidratio`.
+func samplerFromEnv() (string, float64, error) {
+	name := os.Getenv("OTEL_TRACES_SAMPLER")
+	if name == "" {
+		name = defaultSampler
+	}
+	if !isValidSampler(name) {
+		return "", 0, fmt.Errorf("OTEL_TRACES_SAMPLER deve ser always_on, always_off, traceidratio ou parentbased_*: %q", name)
+	}
+	ratio := 1.0
+	if value := os.Getenv("OTEL_TRACES_SAMPLER_ARG"); value != "" {
+		var err error
+		ratio, err = strconv.ParseFloat(value, 64)
+		if err != nil || ratio < 0 || ratio > 1 {
+			return "", 0, fmt.Errorf("OTEL_TRACES_SAMPLER_ARG deve ser um número entre 0 e 1: %q", value)
+		}
+	}
+	return name, ratio, nil
+}
+
+// isValidSampler indica se newSampler conhece o amostrador indicado.
+func isValidSampler(name string) bool {
+	switch name {
+	case "always_on", "always_off", "traceidratio",
+		"parentbased_always_on", "parentbased_always_off", "parentbased_traceidratio":
+		return true
+	}
+	return false
+}
+
+// newSampler constrói o amostrador indicado. `always_on` e `always_off` ignoram a decisão
+// do span pai; `traceidratio` amostra a fração indicada e é envolvido em ParentBased, para
+// que os spans filhos (incluindo os do serviço seguinte) sigam a decisão do pai e os traces
+// nunca fiquem incompletos, tal como as variantes `parentbased_*`. Um nome desconhecido
+// (já recusado por Config.Validate) usa `always_on`.
+func newSampler(name string, ratio float64) sdktrace.Sampler {
+	switch name {
+	case "always_off":
+		return sdktrace.NeverSample()
+	case "traceidratio", "parentbased_traceidratio":
+		return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))
+	case "parentbased_always_on":
+		return sdktrace.ParentBased(sdktrace.AlwaysSample())
+	case "parentbased_always_off":
+		return sdktrace.ParentBased(sdktrace.NeverSample())
+	default:
+		return sdktrace.AlwaysSample()
+	}
+}
@@ -0,0 +1,91 @@
+package tracer
+
+import (
+	"context"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// parentContext devolve um contexto com um span remoto, amostrado ou não.
+func parentContext(sampled bool) context.Context {
+	cfg := trace.SpanContextConfig{
+		TraceID: trace.TraceID{0x01},
+		SpanID:  trace.SpanID{0x01},
+		Remote:  true,
+	}
+	if sampled {
+		cfg.TraceFlags = trace.FlagsSampled
+	}
+	return trace.ContextWithRemoteSpanContext(context.Background(), trace.NewSpanContext(cfg))
+}
+
+func TestNewSampler(t *testing.T) {
+	tests := []struct {
+		name    string
+		sampler string
+		ratio   float64
+		parent  context.Context
+		want    sdktrace.SamplingDecision
+	}{
+		{"always_on na raiz", "always_on", 1, context.Background(), sdktrace.RecordAndSample},
+		{"always_on com pai não amostrado", "always_on", 1, parentContext(false), sdktrace.RecordAndSample},
+		{"always_off na raiz", "always_off", 1, context.Background(), sdktrace.Drop},
+		{"always_off com pai amostrado", "always_off", 1, parentContext(true), sdktrace.Drop},
+		{"traceidratio 1 na raiz", "traceidratio", 1, context.Background(), sdktrace.RecordAndSample},
+		{"traceidratio 0 na raiz", "traceidratio", 0, context.Background(), sdktrace.Drop},
+		{"traceidratio 0 com pai amostrado", "traceidratio", 0, parentContext(true), sdktrace.RecordAndSample},
+		{"traceidratio 1 com pai não amostrado", "traceidratio", 1, parentContext(false), sdktrace.Drop},
+		{"parentbased_always_on com pai não amostrado", "parentbased_always_on", 1, parentContext(false), sdktrace.Drop},
+		{"parentbased_always_off com pai amostrado", "parentbased_always_off", 1, parentContext(true), sdktrace.RecordAndSample},
+		{"parentbased_always_off na raiz", "parentbased_always_off", 1, context.Background(), sdktrace.Drop},
+		{"parentbased_traceidratio com pai amostrado", "parentbased_traceidratio", 0, parentContext(true), sdktrace.RecordAndSample},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := newSampler(tt.sampler, tt.ratio).ShouldSample(sdktrace.SamplingParameters{
+				ParentContext: tt.parent,
+				TraceID:       trace.TraceID{0xff},
+				Name:          "span",
+			})
+			if result.Decision != tt.want {
+				t.Errorf("decisão = %v, esperado %v", result.Decision, tt.want)
+			}
+		})
+	}
+}
+
+func TestSamplerFromEnv(t *testing.T) {
+	tests := []struct {
+		sampler, arg string
+		want         string
+		wantRatio    float64
+		wantErr      bool
+	}{
+		{"", "", "always_on", 1, false},
+		{"always_on", "", "always_on", 1, false},
+		{"always_off", "", "always_off", 1, false},
+		{"traceidratio", "", "traceidratio", 1, false},
+		{"traceidratio", "0.1", "traceidratio", 0.1, false},
+		{"parentbased_always_on", "", "parentbased_always_on", 1, false},
+		{"parentbased_traceidratio", "0.25", "parentbased_traceidratio", 0.25, false},
+		{"traceidratio", "1.5", "", 0, true},
+		{"traceidratio", "-0.1", "", 0, true},
+		{"traceidratio", "metade", "", 0, true},
+		{"jaeger_remote", "", "", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sampler+"="+tt.arg, func(t *testing.T) {
+			t.Setenv("OTEL_TRACES_SAMPLER", tt.sampler)
+			t.Setenv("OTEL_TRACES_SAMPLER_ARG", tt.arg)
+			got, ratio, err := samplerFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("erro = %v, esperado erro: %v", err, tt.wantErr)
+			}
+			if got != tt.want || ratio != tt.wantRatio {
+				t.Errorf("amostrador = %q com fração %v, esperado %q com %v", got, ratio, tt.want, tt.wantRatio)
+			}
+		})
+	}
+}
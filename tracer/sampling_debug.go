@@ -0,0 +1,155 @@
+package tracer
+
+import (
+	"Observabilidade/logging"
+	"context"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// samplingLogInterval é o intervalo mínimo entre dois logs de decisões de amostragem,
+// para que o modo de depuração não inunde os logs sob carga.
+const samplingLogInterval = 100 * time.Millisecond
+
+// debugSampling indica se o provider atual foi criado com DebugSampling. Sem ele, os
+// middlewares de depuração da amostragem não fazem nada.
+var debugSampling atomic.Bool
+
+// debugSamplingFromEnv indica se DEBUG_SAMPLING=true está definido.
+func debugSamplingFromEnv() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("DEBUG_SAMPLING"))
+	return enabled
+}
+
+// samplingDecisionKey é a chave (não exportada) do samplingDecision no contexto.
+type samplingDecisionKey struct{}
+
+// samplingDecision é a decisão de amostragem do span raiz de uma requisição, preenchida
+// pelo loggingSampler e registada por SamplingLogMiddleware.
+type samplingDecision struct {
+	recorded   bool
+	spanName   string
+	decision   sdktrace.SamplingDecision
+	sampler    string
+	reason     string
+	suppressed int
+}
+
+// loggingSampler envolve outro Sampler e guarda no contexto da requisição (ver
+// SamplingDecisionMiddleware), de forma limitada no tempo, a decisão tomada para o span
+// raiz: amostrado ou descartado, e porquê. O registo nos logs fica a cargo de
+// SamplingLogMiddleware, com o logger da requisição.
+type loggingSampler struct {
+	sdktrace.Sampler
+
+	mu         sync.Mutex
+	lastLog    time.Time
+	suppressed int
+}
+
+// newLoggingSampler devolve o sampler indicado envolvido pelo registo de decisões.
+func newLoggingSampler(s sdktrace.Sampler) *loggingSampler {
+	return &loggingSampler{Sampler: s}
+}
+
+// ShouldSample delega a decisão no sampler envolvido e, para os spans raiz, guarda-a no
+// samplingDecision do contexto, quando existe.
+func (s *loggingSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	result := s.Sampler.ShouldSample(p)
+
+	parent := trace.SpanContextFromContext(p.ParentContext)
+	if parent.IsValid() && !parent.IsRemote() {
+		return result
+	}
+	record, ok := p.ParentContext.Value(samplingDecisionKey{}).(*samplingDecision)
+	if !ok || record.recorded {
+		return result
+	}
+	suppressed, ok := s.allow()
+	if !ok {
+		return result
+	}
+
+	reason := "sampler"
+	if parent.IsValid() {
+		reason = "remote parent sampled=" + strconv.FormatBool(parent.IsSampled())
+	}
+	*record = samplingDecision{
+		recorded:   true,
+		spanName:   p.Name,
+		decision:   result.Decision,
+		sampler:    s.Description(),
+		reason:     reason,
+		suppressed: suppressed,
+	}
+	return result
+}
+
+// allow indica se já passou tempo suficiente desde o último log. Quando passou, devolve
+// também quantas decisões ficaram por registar entretanto.
+func (s *loggingSampler) allow() (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastLog) < samplingLogInterval {
+		s.suppressed++
+		return 0, false
+	}
+	suppressed := s.suppressed
+	s.lastLog = now
+	s.suppressed = 0
+	return suppressed, true
+}
+
+// SamplingDecisionMiddleware prepara o contexto da requisição para receber a decisão de
+// amostragem do span do servidor. Com DEBUG_SAMPLING=true, deve envolver o middleware do
+// OTEL, para que o contexto já a transporte quando o span é criado.
+func SamplingDecisionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !debugSampling.Load() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := context.WithValue(r.Context(), samplingDecisionKey{}, &samplingDecision{})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// SamplingLogMiddleware regista, com o logger da requisição (ver logging.Middleware), a
+// decisão de amostragem guardada por SamplingDecisionMiddleware. Deve ficar dentro de
+// logging.Middleware.
+func SamplingLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if record, ok := ctx.Value(samplingDecisionKey{}).(*samplingDecision); ok && record.recorded {
+			logging.LoggerFromContext(ctx).Info("sampling decision",
+				"span_name", record.spanName,
+				"decision", decisionName(record.decision),
+				"sampler", record.sampler,
+				"reason", record.reason,
+				"suppressed_since_last_log", record.suppressed,
+			)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// decisionName converte a decisão do SDK num texto legível.
+func decisionName(d sdktrace.SamplingDecision) string {
+	switch d {
+	case sdktrace.RecordAndSample:
+		return "sampled"
+	case sdktrace.RecordOnly:
+		return "record_only"
+	default:
+		return "dropped"
+	}
+}
@@ -0,0 +1,125 @@
+package tracer
+
+import (
+	"Observabilidade/logging"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// samplingDebugHandler monta a cadeia usada pelos serviços, com um provider cujo sampler é
+// newSampler("traceidratio", ratio) com o registo de decisões, e devolve também os logs da requisição.
+func samplingDebugHandler(t *testing.T, ratio float64) (http.Handler, *bytes.Buffer) {
+	t.Helper()
+	debugSampling.Store(true)
+	t.Cleanup(func() { debugSampling.Store(false) })
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSampler(newLoggingSampler(newSampler("traceidratio", ratio))))
+	t.Cleanup(func() { tp.Shutdown(t.Context()) })
+
+	logs := &bytes.Buffer{}
+	logger := slog.New(slog.NewJSONHandler(logs, nil))
+	// Faz o papel de logging.Middleware, com um logger que escreve para o buffer.
+	withLogger := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(logging.WithLogger(r.Context(), logger)))
+		})
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := otelhttp.NewHandler(withLogger(SamplingLogMiddleware(ok)), "test", otelhttp.WithTracerProvider(tp),
+		otelhttp.WithPropagators(propagation.TraceContext{}))
+	return SamplingDecisionMiddleware(handler), logs
+}
+
+// samplingLogs devolve as entradas "sampling decision" escritas nos logs.
+func samplingLogs(t *testing.T, logs *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var entries []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("log inválido %q: %v", line, err)
+		}
+		if entry["msg"] == "sampling decision" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func TestSamplingDecisionLogReflectsRatio(t *testing.T) {
+	for ratio, want := range map[float64]string{1: "sampled", 0: "dropped"} {
+		handler, logs := samplingDebugHandler(t, ratio)
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+		entries := samplingLogs(t, logs)
+		if len(entries) != 1 {
+			t.Fatalf("fração %v: esperado um log de decisão, obtido %d", ratio, len(entries))
+		}
+		if got := entries[0]["decision"]; got != want {
+			t.Errorf("fração %v: decisão = %v, esperado %s", ratio, got, want)
+		}
+		if got := entries[0]["reason"]; got != "sampler" {
+			t.Errorf("fração %v: motivo = %v, esperado sampler", ratio, got)
+		}
+	}
+}
+
+func TestSamplingDecisionLogShowsRemoteParent(t *testing.T) {
+	handler, logs := samplingDebugHandler(t, 1)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("traceparent", "00-0102030405060708090a0b0c0d0e0f10-0102030405060708-00")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	entries := samplingLogs(t, logs)
+	if len(entries) != 1 {
+		t.Fatalf("esperado um log de decisão, obtido %d", len(entries))
+	}
+	if entries[0]["decision"] != "dropped" || entries[0]["reason"] != "remote parent sampled=false" {
+		t.Errorf("decisão = %v (%v), esperado dropped pelo pai remoto", entries[0]["decision"], entries[0]["reason"])
+	}
+}
+
+func TestSamplingDecisionLogIsRateLimited(t *testing.T) {
+	handler, logs := samplingDebugHandler(t, 1)
+	serve := func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+	serve()
+	serve()
+	serve()
+	if entries := samplingLogs(t, logs); len(entries) != 1 {
+		t.Fatalf("esperado um único log dentro do intervalo, obtido %d", len(entries))
+	}
+
+	time.Sleep(samplingLogInterval + 10*time.Millisecond)
+	serve()
+	entries := samplingLogs(t, logs)
+	if len(entries) != 2 {
+		t.Fatalf("esperado um novo log após o intervalo, obtido %d", len(entries))
+	}
+	if got := entries[1]["suppressed_since_last_log"]; got != float64(2) {
+		t.Errorf("suppressed_since_last_log = %v, esperado 2", got)
+	}
+}
+
+func TestSamplingDecisionMiddlewareDisabled(t *testing.T) {
+	handler, logs := samplingDebugHandler(t, 1)
+	debugSampling.Store(false)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if entries := samplingLogs(t, logs); len(entries) != 0 {
+		t.Errorf("sem DEBUG_SAMPLING não deveria haver logs de decisão, obtido %d", len(entries))
+	}
+}
@@ -0,0 +1,29 @@
+package tracer
+
+import (
+	"Observabilidade/logging"
+	"context"
+	"fmt"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// DefaultShutdownTimeout é um prazo razoável para o envio dos spans pendentes no
+// encerramento: cobre alguns lotes de exportação sem atrasar demasiado um redeploy.
+const DefaultShutdownTimeout = 5 * time.Second
+
+// ShutdownWithTimeout desliga o provider, esperando no máximo `d` que o batch processor
+// envie os spans pendentes. Um coletor que não responde deixa assim de bloquear o fim do
+// processo. O erro (incluindo o fim do prazo) é registado e devolvido.
+func ShutdownWithTimeout(tp *sdktrace.TracerProvider, d time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+
+	if err := tp.Shutdown(ctx); err != nil {
+		err = fmt.Errorf("falha ao desligar o tracer provider em %s: %w", d, err)
+		logging.Default().Error("erro ao desligar tracer provider", "timeout", d.String(), "error", err)
+		return err
+	}
+	return nil
+}
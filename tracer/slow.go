@@ -0,0 +1,48 @@
+package tracer
+
+import (
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// SlowTraceKey é o atributo adicionado aos spans raiz que excederam o limiar de latência.
+// Um coletor com tail sampling pode usá-lo para reter sempre os traces lentos, mesmo
+// quando os restantes são amostrados com uma taxa reduzida.
+const SlowTraceKey = attribute.Key("trace.slow")
+
+// slowSpanProcessor envolve outro SpanProcessor e, no fim de cada span raiz do serviço,
+// verifica se a sua duração excedeu o limiar. Se sim, o span é repassado com o atributo
+// `trace.slow=true`. A decisão de amostragem "head" é tomada no início do span, antes de
+// a latência ser conhecida; por isso a retenção completa dos traces lentos exige tail
+// sampling no coletor, baseado neste atributo.
+type slowSpanProcessor struct {
+	sdktrace.SpanProcessor
+	threshold time.Duration
+}
+
+// OnEnd marca os spans raiz lentos antes de os entregar ao processador seguinte.
+func (p slowSpanProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	// Consideramos raiz o primeiro span do serviço: sem pai, ou com um pai remoto
+	// (ex: o span do servidor do Serviço B, cujo pai vem do Serviço A).
+	isRoot := !s.Parent().IsValid() || s.Parent().IsRemote()
+	if isRoot && s.EndTime().Sub(s.StartTime()) > p.threshold {
+		s = slowSpan{ReadOnlySpan: s}
+	}
+	p.SpanProcessor.OnEnd(s)
+}
+
+// slowSpan expõe os atributos do span original acrescidos de `trace.slow=true`.
+// Um span terminado é imutável, por isso o atributo é acrescentado nesta vista.
+type slowSpan struct {
+	sdktrace.ReadOnlySpan
+}
+
+// Attributes devolve uma cópia dos atributos originais com a marca de trace lento.
+func (s slowSpan) Attributes() []attribute.KeyValue {
+	attrs := s.ReadOnlySpan.Attributes()
+	out := make([]attribute.KeyValue, 0, len(attrs)+1)
+	out = append(out, attrs...)
+	return append(out, SlowTraceKey.Bool(true))
+}
@@ -0,0 +1,59 @@
+package tracer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// transportCredentials escolhe as credenciais da ligação gRPC ao coletor, a partir
+// da configuração TLS de newTLSConfig.
+func transportCredentials(cfg Config) (credentials.TransportCredentials, error) {
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig == nil {
+		return insecure.NewCredentials(), nil
+	}
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+// newTLSConfig devolve a configuração TLS da ligação ao coletor, ou nil para uma ligação
+// sem encriptação. Por omissão (Insecure, de OTEL_EXPORTER_OTLP_INSECURE vazia ou true) a
+// ligação não é encriptada, o que serve o docker-compose local. Com TLS, o certificado do
+// coletor é validado com a CA de CACertFile (OTEL_EXPORTER_OTLP_CERTIFICATE) ou, sem ela,
+// com as CAs do sistema. Para coletores que exigem autenticação do cliente (mTLS),
+// ClientCertFile e ClientKeyFile (OTEL_EXPORTER_OTLP_CLIENT_CERTIFICATE e
+// OTEL_EXPORTER_OTLP_CLIENT_KEY) indicam o par certificado/chave apresentado pelo serviço.
+func newTLSConfig(cfg Config) (*tls.Config, error) {
+	if cfg.Insecure {
+		return nil, nil
+	}
+
+	// Uma tls.Config sem RootCAs usa o conjunto de CAs do sistema.
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.CACertFile != "" {
+		pem, err := os.ReadFile(cfg.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("falha ao ler a CA do coletor (OTEL_EXPORTER_OTLP_CERTIFICATE=%q): %w", cfg.CACertFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("a CA do coletor (OTEL_EXPORTER_OTLP_CERTIFICATE=%q) não contém certificados PEM válidos", cfg.CACertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.ClientCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCertFile, cfg.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("falha ao carregar o certificado de cliente do coletor (%q, %q): %w", cfg.ClientCertFile, cfg.ClientKeyFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
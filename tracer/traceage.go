@@ -0,0 +1,61 @@
+package tracer
+
+import (
+	"Observabilidade/logging"
+	"context"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceAgeKey é a entrada do `tracestate` onde o Serviço A regista, em segundos Unix,
+// quando o contexto de trace foi propagado pela última vez.
+const TraceAgeKey = "obsts"
+
+// traceAgePropagator envolve o propagador W3C Trace Context. Na injeção, carimba o
+// `tracestate` com a hora atual; na extração, descarta o contexto recebido cujo carimbo
+// seja mais antigo do que `maxAge` (ou esteja no futuro além dessa margem), fazendo com
+// que a requisição inicie um trace novo. Contextos sem carimbo são aceites.
+type traceAgePropagator struct {
+	propagation.TraceContext
+	maxAge time.Duration
+}
+
+// Inject acrescenta (ou atualiza) o carimbo no `tracestate` antes de propagar o contexto.
+func (p traceAgePropagator) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	sc := trace.SpanContextFromContext(ctx)
+	if sc.IsValid() {
+		ts, err := sc.TraceState().Insert(TraceAgeKey, strconv.FormatInt(time.Now().Unix(), 10))
+		if err == nil {
+			ctx = trace.ContextWithSpanContext(ctx, sc.WithTraceState(ts))
+		}
+	}
+	p.TraceContext.Inject(ctx, carrier)
+}
+
+// Extract devolve o contexto original, sem o trace recebido, quando o carimbo expirou.
+func (p traceAgePropagator) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	extracted := p.TraceContext.Extract(ctx, carrier)
+	sc := trace.SpanContextFromContext(extracted)
+	value := sc.TraceState().Get(TraceAgeKey)
+	if value == "" {
+		return extracted
+	}
+	stamp, err := strconv.ParseInt(value, 10, 64)
+	age := time.Since(time.Unix(stamp, 0))
+	if err == nil && age <= p.maxAge && age >= -p.maxAge {
+		return extracted
+	}
+	logging.Default().Warn("contexto de trace recebido expirado: iniciamos um trace novo",
+		"trace_id", sc.TraceID().String(), "tracestate_ts", value)
+	return ctx
+}
+
+// TraceAgePropagators combina o traceAgePropagator com o propagador de baggage, que
+// continua a ser aceite mesmo quando o trace recebido é descartado. O Serviço A usa-o para
+// carimbar o contexto que propaga e o Serviço B para recusar os carimbos expirados.
+func TraceAgePropagators(maxAge time.Duration) propagation.TextMapPropagator {
+	return propagation.NewCompositeTextMapPropagator(traceAgePropagator{maxAge: maxAge}, propagation.Baggage{})
+}
@@ -0,0 +1,82 @@
+package tracer
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const testTraceparent = "00-0102030405060708090a0b0c0d0e0f10-0102030405060708-01"
+
+// carrierWithStamp devolve cabeçalhos com um `traceparent` e, se `stamp` não for zero, o
+// carimbo `obsts` com essa hora.
+func carrierWithStamp(stamp time.Time) propagation.MapCarrier {
+	carrier := propagation.MapCarrier{"traceparent": testTraceparent}
+	if !stamp.IsZero() {
+		carrier["tracestate"] = TraceAgeKey + "=" + strconv.FormatInt(stamp.Unix(), 10)
+	}
+	return carrier
+}
+
+func TestTraceAgePropagatorExtract(t *testing.T) {
+	const maxAge = 5 * time.Minute
+	tests := []struct {
+		name    string
+		carrier propagation.MapCarrier
+		want    bool
+	}{
+		{"carimbo recente", carrierWithStamp(time.Now().Add(-time.Minute)), true},
+		{"sem carimbo", carrierWithStamp(time.Time{}), true},
+		{"carimbo expirado", carrierWithStamp(time.Now().Add(-time.Hour)), false},
+		{"carimbo no futuro", carrierWithStamp(time.Now().Add(time.Hour)), false},
+		{"carimbo inválido", propagation.MapCarrier{"traceparent": testTraceparent, "tracestate": TraceAgeKey + "=ontem"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := TraceAgePropagators(maxAge).Extract(context.Background(), tt.carrier)
+			if got := trace.SpanContextFromContext(ctx).IsValid(); got != tt.want {
+				t.Errorf("contexto aceite = %v, esperado %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTraceAgePropagatorKeepsBaggageOfStaleContext(t *testing.T) {
+	carrier := carrierWithStamp(time.Now().Add(-time.Hour))
+	carrier["baggage"] = "cep=01001000"
+	ctx := TraceAgePropagators(time.Minute).Extract(context.Background(), carrier)
+	if trace.SpanContextFromContext(ctx).IsValid() {
+		t.Error("o contexto expirado deveria ser descartado")
+	}
+	out := propagation.MapCarrier{}
+	propagation.Baggage{}.Inject(ctx, out)
+	if out["baggage"] != "cep=01001000" {
+		t.Errorf("baggage = %q, esperado o recebido", out["baggage"])
+	}
+}
+
+func TestTraceAgePropagatorInjectStamps(t *testing.T) {
+	parent := propagation.TraceContext{}.Extract(context.Background(), carrierWithStamp(time.Time{}))
+	out := propagation.MapCarrier{}
+	before := time.Now().Unix()
+	TraceAgePropagators(time.Minute).Inject(parent, out)
+
+	ts, err := trace.ParseTraceState(out["tracestate"])
+	if err != nil {
+		t.Fatalf("tracestate inválido %q: %v", out["tracestate"], err)
+	}
+	stamp, err := strconv.ParseInt(ts.Get(TraceAgeKey), 10, 64)
+	if err != nil || stamp < before || stamp > time.Now().Unix() {
+		t.Errorf("carimbo = %q, esperado a hora atual", ts.Get(TraceAgeKey))
+	}
+
+	// O contexto carimbado é aceite por quem o recebe.
+	ctx := TraceAgePropagators(time.Minute).Extract(context.Background(), out)
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		t.Error("o contexto acabado de carimbar deveria ser aceite")
+	}
+}
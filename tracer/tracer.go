@@ -1,71 +1,107 @@
 package tracer
 
 import (
+	"Observabilidade/logging"
 	"context"
+	"errors"
 	"fmt"
+	"runtime/debug"
 
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
-	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/exporters/zipkin"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 )
 
 // InitTracerProvider inicializa e configura o provedor de traces do OpenTelemetry.
 // Ele é responsável por criar os traces e exportá-los para um destino, como o OTEL Collector.
-func InitTracerProvider(serviceName, collectorURL string) (*sdktrace.TracerProvider, error) {
+// A restante configuração (TLS, amostragem, lotes, ...) vem das variáveis de ambiente
+// OTEL_* (ver configFromEnv), sobre os padrões de DefaultConfig.
+// As opções (ex: WithExporter) permitem personalizar a inicialização.
+func InitTracerProvider(serviceName, collectorURL string, opts ...Option) (*sdktrace.TracerProvider, error) {
+	cfg, err := configFromEnv(serviceName, collectorURL)
+	if err != nil {
+		return nil, err
+	}
 	// Usamos context.Background() como o contexto pai, pois esta inicialização
 	// deve viver durante todo o ciclo de vida da aplicação.
-	ctx := context.Background()
+	return InitTracerProviderWithConfig(context.Background(), cfg, opts...)
+}
 
-	// resource.New cria um "recurso" que descreve a nossa aplicação.
-	// Todos os spans gerados por este provider terão estes atributos.
-	// O atributo mais importante é o `service.name`, que identifica o serviço no Zipkin.
-	res, err := resource.New(ctx,
-		resource.WithAttributes(
-			semconv.ServiceNameKey.String(serviceName),
-		),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("falha ao criar recurso: %w", err)
+// InitTracerProviderWithConfig inicializa o provedor de traces a partir de uma Config
+// explícita, validada antes de qualquer outra coisa; os campos a zero usam o seu padrão.
+// Não lê variáveis de ambiente: toda a configuração vem de `cfg`.
+func InitTracerProviderWithConfig(ctx context.Context, cfg Config, opts ...Option) (*sdktrace.TracerProvider, error) {
+	cfg = cfg.withDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("configuração do tracer inválida: %w", err)
 	}
 
-	// grpc.NewClient estabelece a conexão com o OTEL Collector no endereço fornecido.
-	// Esta chamada é NÃO-BLOQUEANTE. A conexão será estabelecida em segundo plano.
-	// A aplicação iniciará imediatamente, mesmo que o coletor não esteja pronto.
-	// Isso torna a nossa aplicação mais resiliente.
-	// Optamos por esta abordagem para seguir as melhores práticas do gRPC, que desaconselham
-	// o uso da opção `grpc.WithBlock()`, pois pode bloquear o início da aplicação.
-	conn, err := grpc.NewClient(collectorURL,
-		// grpc.WithTransportCredentials(insecure.NewCredentials()) é usado para criar
-		// uma conexão sem encriptação TLS. Adequado apenas para ambientes de desenvolvimento locais.
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-	)
+	res, err := newResource(ctx, cfg)
 	if err != nil {
-		return nil, fmt.Errorf("falha ao criar cliente gRPC para o coletor: %w", err)
+		return nil, err
 	}
 
-	// otlptracegrpc.New cria um exportador de traces que envia dados
-	// usando o protocolo OTLP (OpenTelemetry Protocol) sobre a conexão gRPC que acabámos de configurar.
-	traceExporter, err := otlptracegrpc.New(ctx, otlptracegrpc.WithGRPCConn(conn))
-	if err != nil {
-		return nil, fmt.Errorf("falha ao criar exportador de trace: %w", err)
+	// Aplicamos as opções do chamador. Sem um exportador personalizado, criamos o
+	// exportador escolhido em cfg.Exporter (por omissão, o OTLP, apontado para o OTEL Collector).
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	traceExporter := o.exporter
+	if traceExporter == nil {
+		if traceExporter, err = newSpanExporter(ctx, cfg); err != nil {
+			return nil, err
+		}
 	}
 
 	// NewBatchSpanProcessor é um processador de spans que agrupa os spans em lotes (batches)
 	// antes de os enviar para o exportador. Isto é muito mais eficiente do que enviar cada span individualmente.
-	bsp := sdktrace.NewBatchSpanProcessor(traceExporter)
+	// O tamanho da fila, dos lotes e o intervalo entre envios podem ser ajustados na Config
+	// (OTEL_BSP_* e TRACE_EXPORT_MAX_PAYLOAD_BYTES; ver batchOptions).
+	var bsp sdktrace.SpanProcessor = sdktrace.NewBatchSpanProcessor(traceExporter, batchOptions(cfg)...)
+
+	// Com SlowTraceThreshold (SLOW_TRACE_MS), os spans raiz que excedem esse limiar são
+	// marcados com o atributo `trace.slow`, para que o coletor os possa reter via tail sampling.
+	if cfg.SlowTraceThreshold > 0 {
+		bsp = slowSpanProcessor{SpanProcessor: bsp, threshold: cfg.SlowTraceThreshold}
+	}
+
+	// Os nomes dos propagadores já foram validados por cfg.Validate.
+	propagator, err := newPropagator(cfg.Propagators)
+	if err != nil {
+		return nil, err
+	}
 
 	// NewTracerProvider é o construtor principal do SDK. Ele junta a configuração do recurso,
 	// o amostrador (sampler) e o processador de spans.
+	// Por omissão, o amostrador grava e exporta 100% dos traces, o que é ótimo para
+	// desenvolvimento e depuração. Em produção, o amostrador `traceidratio` com uma
+	// SampleRatio menor (OTEL_TRACES_SAMPLER_ARG) reduz o volume de dados.
+	sampler := newSampler(cfg.Sampler, cfg.SampleRatio)
+
+	// Com RouteSampleRatios (ROUTE_SAMPLE_RATIOS), as rotas indicadas usam a sua própria
+	// fração de amostragem (ver routeSampler); as restantes continuam a usar o amostrador global.
+	if len(cfg.RouteSampleRatios) > 0 {
+		sampler = newRouteSampler(cfg.RouteSampleRatios, sampler)
+	}
+
+	// Com DebugSampling (DEBUG_SAMPLING=true), a decisão de amostragem de cada span raiz é
+	// guardada no contexto da requisição e registada nos logs (ver SamplingLogMiddleware), o
+	// que ajuda a perceber porque é que um trace não aparece no backend.
+	if cfg.DebugSampling {
+		sampler = newLoggingSampler(sampler)
+	}
+	debugSampling.Store(cfg.DebugSampling)
+
 	tp := sdktrace.NewTracerProvider(
-		// sdktrace.WithSampler(sdktrace.AlwaysSample()) configura o tracer para "amostrar",
-		// ou seja, gravar e exportar 100% dos traces. Ótimo para ambientes de desenvolvimento e depuração.
-		// Em produção, pode-se usar um amostrador baseado em probabilidade para reduzir o volume de dados.
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+		sdktrace.WithSampler(sampler),
+		sdktrace.WithSpanLimits(cfg.SpanLimits),
 		sdktrace.WithResource(res),
 		sdktrace.WithSpanProcessor(bsp),
 	)
@@ -77,10 +113,161 @@ func InitTracerProvider(serviceName, collectorURL string) (*sdktrace.TracerProvi
 	// otel.SetTextMapPropagator define o propagador global. O propagador é a peça mágica
 	// que injeta e extrai o contexto de tracing (como Trace IDs e Span IDs) em cabeçalhos
 	// de rede (ex: HTTP, gRPC). É isto que permite ligar os traces entre o Serviço A e o Serviço B.
-	// TraceContext é o formato padrão e amplamente compatível.
-	otel.SetTextMapPropagator(propagation.TraceContext{})
+	// Por omissão usamos o TraceContext, o formato padrão e amplamente compatível, e o
+	// Baggage, que transporta pares chave/valor definidos pela aplicação (ex: o ID de um
+	// incidente) entre serviços. OTEL_PROPAGATORS permite acrescentar o B3 (ver propagatorsFromEnv).
+	otel.SetTextMapPropagator(propagator)
 
 	// Retornamos o TracerProvider para que a função `main` que o chamou possa
 	// gerir o seu ciclo de vida, especificamente chamando `Shutdown()` no final.
 	return tp, nil
 }
+
+// newResource cria o "recurso" que descreve a nossa aplicação. Todos os spans (e métricas)
+// gerados pelos providers terão estes atributos. O atributo mais importante é o
+// `service.name`, que identifica o serviço no Zipkin.
+func newResource(ctx context.Context, cfg Config) (*resource.Resource, error) {
+	// A versão e o ambiente (ex: produção vs. staging) permitem filtrar os traces; só são
+	// adicionados quando conhecidos.
+	attrs := []attribute.KeyValue{semconv.ServiceNameKey.String(cfg.ServiceName)}
+	if version := serviceVersion(cfg); version != "" {
+		attrs = append(attrs, semconv.ServiceVersion(version))
+	}
+	if cfg.DeploymentEnvironment != "" {
+		attrs = append(attrs, semconv.DeploymentEnvironment(cfg.DeploymentEnvironment))
+	}
+
+	// Os detetores de host, processo e sistema operativo acrescentam, entre outros, o nome
+	// do host (o pod, em Kubernetes) e o PID, para distinguir as réplicas de um serviço.
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attrs...),
+		resource.WithHost(),
+		resource.WithProcess(),
+		resource.WithOS(),
+	)
+	// Se algum detetor falhar, o recurso devolvido continua utilizável, apenas sem os
+	// atributos desse detetor: registamos o erro em vez de impedir o arranque.
+	if errors.Is(err, resource.ErrPartialResource) {
+		logging.Default().Warn("recurso do OTEL criado sem alguns atributos", "error", err)
+		return res, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("falha ao criar recurso: %w", err)
+	}
+	return res, nil
+}
+
+// serviceVersion devolve a versão do serviço: cfg.ServiceVersion (SERVICE_VERSION) ou, sem
+// ela, a revisão do controlo de versões registada pelo Go no binário. Devolve "" quando
+// nenhuma é conhecida.
+func serviceVersion(cfg Config) string {
+	if cfg.ServiceVersion != "" {
+		return cfg.ServiceVersion
+	}
+	return buildSetting("vcs.revision")
+}
+
+// buildSetting devolve o valor de uma definição registada pelo Go no binário (ex:
+// `vcs.revision`), ou "" quando não é conhecida.
+func buildSetting(key string) string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == key {
+			return setting.Value
+		}
+	}
+	return ""
+}
+
+// defaultZipkinEndpoint é o endereço da API do Zipkin no docker-compose.
+const defaultZipkinEndpoint = "http://zipkin:9411/api/v2/spans"
+
+// newSpanExporter cria o exportador indicado em cfg.Exporter (OTEL_TRACES_EXPORTER): `otlp`
+// (padrão), `console`, que escreve os spans formatados no stdout, ou `zipkin`, que envia os
+// spans diretamente ao Zipkin (OTEL_EXPORTER_ZIPKIN_ENDPOINT), sem passar pelo coletor. Os dois
+// últimos servem o desenvolvimento: ver os spans no terminal ao correr um serviço fora do
+// Docker, ou dispensar o coletor num ambiente que já tem o Zipkin.
+func newSpanExporter(ctx context.Context, cfg Config) (sdktrace.SpanExporter, error) {
+	switch cfg.Exporter {
+	case "otlp":
+		return newOTLPExporter(ctx, cfg)
+	case "console":
+		traceExporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		if err != nil {
+			return nil, fmt.Errorf("falha ao criar exportador de trace: %w", err)
+		}
+		// Com ConsoleMaxSpansPerSecond (CONSOLE_MAX_SPANS_PER_SECOND), os spans acima do
+		// limite são descartados, com um resumo periódico nos logs (ver rateLimitedExporter).
+		if cfg.ConsoleMaxSpansPerSecond > 0 {
+			return newRateLimitedExporter(traceExporter, cfg.ConsoleMaxSpansPerSecond), nil
+		}
+		return traceExporter, nil
+	case "zipkin":
+		traceExporter, err := zipkin.New(cfg.ZipkinEndpoint)
+		if err != nil {
+			return nil, fmt.Errorf("falha ao criar exportador de trace: %w", err)
+		}
+		return traceExporter, nil
+	default:
+		return nil, fmt.Errorf("OTEL_TRACES_EXPORTER deve ser otlp, console ou zipkin: %q", cfg.Exporter)
+	}
+}
+
+// newOTLPExporter cria o exportador padrão, que envia os spans ao OTEL Collector via OTLP.
+// cfg.Protocol (OTEL_EXPORTER_OTLP_PROTOCOL) escolhe o transporte: `grpc` (padrão) ou `http/protobuf`.
+func newOTLPExporter(ctx context.Context, cfg Config) (sdktrace.SpanExporter, error) {
+	switch cfg.Protocol {
+	case "grpc":
+		return newOTLPGRPCExporter(ctx, cfg)
+	case "http/protobuf":
+		return newOTLPHTTPExporter(ctx, cfg)
+	default:
+		return nil, fmt.Errorf("OTEL_EXPORTER_OTLP_PROTOCOL deve ser grpc ou http/protobuf: %q", cfg.Protocol)
+	}
+}
+
+// newOTLPGRPCExporter cria o exportador que envia os spans ao OTEL Collector via OTLP/gRPC.
+func newOTLPGRPCExporter(ctx context.Context, cfg Config) (sdktrace.SpanExporter, error) {
+	// grpc.NewClient estabelece a conexão com o OTEL Collector no endereço fornecido.
+	// Esta chamada é NÃO-BLOQUEANTE. A conexão será estabelecida em segundo plano.
+	// A aplicação iniciará imediatamente, mesmo que o coletor não esteja pronto.
+	// Isso torna a nossa aplicação mais resiliente.
+	// Optamos por esta abordagem para seguir as melhores práticas do gRPC, que desaconselham
+	// o uso da opção `grpc.WithBlock()`, pois pode bloquear o início da aplicação.
+	// As credenciais são, por omissão, as de uma conexão sem encriptação TLS, adequada
+	// apenas para ambientes de desenvolvimento locais; em produção ativa-se o TLS.
+	creds, err := transportCredentials(cfg)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := grpc.NewClient(stripScheme(cfg.CollectorURL), grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("falha ao criar cliente gRPC para o coletor: %w", err)
+	}
+	// As falhas da ligação ficam nos logs (ver watchConnState) até ao Shutdown do exportador.
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	go watchConnState(watchCtx, conn, cfg.DebugCollectorConn)
+
+	// otlptracegrpc.New cria um exportador de traces que envia dados
+	// usando o protocolo OTLP (OpenTelemetry Protocol) sobre a conexão gRPC que acabámos de configurar.
+	exporterOpts := []otlptracegrpc.Option{otlptracegrpc.WithGRPCConn(conn)}
+	if cfg.ExportTimeout > 0 {
+		exporterOpts = append(exporterOpts, otlptracegrpc.WithTimeout(cfg.ExportTimeout))
+	}
+	if len(cfg.Headers) > 0 {
+		exporterOpts = append(exporterOpts, otlptracegrpc.WithHeaders(cfg.Headers))
+	}
+	if cfg.Compression == "gzip" {
+		exporterOpts = append(exporterOpts, otlptracegrpc.WithCompressor("gzip"))
+	}
+	traceExporter, err := otlptracegrpc.New(ctx, exporterOpts...)
+	if err != nil {
+		stopWatch()
+		conn.Close()
+		return nil, fmt.Errorf("falha ao criar exportador de trace: %w", err)
+	}
+	return connExporter{SpanExporter: traceExporter, conn: conn, stopWatch: stopWatch}, nil
+}